@@ -11,13 +11,24 @@ import (
 
 // ControlFile represents the state of a download
 type ControlFile struct {
-	GID         string   `json:"gid"`
-	TotalLength int64    `json:"total_length"`
-	PieceLength int64    `json:"piece_length"`
-	NumPieces   int      `json:"num_pieces"`
-	Bitfield    string   `json:"bitfield"` // Hex string
-	URIs        []string `json:"uris"`
-	Path        string   `json:"path"` // Output file path
+	GID          string     `json:"gid"`
+	TotalLength  int64      `json:"total_length"`
+	PieceLength  int64      `json:"piece_length"`
+	NumPieces    int        `json:"num_pieces"`
+	Bitfield     string     `json:"bitfield"` // Hex string
+	URIs         []string   `json:"uris"`
+	Path         string     `json:"path"` // Output file path
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"last_modified,omitempty"` // HTTP date
+	Checksum     string     `json:"checksum,omitempty"`      // "algo=digest" to verify the file against
+	Hash         *HashState `json:"hash,omitempty"`          // Incremental checksum progress
+}
+
+// HashState is the progress of a whole-file checksum computed while downloading
+type HashState struct {
+	Algo   string `json:"algo"`
+	Offset int64  `json:"offset"` // Bytes of the file hashed so far
+	State  []byte `json:"state"`  // Serialized hash state
 }
 
 // Controller manages the control file
@@ -39,20 +50,16 @@ func (c *Controller) Exists() bool {
 	return !os.IsNotExist(err)
 }
 
-// Save saves the download state
-func (c *Controller) Save(gid string, ps segment.PieceStorage, uris []string, outPath string) error {
+// Save saves the download state. The piece layout and bitfield are taken
+// from ps, everything else from cf.
+func (c *Controller) Save(cf ControlFile, ps segment.PieceStorage) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	cf := ControlFile{
-		GID:         gid,
-		TotalLength: ps.GetTotalLength(),
-		PieceLength: ps.GetPieceLength(),
-		NumPieces:   ps.GetNumPieces(),
-		Bitfield:    ps.GetBitfield().String(),
-		URIs:        uris,
-		Path:        outPath,
-	}
+	cf.TotalLength = ps.GetTotalLength()
+	cf.PieceLength = ps.GetPieceLength()
+	cf.NumPieces = ps.GetNumPieces()
+	cf.Bitfield = ps.GetBitfield().String()
 
 	data, err := json.MarshalIndent(cf, "", "  ")
 	if err != nil {
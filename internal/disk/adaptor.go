@@ -1,10 +1,10 @@
 package disk
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"sync"
-	"sync/atomic"
 
 	"github.com/divyam234/hydra/internal/util"
 )
@@ -22,9 +22,14 @@ const (
 type DiskAdaptor interface {
 	Open(path string, totalLength int64) error
 	WriteAt(p []byte, off int64) (int, error)
+	ReadAt(p []byte, off int64) (int, error) // Sees the writes issued before the last Sync
+	Sync() error                             // Waits for the writes issued so far to reach the file
 	Close() error
 }
 
+// errClosed is returned for writes after Close
+var errClosed = errors.New("file closed")
+
 // DirectDiskAdaptor writes directly to a file
 type DirectDiskAdaptor struct {
 	file      *os.File
@@ -95,6 +100,16 @@ func (d *DirectDiskAdaptor) WriteAt(p []byte, off int64) (int, error) {
 	return d.file.WriteAt(p, off)
 }
 
+// ReadAt reads from the file at the given offset
+func (d *DirectDiskAdaptor) ReadAt(p []byte, off int64) (int, error) {
+	return d.file.ReadAt(p, off)
+}
+
+// Sync does nothing: writes reach the file before WriteAt returns
+func (d *DirectDiskAdaptor) Sync() error {
+	return nil
+}
+
 // Close closes the file
 func (d *DirectDiskAdaptor) Close() error {
 	d.mu.Lock()
@@ -111,12 +126,14 @@ type BufferedDiskAdaptor struct {
 	writeCh chan writeRequest
 	errorCh chan error
 	wg      sync.WaitGroup
-	closed  atomic.Bool
+	mu      sync.RWMutex // Held for reading while sending on writeCh
+	closed  bool
 }
 
 type writeRequest struct {
 	data   []byte
 	offset int64
+	flush  chan struct{} // If set, closed once all earlier writes are done
 }
 
 // NewBufferedDiskAdaptor creates a new BufferedDiskAdaptor
@@ -141,6 +158,10 @@ func (b *BufferedDiskAdaptor) Open(path string, totalLength int64) error {
 func (b *BufferedDiskAdaptor) writerLoop() {
 	defer b.wg.Done()
 	for req := range b.writeCh {
+		if req.flush != nil {
+			close(req.flush)
+			continue
+		}
 		_, err := b.adaptor.WriteAt(req.data, req.offset)
 		if err != nil {
 			select {
@@ -154,10 +175,6 @@ func (b *BufferedDiskAdaptor) writerLoop() {
 }
 
 func (b *BufferedDiskAdaptor) WriteAt(p []byte, off int64) (int, error) {
-	if b.closed.Load() {
-		return 0, fmt.Errorf("file closed")
-	}
-
 	select {
 	case err := <-b.errorCh:
 		return 0, err
@@ -178,25 +195,59 @@ func (b *BufferedDiskAdaptor) WriteAt(p []byte, off int64) (int, error) {
 	// Slice to actual length
 	toQueue := dataCopy[:len(p)]
 
-	b.writeCh <- writeRequest{data: toQueue, offset: off}
+	if err := b.send(writeRequest{data: toQueue, offset: off}); err != nil {
+		util.PutBuffer(dataCopy)
+		return 0, err
+	}
 
 	return len(p), nil
 }
 
-func (b *BufferedDiskAdaptor) Close() error {
-	if b.closed.CompareAndSwap(false, true) {
-		close(b.writeCh)
-		b.wg.Wait()
-
-		// Check for any final errors
-		select {
-		case err := <-b.errorCh:
-			b.adaptor.Close()
-			return err
-		default:
-		}
+// ReadAt reads from the file. Writes still queued are not seen; call Sync
+// first.
+func (b *BufferedDiskAdaptor) ReadAt(p []byte, off int64) (int, error) {
+	return b.adaptor.ReadAt(p, off)
+}
 
-		return b.adaptor.Close()
+// Sync waits until the writes queued so far have reached the file
+func (b *BufferedDiskAdaptor) Sync() error {
+	flush := make(chan struct{})
+	if err := b.send(writeRequest{flush: flush}); err != nil {
+		return err
 	}
+	<-flush
 	return nil
 }
+
+// send queues req for the writer, unless the adaptor is closed
+func (b *BufferedDiskAdaptor) send(req writeRequest) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return errClosed
+	}
+	b.writeCh <- req
+	return nil
+}
+
+func (b *BufferedDiskAdaptor) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.writeCh)
+	b.mu.Unlock()
+	b.wg.Wait()
+
+	// Check for any final errors
+	select {
+	case err := <-b.errorCh:
+		b.adaptor.Close()
+		return err
+	default:
+	}
+
+	return b.adaptor.Close()
+}
@@ -3,6 +3,7 @@ package disk
 import (
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -121,3 +122,52 @@ func TestBufferedDiskAdaptor(t *testing.T) {
 		t.Errorf("Expected %q, got %q", string(data2), string(buf2))
 	}
 }
+
+func TestBufferedDiskAdaptor_Sync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test-readat.bin")
+
+	d := NewBufferedDiskAdaptor("trunc")
+	if err := d.Open(path, 4096); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer d.Close()
+
+	data := []byte("pending write")
+	if _, err := d.WriteAt(data, 1000); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	// Once synced, the write is seen even if it was still queued
+	if err := d.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	buf := make([]byte, len(data))
+	if _, err := d.ReadAt(buf, 1000); err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if string(buf) != string(data) {
+		t.Errorf("Expected %q, got %q", string(data), string(buf))
+	}
+
+	// Writes racing with Close fail instead of sending on a closed channel
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := d.WriteAt(data, 1000); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	d.Close()
+	wg.Wait()
+	if _, err := d.WriteAt(data, 1000); err == nil {
+		t.Error("WriteAt after Close succeeded")
+	}
+	if err := d.Sync(); err == nil {
+		t.Error("Sync after Close succeeded")
+	}
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	internalhttp "github.com/divyam234/hydra/internal/http"
+)
+
+// WithAuthProvider authenticates the HTTP requests of all downloads with p,
+// in place of http-user and .netrc logins
+func WithAuthProvider(p internalhttp.AuthProvider) EngineOption {
+	return func(e *DownloadEngine) {
+		e.auth = p
+	}
+}
+
+// send sends req with client, authorized by the auth provider of the
+// download, or the S3 signer for requests to the S3 endpoint, if there is
+// one. A 401 answer lets the provider refresh its
+// credentials, and the request is sent once more; a second 401 is returned
+// to the caller and fails the download.
+func (rg *RequestGroup) send(client *http.Client, req *http.Request) (*http.Response, error) {
+	auth := rg.authFor(req.URL)
+	if auth == nil {
+		return client.Do(req)
+	}
+	if err := auth.Authorize(req); err != nil {
+		return nil, fmt.Errorf("authorization failed: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	retry, err := auth.Refresh(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("refreshing credentials failed: %w", err)
+	}
+	if !retry {
+		return resp, nil
+	}
+	// Drain the body so that the connection is reused for the retry
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	req = req.Clone(req.Context())
+	if err := auth.Authorize(req); err != nil {
+		return nil, fmt.Errorf("authorization failed: %w", err)
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// tokenServer serves data to requests with its current token. The first
+// token expires after uses authorized requests, long before the expiry the
+// client is told; the tokens minted after it never do. Each response is
+// delayed by delay, so that requests overlap.
+type tokenServer struct {
+	*httptest.Server
+	uses int
+
+	mu       sync.Mutex
+	current  string
+	minted   int
+	rejected int
+}
+
+func newTokenServer(t *testing.T, data []byte, uses int, delay time.Duration) *tokenServer {
+	inner := setupRangeServer(t, data)
+	t.Cleanup(inner.Close)
+	s := &tokenServer{uses: uses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		ok := r.Header.Get("Authorization") == "Bearer "+s.current && (s.minted > 1 || s.uses > 0)
+		if ok {
+			s.uses--
+		} else {
+			s.rejected++
+		}
+		s.mu.Unlock()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		time.Sleep(delay)
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// mint is the token endpoint of the server
+func (s *tokenServer) mint(context.Context) (*internalhttp.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minted++
+	s.current = fmt.Sprintf("token-%d", s.minted)
+	return &internalhttp.Token{AccessToken: s.current, Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestRequestGroup_TokenExpiresMidDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("oauth2"), 16*1024*1024/6)
+	server := newTokenServer(t, data, 6, 10*time.Millisecond)
+
+	opt := option.GetDefaultOptions()
+	dir := t.TempDir()
+	opt.Put(option.Dir, dir)
+	opt.Put(option.Out, "token.bin")
+	opt.Put(option.Split, "16")
+	opt.Put(option.MaxConnPerServer, "4")
+	opt.Put(option.MinSplitSize, "1M")
+	opt.Put(option.MaxTries, "1") // Only the refresh may retry
+
+	rg := NewRequestGroup("token-expiry", []string{server.URL + "/f"}, opt)
+	rg.SetAuthProvider(internalhttp.NewOAuth2Auth(internalhttp.TokenSourceFunc(server.mint)))
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "token.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("content mismatch")
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.rejected == 0 || server.minted < 2 {
+		t.Errorf("token never expired: %d requests rejected, %d tokens minted", server.rejected, server.minted)
+	}
+	if server.minted > server.rejected+1 {
+		t.Errorf("%d tokens minted for %d rejected requests", server.minted, server.rejected)
+	}
+}
+
+func TestRequestGroup_RejectedCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider internalhttp.AuthProvider
+		requests int32 // For the HEAD request and the range probe
+	}{
+		{"fixed token is not retried", internalhttp.NewBearerAuth("wrong"), 2},
+		{"refreshed token is retried once", internalhttp.NewOAuth2Auth(internalhttp.TokenSourceFunc(
+			func(context.Context) (*internalhttp.Token, error) {
+				return &internalhttp.Token{AccessToken: "wrong"}, nil
+			})), 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			}))
+			defer server.Close()
+
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, t.TempDir())
+			opt.Put(option.MaxTries, "1")
+			rg := NewRequestGroup("rejected", []string{server.URL + "/f"}, opt)
+			rg.SetAuthProvider(tt.provider)
+			if code := apperror.Code(rg.Execute(context.Background())); code != apperror.ExitHttpAuth {
+				t.Errorf("exit status = %d, want ExitHttpAuth", code)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("server got %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+var digestParam = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^\s,]+))`)
+
+func TestRequestGroup_DigestAuth(t *testing.T) {
+	data := bytes.Repeat([]byte("digest"), 512*1024)
+	inner := setupRangeServer(t, data)
+	defer inner.Close()
+
+	const realm, user, pass = "files", "alice", "a-secret"
+	h := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	var nonces atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]string{}
+		for _, m := range digestParam.FindAllStringSubmatch(r.Header.Get("Authorization"), -1) {
+			params[m[1]] = m[2] + m[3]
+		}
+		ha1 := h(user + ":" + realm + ":" + pass)
+		ha2 := h(r.Method + ":" + r.URL.RequestURI())
+		want := h(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+		if params["response"] == "" || params["response"] != want || params["uri"] != r.URL.RequestURI() {
+			nonce := fmt.Sprintf("nonce-%d", nonces.Add(1))
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm=%q, qop="auth", nonce=%q`, realm, nonce))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	opt := option.GetDefaultOptions()
+	dir := t.TempDir()
+	opt.Put(option.Dir, dir)
+	opt.Put(option.Out, "digest.bin")
+	opt.Put(option.Split, "4")
+	opt.Put(option.MaxConnPerServer, "4")
+	opt.Put(option.MinSplitSize, "1M")
+	opt.Put(option.MaxTries, "1")
+
+	rg := NewRequestGroup("digest", []string{server.URL + "/f"}, opt)
+	rg.SetAuthProvider(internalhttp.NewDigestAuth(user, pass))
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "digest.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("content mismatch")
+	}
+	if n := nonces.Load(); n != 1 {
+		t.Errorf("%d challenges sent, want only the first request challenged", n)
+	}
+}
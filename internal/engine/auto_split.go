@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+const (
+	// autoSplit is the split option value that tunes the number of connections
+	autoSplit = "auto"
+
+	// autoSplitStart is the number of connections an auto split download starts with
+	autoSplitStart = 2
+
+	// autoSplitGain is the throughput increase new connections must bring to be kept
+	autoSplitGain = 1.1
+
+	// autoSplitHold is the number of intervals to wait before adding
+	// connections again after they brought no gain
+	autoSplitHold = 5
+
+	// defaultSplitTuneInterval is how often throughput is measured in auto mode
+	defaultSplitTuneInterval = 2 * time.Second
+)
+
+// splitTuner chooses the number of connections of a download from its
+// throughput. It adds connections while throughput keeps rising, returns to
+// the previous number when new connections bring no gain and backs off when
+// the server is overloaded.
+type splitTuner struct {
+	mu        sync.Mutex
+	limit     int     // Most connections allowed
+	current   int     // Connections in use
+	base      int     // Connections before the last increase
+	baseSpeed float64 // Throughput with base connections, bytes per second
+	hold      int     // Intervals left before adding connections again
+	throttled bool    // The server pushed back during this interval
+}
+
+func newSplitTuner(limit int) *splitTuner {
+	n := min(autoSplitStart, max(limit, 1))
+	return &splitTuner{limit: max(limit, 1), current: n, base: n}
+}
+
+// size returns the number of connections to use
+func (t *splitTuner) size() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current
+}
+
+// observe takes the throughput of the last interval in bytes per second and
+// returns the number of connections to use next
+func (t *splitTuner) observe(speed float64) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.throttled = false
+	switch {
+	case t.hold > 0:
+		t.hold--
+		t.baseSpeed = speed
+	case t.current > t.base:
+		// Keep the new connections only if they paid off
+		if speed >= t.baseSpeed*autoSplitGain {
+			t.base, t.baseSpeed = t.current, speed
+			t.grow()
+		} else {
+			t.current = t.base
+			t.hold = autoSplitHold
+		}
+	default:
+		t.baseSpeed = speed
+		t.grow()
+	}
+	return t.current
+}
+
+// throttle halves the number of connections after the server answered 429
+// or 503, and lowers the limit below the number that overloaded it. Reports
+// from connections failing at the same time count once.
+func (t *splitTuner) throttle() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.throttled {
+		return t.current
+	}
+	t.throttled = true
+	t.limit = max(t.current-1, 1)
+	t.current = max(t.current/2, 1)
+	t.base = t.current
+	t.hold = 2 * autoSplitHold
+	return t.current
+}
+
+// grow adds half as many connections again, up to the limit
+func (t *splitTuner) grow() {
+	t.current = min(t.current+max(t.current/2, 1), t.limit)
+}
+
+// autoSplitLimit returns the most connections split "auto" may use: the
+// max-split ceiling, and max-connection-per-server for each server
+func (rg *RequestGroup) autoSplitLimit() int {
+	limit, _ := rg.options.GetAsInt(option.MaxSplit)
+	if limit <= 0 {
+		limit, _ = strconv.Atoi(option.DefaultMaxSplit)
+	}
+	if perServer, _ := rg.options.GetAsInt(option.MaxConnPerServer); perServer > 0 {
+		limit = min(limit, perServer*countHosts(rg.currentURIs()))
+	}
+	return limit
+}
+
+// countHosts returns the number of distinct hosts among uris
+func countHosts(uris []string) int {
+	hosts := make(map[string]bool)
+	for _, uri := range uris {
+		if u, err := url.Parse(uri); err == nil {
+			hosts[u.Host] = true
+		}
+	}
+	return max(len(hosts), 1)
+}
+
+// throttled reports that the server answered 429 or 503. In auto mode the
+// number of connections is reduced; it returns whether it was.
+func (rg *RequestGroup) throttled() bool {
+	if rg.tuner == nil || rg.options.Get(option.Split) != autoSplit {
+		return false
+	}
+	rg.workers.resize(rg.tuner.throttle())
+	return true
+}
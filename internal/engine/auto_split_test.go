@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestSplitTuner(t *testing.T) {
+	tuner := newSplitTuner(8)
+	if got := tuner.size(); got != 2 {
+		t.Fatalf("start = %d, want 2", got)
+	}
+
+	// Throughput rises with every connection until 6
+	steps := []struct {
+		speed float64
+		want  int
+	}{
+		{200, 3}, // Measure 2 connections, try 3
+		{300, 4}, // 3 paid off, try 4
+		{400, 6}, // 4 paid off, try 6
+		{600, 8}, // 6 paid off, try 8 (the limit)
+		{610, 6}, // 8 brought nothing, back to 6
+		{600, 6}, // Holding
+	}
+	for i, step := range steps {
+		if got := tuner.observe(step.speed); got != step.want {
+			t.Fatalf("step %d: observe(%v) = %d, want %d", i, step.speed, got, step.want)
+		}
+	}
+
+	// After the hold it tries again
+	for i := 1; i < autoSplitHold; i++ {
+		tuner.observe(600)
+	}
+	if got := tuner.observe(600); got != 8 {
+		t.Errorf("after hold = %d, want 8", got)
+	}
+
+	// 429/503 halves the connections and lowers the limit, once per interval
+	if got := tuner.throttle(); got != 4 {
+		t.Errorf("throttle = %d, want 4", got)
+	}
+	if got := tuner.throttle(); got != 4 {
+		t.Errorf("second throttle in the same interval = %d, want 4", got)
+	}
+	if tuner.limit != 7 {
+		t.Errorf("limit after throttle = %d, want 7", tuner.limit)
+	}
+}
+
+func TestSplitTuner_Limit(t *testing.T) {
+	tuner := newSplitTuner(1)
+	if got := tuner.observe(100); got != 1 {
+		t.Errorf("observe = %d, want 1 with a limit of 1", got)
+	}
+}
+
+func TestAutoSplitLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		uris      []string
+		maxSplit  string
+		perServer string
+		want      int
+	}{
+		{"Ceiling", []string{"http://a/f"}, "16", "0", 16},
+		{"PerServer", []string{"http://a/f"}, "16", "4", 4},
+		{"PerServerTimesHosts", []string{"http://a/f", "http://b/f", "http://a/g"}, "16", "4", 8},
+		{"CeilingBelowServers", []string{"http://a/f", "http://b/f"}, "6", "4", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := option.GetDefaultOptions()
+			opt.Put(option.MaxSplit, tt.maxSplit)
+			opt.Put(option.MaxConnPerServer, tt.perServer)
+			rg := NewRequestGroup("limit-gid", tt.uris, opt)
+			if got := rg.autoSplitLimit(); got != tt.want {
+				t.Errorf("autoSplitLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// slowServer serves data at perConn bytes per second on each connection
+func slowServer(t *testing.T, data []byte, perConn int) *httptest.Server {
+	inner := setupRangeServer(t, data)
+	t.Cleanup(inner.Close)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.Config.Handler.ServeHTTP(&slowWriter{ResponseWriter: w, perConn: perConn}, r)
+	}))
+}
+
+type slowWriter struct {
+	http.ResponseWriter
+	perConn int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	written := 0
+	chunk := w.perConn / 20 // 50ms worth
+	for written < len(p) {
+		n := min(chunk, len(p)-written)
+		if _, err := w.ResponseWriter.Write(p[written : written+n]); err != nil {
+			return written, err
+		}
+		w.ResponseWriter.(http.Flusher).Flush()
+		written += n
+		time.Sleep(50 * time.Millisecond)
+	}
+	return written, nil
+}
+
+func TestAutoSplit_AddsConnections(t *testing.T) {
+	data := make([]byte, 6*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+	server := slowServer(t, data, 512*1024)
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "auto.bin")
+	opt.Put(option.Split, "auto")
+	opt.Put(option.MaxConnPerServer, "6")
+	opt.Put(option.MaxPiecesPerSegment, "1")
+	opt.Put(option.ProgressBatchSize, "16K")
+
+	rg := NewRequestGroup("auto-gid", []string{server.URL}, opt)
+	rg.splitTuneInterval = 300 * time.Millisecond
+
+	var peak atomic.Int32
+	done := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() { done <- rg.Execute(context.Background()) }()
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			rg.stateMu.RLock()
+			workers := rg.workers
+			rg.stateMu.RUnlock()
+			if workers != nil && int32(workers.size()) > peak.Load() {
+				peak.Store(int32(workers.size()))
+			}
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("download did not finish")
+	}
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "auto.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+	if p := peak.Load(); p <= autoSplitStart || p > 6 {
+		t.Errorf("peak connections = %d, want more than %d and at most 6", p, autoSplitStart)
+	}
+}
+
+func TestAutoSplit_BacksOffOnThrottling(t *testing.T) {
+	data := make([]byte, 4*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+	inner := setupRangeServer(t, data)
+	defer inner.Close()
+
+	// At most two downloads at a time, the rest get 429
+	var mu sync.Mutex
+	active, rejected := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-0" {
+			mu.Lock()
+			if active >= 2 {
+				rejected++
+				mu.Unlock()
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			active++
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				active--
+				mu.Unlock()
+			}()
+		}
+		inner.Config.Handler.ServeHTTP(&slowWriter{ResponseWriter: w, perConn: 2 * 1024 * 1024}, r)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "throttled.bin")
+	opt.Put(option.Split, "auto")
+	opt.Put(option.MaxConnPerServer, "8")
+	opt.Put(option.MaxPiecesPerSegment, "1")
+	opt.Put(option.MaxTries, "20")
+
+	rg := NewRequestGroup("throttle-gid", []string{server.URL}, opt)
+	rg.splitTuneInterval = 100 * time.Millisecond
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "throttled.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+	if rejected == 0 {
+		t.Fatal("server never rejected a request")
+	}
+	if rg.tuner.limit >= 8 {
+		t.Errorf("limit = %d after %d rejected requests, want it lowered", rg.tuner.limit, rejected)
+	}
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/divyam234/hydra/internal/retry"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// changeableOptions are the options a download picks up while it runs.
+// Each maps to a check of the new value.
+var changeableOptions = map[string]func(string) error{
+	option.Split:            checkSplit,
+	option.MaxTries:         checkNonNegative,
+	option.RetryWait:        checkWait,
+	option.MaxRetryWait:     checkWait,
+	option.MaxFileNotFound:  checkNonNegative,
+	option.MaxDownloadLimit: checkSpeed,
+	option.LowestSpeedLimit: checkSpeed,
+	option.Header:           checkAny,
+	option.UserAgent:        checkAny,
+	option.Referer:          checkAny,
+	option.HttpUser:         checkAny,
+	option.HttpPasswd:       checkAny,
+}
+
+// ChangeOptions applies changes to a download without restarting it. Only
+// connection counts, speed limits, retry settings, headers and HTTP
+// credentials can be changed; other options are rejected and nothing is
+// applied.
+func (rg *RequestGroup) ChangeOptions(changes *option.Option) error {
+	switch rg.state.Load() {
+	case RGStateComplete, RGStateError, RGStateCancelled:
+		return fmt.Errorf("download %s has finished", rg.gid)
+	}
+
+	values := changes.ToMap()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		check, ok := changeableOptions[key]
+		if !ok {
+			return fmt.Errorf("option %s cannot be changed while downloading", key)
+		}
+		if err := check(values[key]); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+
+	rg.options.Merge(changes)
+
+	rg.stateMu.RLock()
+	limiter, workers := rg.limiter, rg.workers
+	rg.stateMu.RUnlock()
+
+	if _, ok := values[option.MaxDownloadLimit]; ok && limiter != nil {
+		limiter.SetLimit(parseSpeed(values[option.MaxDownloadLimit]))
+	}
+	if split, ok := values[option.Split]; ok && workers != nil {
+		n, _ := strconv.Atoi(split)
+		workers.resize(n)
+	}
+	return nil
+}
+
+// ChangeOptions changes the options of a download by GID while it runs or
+// waits in the queue
+func (e *DownloadEngine) ChangeOptions(gid GID, changes *option.Option) error {
+	rg := e.GetRequestGroup(gid)
+	if rg == nil {
+		return fmt.Errorf("download not found: %s", gid)
+	}
+	return rg.ChangeOptions(changes)
+}
+
+// GetOptions returns a copy of the options of a download by GID, nil if
+// there is no such download
+func (e *DownloadEngine) GetOptions(gid GID) *option.Option {
+	rg := e.GetRequestGroup(gid)
+	if rg == nil {
+		return nil
+	}
+	return rg.options.Clone()
+}
+
+func checkSplit(s string) error {
+	if s == autoSplit {
+		return fmt.Errorf("auto can only be chosen when the download starts")
+	}
+	return checkPositive(s)
+}
+
+func checkPositive(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if n < 1 {
+		return fmt.Errorf("must be at least 1")
+	}
+	return nil
+}
+
+func checkNonNegative(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+func checkWait(s string) error {
+	_, err := retry.ParseWait(s)
+	return err
+}
+
+func checkSpeed(s string) error {
+	if s == "" || s == "0" {
+		return nil
+	}
+	n, err := option.ParseUnitNumber(s)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+func checkAny(string) error { return nil }
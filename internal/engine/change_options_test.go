@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestChangeOptions_WhileDownloading(t *testing.T) {
+	data := make([]byte, 4*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	rangeServer := setupRangeServer(t, data)
+	defer rangeServer.Close()
+
+	var changedHeader atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Changed") == "yes" {
+			changedHeader.Store(true)
+		}
+		rangeServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "changed.bin")
+	opt.Put(option.Split, "1")
+	opt.Put(option.MaxPiecesPerSegment, "1")
+	opt.Put(option.MaxDownloadLimit, "64K") // A minute for 4MB
+	opt.Put(option.ProgressBatchSize, "16K")
+
+	rg := NewRequestGroup("change-gid", []string{server.URL}, opt)
+	done := make(chan error, 1)
+	go func() { done <- rg.Execute(context.Background()) }()
+	waitFor(t, "download to start", func() bool { return rg.completedBytes.Load() > 0 })
+
+	changes := option.NewOption()
+	changes.Put(option.Split, "4")
+	changes.Put(option.MaxDownloadLimit, "0")
+	changes.Put(option.Header, "X-Changed: yes")
+	if err := rg.ChangeOptions(changes); err != nil {
+		t.Fatal(err)
+	}
+	rg.workers.mu.Lock()
+	live := rg.workers.live
+	rg.workers.mu.Unlock()
+	if live < 2 {
+		t.Errorf("%d workers after raising split, want more than 1", live)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("download did not speed up after the limit was lifted")
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "changed.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+	if !changedHeader.Load() {
+		t.Error("changed header was not sent")
+	}
+	if rg.options.Get(option.Split) != "4" {
+		t.Errorf("split = %s, want 4", rg.options.Get(option.Split))
+	}
+}
+
+func TestChangeOptions_Rejected(t *testing.T) {
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Split, "2")
+	rg := NewRequestGroup("reject-gid", []string{"http://example.com/file"}, opt)
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  string
+	}{
+		{"NotChangeable", option.Dir, "/tmp", "cannot be changed"},
+		{"ZeroSplit", option.Split, "0", "invalid value"},
+		{"BadSpeed", option.MaxDownloadLimit, "fast", "invalid value"},
+		{"NegativeTries", option.MaxTries, "-1", "invalid value"},
+		{"AutoSplit", option.Split, "auto", "invalid value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := option.NewOption()
+			changes.Put(option.RetryWait, "3")
+			changes.Put(tt.key, tt.value)
+			err := rg.ChangeOptions(changes)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ChangeOptions(%s=%s) = %v, want error containing %q", tt.key, tt.value, err, tt.want)
+			}
+			// Nothing is applied when one change is rejected
+			if rg.options.Get(option.RetryWait) == "3" {
+				t.Error("valid change applied despite the error")
+			}
+		})
+	}
+
+	rg.state.Store(RGStateComplete)
+	changes := option.NewOption()
+	changes.Put(option.Split, "4")
+	if err := rg.ChangeOptions(changes); err == nil {
+		t.Error("expected an error for a finished download")
+	}
+}
+
+func TestEngine_ChangeOptions_NotFound(t *testing.T) {
+	e := NewDownloadEngine(option.GetDefaultOptions())
+	defer e.Shutdown()
+
+	if err := e.ChangeOptions("missing", option.NewOption()); err == nil {
+		t.Error("expected an error for an unknown download")
+	}
+	if e.GetOptions("missing") != nil {
+		t.Error("expected no options for an unknown download")
+	}
+}
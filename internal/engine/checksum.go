@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/divyam234/hydra/internal/util"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// maxChecksumFileSize bounds checksum files fetched over HTTP
+const maxChecksumFileSize = 16 << 20
+
+// resolveChecksum returns the checksum option as "algo=digest". A value that
+// is not a digest names a checksum file such as SHA256SUMS, given as a local
+// path or an HTTP(S) URL, and the entry for name is taken from it.
+func (rg *RequestGroup) resolveChecksum(ctx context.Context, name string) (string, error) {
+	value := strings.TrimSpace(rg.options.Get(option.Checksum))
+	if value == "" || isChecksumDigest(value) {
+		return value, nil
+	}
+
+	var r io.Reader
+	if strings.Contains(value, "://") {
+		body, err := rg.fetchChecksumFile(ctx, value)
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		r = io.LimitReader(body, maxChecksumFileSize)
+	} else {
+		f, err := os.Open(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to open checksum file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	sumsName := value
+	if u, err := url.Parse(value); err == nil && u.Path != "" {
+		sumsName = u.Path
+	}
+	return util.FindChecksum(r, sumsName, name)
+}
+
+// isChecksumDigest reports whether value is "algo=digest" or a bare hex digest
+func isChecksumDigest(value string) bool {
+	if algo, digest, ok := strings.Cut(value, "="); ok {
+		if _, err := util.NewHash(algo); err == nil {
+			return isHex(digest)
+		}
+		return false
+	}
+	return isHex(value)
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchChecksumFile downloads a checksum file. Credentials and custom headers
+// are only sent if it is on the host of the download.
+func (rg *RequestGroup) fetchChecksumFile(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("unsupported checksum file URL: %s", rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The first mirror, with s3:// URIs resolved to their object URLs
+	primaryURI := rg.uris[0]
+	if uris := rg.mirrors.URIs(); len(uris) > 0 {
+		primaryURI = uris[0]
+	}
+	var resp *http.Response
+	primary, perr := url.Parse(primaryURI)
+	if perr == nil && strings.EqualFold(primary.Host, u.Host) {
+		rg.enrichRequest(req)
+		resp, err = rg.send(rg.httpClient, req)
+	} else {
+		if ua := rg.options.Get(option.UserAgent); ua != "" {
+			req.Header.Set("User-Agent", ua)
+		}
+		resp, err = rg.httpClient.Do(req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checksum file: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch checksum file: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -1,16 +1,26 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/divyam234/hydra/internal/util"
+	"github.com/divyam234/hydra/pkg/apperror"
 	"github.com/divyam234/hydra/pkg/option"
 )
 
@@ -63,10 +73,220 @@ func TestChecksum_Validation(t *testing.T) {
 			} else {
 				if err == nil {
 					t.Error("Expected checksum failure, got success")
-				} else if err.Error() != "checksum failed" {
-					t.Errorf("Unexpected error message: %v", err)
+				} else if !strings.Contains(err.Error(), "checksum failed") || apperror.Code(err) != apperror.ExitChecksum {
+					t.Errorf("Unexpected error: %v", err)
 				}
 			}
 		})
 	}
 }
+
+func TestChecksum_PieceHashes(t *testing.T) {
+	const pieceLen = 256 * 1024
+	data := make([]byte, 4*pieceLen)
+	for i := range data {
+		data[i] = byte(i % 239)
+	}
+	corrupt := bytes.Clone(data)
+	corrupt[pieceLen+100] ^= 0xff
+
+	hashes := make([]string, 4)
+	for i := range hashes {
+		sum := sha1.Sum(data[i*pieceLen : (i+1)*pieceLen])
+		hashes[i] = hex.EncodeToString(sum[:])
+	}
+
+	good := setupRangeServer(t, data)
+	defer good.Close()
+	bad := setupRangeServer(t, corrupt)
+	defer bad.Close()
+
+	// The first request covering piece 1 gets corrupt data
+	var mu sync.Mutex
+	var ranges []string
+	served := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			useBad := !served && start <= pieceLen && end >= 2*pieceLen-1
+			if useBad {
+				served = true
+			}
+			mu.Unlock()
+			if useBad {
+				bad.Config.Handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		good.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "pieces.bin")
+	opt.Put(option.Split, "1")
+	opt.Put(option.PieceHashes, fmt.Sprintf("sha-1:%d:%s", pieceLen, strings.Join(hashes, ",")))
+
+	rg := NewRequestGroup("piece-gid", []string{server.URL + "/f"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "pieces.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("Corrupt piece was not downloaded again")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := fmt.Sprintf("bytes=%d-%d", pieceLen, 2*pieceLen-1)
+	refetched := 0
+	for _, r := range ranges {
+		if r == want {
+			refetched++
+		}
+	}
+	if refetched != 2 || len(ranges) != 5 {
+		t.Errorf("Expected only piece 1 to be requested again (%s), got %v", want, ranges)
+	}
+	if completed := rg.GetFullStatus().Completed; completed != int64(len(data)) {
+		t.Errorf("Completed = %d, want %d", completed, len(data))
+	}
+}
+
+func TestChecksum_PieceHashesExhausted(t *testing.T) {
+	data := make([]byte, 64*1024)
+	server := setupRangeServer(t, data)
+	defer server.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.Out, "bad.bin")
+	opt.Put(option.MaxTries, "2")
+	opt.Put(option.PieceHashes, "sha-1:65536:"+strings.Repeat("0", 40))
+
+	rg := NewRequestGroup("piece-fail-gid", []string{server.URL + "/f"}, opt)
+	err := rg.Execute(context.Background())
+	if err == nil {
+		t.Fatal("Expected error when a piece never verifies")
+	}
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.Code != apperror.ExitChecksum {
+		t.Errorf("Expected checksum error, got %v", err)
+	}
+}
+
+func TestChecksum_File(t *testing.T) {
+	data := bytes.Repeat([]byte("release artifact "), 100000)
+	sha := sha512.Sum512(data)
+	b3, _ := util.NewHash("blake3")
+	b3.Write(data)
+
+	sha512Sums := fmt.Sprintf("%x  app-1.0.tar.gz\n%x  app-1.0.tar.gz.sig\n", sha, sha)
+	b3Sums := fmt.Sprintf("%x  ./app-1.0.tar.gz\n", b3.Sum(nil))
+
+	fileServer := setupRangeServer(t, data)
+	defer fileServer.Close()
+	sumsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/SHA512SUMS" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(sha512Sums))
+	}))
+	defer sumsServer.Close()
+
+	tmpDir := t.TempDir()
+	b3Path := filepath.Join(tmpDir, "B3SUMS")
+	os.WriteFile(b3Path, []byte(b3Sums), 0644)
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"URL", sumsServer.URL + "/SHA512SUMS", false},
+		{"LocalPath", b3Path, false},
+		{"MissingURL", sumsServer.URL + "/SHA1SUMS", true},
+		{"UnreachableURL", "http://127.0.0.1:1/SHA256SUMS", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, t.TempDir())
+			opt.Put(option.Out, "app-1.0.tar.gz")
+			opt.Put(option.Checksum, tt.checksum)
+
+			rg := NewRequestGroup("sums-gid", []string{fileServer.URL + "/app-1.0.tar.gz"}, opt)
+			err := rg.Execute(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			if status := rg.GetFullStatus(); !status.ChecksumVerified || !status.ChecksumOK {
+				t.Error("Expected checksum from the checksum file to be verified")
+			}
+		})
+	}
+}
+
+func TestChecksum_DigestHeaders(t *testing.T) {
+	data := bytes.Repeat([]byte("object data "), 50000)
+	sum := sha256.Sum256(data)
+	reprDigest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	tests := []struct {
+		name     string
+		header   string
+		checksum string
+		wantErr  bool
+		verified bool
+	}{
+		{"Verified", reprDigest, "", false, true},
+		{"Mismatch", "sha-256=:" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ":", "", true, true},
+		// A checksum given by the user takes precedence
+		{"UserChecksum", "sha-256=:" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ":", "sha-256=" + hex.EncodeToString(sum[:]), false, true},
+		{"NoHeader", "", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := setupRangeServer(t, data)
+			defer inner.Close()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "HEAD" && tt.header != "" {
+					w.Header().Set("Repr-Digest", tt.header)
+				}
+				inner.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, t.TempDir())
+			opt.Put(option.Out, "object.bin")
+			opt.Put(option.Checksum, tt.checksum)
+
+			rg := NewRequestGroup("digest-gid", []string{server.URL}, opt)
+			err := rg.Execute(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if status := rg.GetFullStatus(); status.ChecksumVerified != tt.verified {
+				t.Errorf("ChecksumVerified = %v, want %v", status.ChecksumVerified, tt.verified)
+			}
+		})
+	}
+}
@@ -111,3 +111,38 @@ func TestConcurrency_ProgressCounter(t *testing.T) {
 		t.Errorf("Atomic counter mismatch: expected %d, got %d", fileSize, rg.completedBytes.Load())
 	}
 }
+
+func TestConcurrency_OverallLimitFairShares(t *testing.T) {
+	// Two downloads with different split values share one overall limit
+	data := make([]byte, 40*1024*1024)
+	server := setupRangeServer(t, data)
+	defer server.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxOverallDownloadLimit, "8M")
+	opt.Put(option.MaxConnPerServer, "16")
+	opt.Put(option.MinSplitSize, "1K")
+	e := NewDownloadEngine(opt)
+	defer e.Shutdown()
+
+	var groups []*RequestGroup
+	for _, split := range []string{"1", "8"} {
+		dlOpt := opt.Clone()
+		dlOpt.Put(option.Split, split)
+		dlOpt.Put(option.Out, fmt.Sprintf("split-%s.bin", split))
+		gid, err := e.AddURI([]string{server.URL}, dlOpt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer e.Cancel(gid)
+		groups = append(groups, e.GetRequestGroup(gid))
+	}
+	time.Sleep(2 * time.Second)
+
+	// Each gets half of the limit rather than a share per connection
+	one, eight := groups[0].GetFullStatus().Completed, groups[1].GetFullStatus().Completed
+	if ratio := float64(one) / float64(eight); ratio < 0.75 || ratio > 1.33 {
+		t.Errorf("split 1 got %d bytes, split 8 got %d; want about the same", one, eight)
+	}
+}
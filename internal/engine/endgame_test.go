@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestRequestGroup_DuplicateEndgame(t *testing.T) {
+	data := make([]byte, 4*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+	inner := setupRangeServer(t, data)
+	defer inner.Close()
+
+	// The first request for the last range stalls
+	var stalled, stalledDone atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=3145728-4194303" && stalled.CompareAndSwap(false, true) {
+			defer stalledDone.Store(true)
+			inner.Config.Handler.ServeHTTP(&slowWriter{ResponseWriter: w, perConn: 16 * 1024}, r)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "endgame.bin")
+	opt.Put(option.Split, "4")
+	opt.Put(option.MaxConnPerServer, "4")
+	opt.Put(option.MaxPiecesPerSegment, "1")
+	opt.Put(option.EndgameDuplicates, "1")
+
+	rg := NewRequestGroup("endgame-gid", []string{server.URL}, opt)
+
+	start := time.Now()
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	// The stalled range alone would take a minute
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Errorf("download took %v", elapsed)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "endgame.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+	if !stalled.Load() {
+		t.Fatal("the last range was never requested")
+	}
+	if n := rg.completedBytes.Load(); n != int64(len(data)) {
+		t.Errorf("completed bytes = %d, want %d", n, len(data))
+	}
+	waitFor(t, "the stalled request to be cancelled", stalledDone.Load)
+}
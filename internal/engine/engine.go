@@ -6,8 +6,12 @@ import (
 	"net/http"
 	"sort"
 	"sync"
+	"time"
 
 	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/internal/limit"
+	"github.com/divyam234/hydra/internal/retry"
+	"github.com/divyam234/hydra/internal/schedule"
 	"github.com/divyam234/hydra/internal/ui"
 	"github.com/divyam234/hydra/pkg/option"
 )
@@ -50,6 +54,8 @@ type DownloadEngine struct {
 
 	// Shared resources
 	sharedTransport *http.Transport
+	transportErr    error // Why the TLS options left no shared transport
+	overallLimiter  *limit.SharedLimiter
 
 	// Queue management
 	maxConcurrent int             // 0 = unlimited
@@ -63,6 +69,30 @@ type DownloadEngine struct {
 
 	// Event hooks
 	eventCallback EventCallback
+
+	// Replaces the retry policy of every download, if set
+	retryPolicy retry.Policy
+
+	// Authenticates the HTTP requests of every download, if set
+	auth internalhttp.AuthProvider
+
+	// Refreshes expired URLs of every download, if set
+	urlRefresher URLRefresher
+
+	// Health and circuit breakers of the hosts downloaded from
+	hosts *hostHealth
+
+	// Time-of-day schedule
+	scheduleMu       sync.Mutex
+	schedule         *schedule.Schedule
+	scheduleFile     string
+	scheduleModTime  time.Time
+	scheduleErr      string       // Last schedule file error reported
+	schedulePaused   map[GID]bool // Downloads paused by the schedule
+	schedulerOnce    sync.Once
+	scheduleInterval time.Duration
+	overallLimit     int              // Overall limit outside scheduled limits
+	now              func() time.Time // For testing
 }
 
 // EngineOption configures the engine
@@ -92,14 +122,28 @@ func WithEventCallback(cb EventCallback) EngineOption {
 // NewDownloadEngine creates a new DownloadEngine
 func NewDownloadEngine(opt *option.Option, opts ...EngineOption) *DownloadEngine {
 	ctx, cancel := context.WithCancel(context.Background())
+	overallLimit := parseSpeed(opt.Get(option.MaxOverallDownloadLimit))
+	// Downloads that would share a transport the TLS options do not allow
+	// are refused with the error
+	sharedTransport, transportErr := internalhttp.NewTransport(opt)
+	if transportErr != nil {
+		transportErr = tlsError(transportErr)
+	}
 	e := &DownloadEngine{
-		options:         opt,
-		requestGroups:   make(map[GID]*RequestGroup),
-		gidGen:          NewGidGenerator(),
-		ctx:             ctx,
-		cancel:          cancel,
-		pendingQueue:    make([]*RequestGroup, 0),
-		sharedTransport: internalhttp.NewTransport(opt),
+		options:          opt,
+		requestGroups:    make(map[GID]*RequestGroup),
+		gidGen:           NewGidGenerator(),
+		ctx:              ctx,
+		cancel:           cancel,
+		pendingQueue:     make([]*RequestGroup, 0),
+		sharedTransport:  sharedTransport,
+		transportErr:     transportErr,
+		overallLimiter:   limit.NewSharedLimiter(overallLimit),
+		hosts:            newHostHealthFromOptions(opt),
+		overallLimit:     overallLimit,
+		schedulePaused:   make(map[GID]bool),
+		scheduleInterval: defaultScheduleInterval,
+		now:              time.Now,
 	}
 	e.queueCond = sync.NewCond(&e.queueMu)
 
@@ -107,6 +151,10 @@ func NewDownloadEngine(opt *option.Option, opts ...EngineOption) *DownloadEngine
 		o(e)
 	}
 
+	if e.schedule != nil || e.scheduleFile != "" {
+		e.startScheduler()
+	}
+
 	return e
 }
 
@@ -125,19 +173,12 @@ func (e *DownloadEngine) AddURIWithPriority(ctx context.Context, uris []string,
 		return "", err
 	}
 
-	rg := NewRequestGroup(gid, uris, opt)
-	rg.priority = priority
-
-	// Use shared transport
-	rg.SetHTTPTransport(e.sharedTransport)
-
-	// Prioritize custom UI, fall back to engine UI
-	if customUI != nil {
-		rg.SetUI(customUI)
-	} else if e.ui != nil {
-		rg.SetUI(e.ui)
+	rg, err := e.newRequestGroup(gid, uris, opt, customUI)
+	if err != nil {
+		e.mu.Unlock()
+		return "", err
 	}
-
+	rg.priority = priority
 	e.requestGroups[gid] = rg
 	e.mu.Unlock()
 
@@ -163,6 +204,40 @@ func (e *DownloadEngine) AddURIWithPriority(ctx context.Context, uris []string,
 	return gid, nil
 }
 
+// newRequestGroup creates a download that shares the engine's transport,
+// bandwidth limit and host health and uses its hooks. customUI replaces the
+// engine's UI if set.
+func (e *DownloadEngine) newRequestGroup(gid GID, uris []string, opt *option.Option, customUI ui.UserInterface) (*RequestGroup, error) {
+	rg := NewRequestGroup(gid, uris, opt)
+
+	// Downloads with TLS options of their own get their own transport
+	if internalhttp.SameTLSConfig(e.options, opt) {
+		if e.transportErr != nil {
+			return nil, e.transportErr
+		}
+		rg.SetHTTPTransport(e.sharedTransport)
+	}
+	rg.SetSharedLimiter(e.overallLimiter)
+	rg.health = e.hosts
+	if e.retryPolicy != nil {
+		rg.SetRetryPolicy(e.retryPolicy)
+	}
+	if e.auth != nil {
+		rg.SetAuthProvider(e.auth)
+	}
+	if e.urlRefresher != nil {
+		rg.SetURLRefresher(e.urlRefresher)
+	}
+
+	// Prioritize custom UI, fall back to engine UI
+	if customUI != nil {
+		rg.SetUI(customUI)
+	} else if e.ui != nil {
+		rg.SetUI(e.ui)
+	}
+	return rg, nil
+}
+
 // AddURIWithContext adds a new download with a custom context and optional UI
 func (e *DownloadEngine) AddURIWithContext(ctx context.Context, uris []string, opt *option.Option, customUI ui.UserInterface) (GID, error) {
 	return e.AddURIWithPriority(ctx, uris, opt, customUI, 0)
@@ -298,7 +373,8 @@ func (e *DownloadEngine) Shutdown() {
 	}
 }
 
-// Run waits for all downloads to complete and returns any errors encountered
+// Run waits for all downloads to complete and returns any errors encountered.
+// Each failure carries its exit status, see apperror.Code.
 func (e *DownloadEngine) Run() error {
 	e.wg.Wait()
 
@@ -318,12 +394,7 @@ func (e *DownloadEngine) Run() error {
 		if len(errs) == 1 {
 			return errs[0]
 		}
-
-		errMsg := fmt.Sprintf("%d downloads failed:", len(errs))
-		for i, err := range errs {
-			errMsg += fmt.Sprintf("\n%d. %v", i+1, err)
-		}
-		return fmt.Errorf("%s", errMsg)
+		return downloadErrors(errs)
 	}
 
 	return nil
@@ -398,11 +469,12 @@ func (e *DownloadEngine) LoadSession() error {
 
 		// Restore the download
 		e.mu.Lock()
-		rg := NewRequestGroup(entry.GID, entry.URIs, opt)
-		rg.priority = entry.Priority
-		if e.ui != nil {
-			rg.SetUI(e.ui)
+		rg, err := e.newRequestGroup(entry.GID, entry.URIs, opt, nil)
+		if err != nil {
+			e.mu.Unlock()
+			return err
 		}
+		rg.priority = entry.Priority
 		e.requestGroups[entry.GID] = rg
 		e.mu.Unlock()
 
@@ -425,6 +497,34 @@ func (e *DownloadEngine) LoadSession() error {
 	return nil
 }
 
+// SetMaxOverallDownloadLimit changes the bandwidth limit shared by all
+// downloads, in bytes per second (0 for unlimited). Running downloads adapt
+// immediately. A limit set by the schedule takes precedence while it applies.
+func (e *DownloadEngine) SetMaxOverallDownloadLimit(bytesPerSec int) {
+	e.scheduleMu.Lock()
+	e.overallLimit = bytesPerSec
+	e.scheduleMu.Unlock()
+	e.applySchedule()
+}
+
+// GetMaxOverallDownloadLimit returns the bandwidth limit currently shared by
+// all downloads, in bytes per second (0 if unlimited)
+func (e *DownloadEngine) GetMaxOverallDownloadLimit() int {
+	return e.overallLimiter.Limit()
+}
+
+// parseSpeed parses a speed option such as "1M", 0 if unset or invalid
+func parseSpeed(s string) int {
+	if s == "" {
+		return 0
+	}
+	val, err := option.ParseUnitNumber(s)
+	if err != nil {
+		return 0
+	}
+	return int(val)
+}
+
 // GetActiveCount returns the number of active downloads
 func (e *DownloadEngine) GetActiveCount() int {
 	e.queueMu.Lock()
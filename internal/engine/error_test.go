@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/divyam234/hydra/pkg/apperror"
 	"github.com/divyam234/hydra/pkg/option"
 )
 
@@ -19,6 +20,8 @@ func TestError_InvalidURL(t *testing.T) {
 	err := rg.Execute(context.Background())
 	if err == nil {
 		t.Error("Expected error for invalid URL protocol")
+	} else if code := apperror.Code(err); code != apperror.ExitBadUrl {
+		t.Errorf("Expected ExitBadUrl, got %d: %v", code, err)
 	}
 }
 
@@ -28,7 +31,7 @@ func TestError_NoURIs(t *testing.T) {
 	err := rg.Execute(context.Background())
 	if err == nil {
 		t.Error("Expected error for empty URIs")
-	} else if err.Error() != "no URIs provided" {
+	} else if !strings.Contains(err.Error(), "no URIs provided") {
 		t.Errorf("Unexpected error message: %v", err)
 	}
 }
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/divyam234/hydra/internal/ftp"
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/internal/util"
+	"github.com/divyam234/hydra/pkg/apperror"
+)
+
+// errDownloadCancelled is the error of a download cancelled by the user
+var errDownloadCancelled = apperror.New(apperror.ExitUnfinishedDownload, "download cancelled")
+
+// classify wraps err in an *apperror.Error carrying the exit status of the
+// failure. Errors already carrying a status are returned as they are.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	return apperror.Wrap(exitStatus(err), err)
+}
+
+// exitStatus returns the exit status describing err
+func exitStatus(err error) apperror.ExitStatus {
+	var (
+		statusErr  *internalhttp.StatusError
+		rangeErr   *internalhttp.RangeError
+		ftpErr     *ftp.Error
+		dnsErr     *net.DNSError
+		circuitErr *CircuitOpenError
+		linkErr    *os.LinkError
+		pathErr    *os.PathError
+		netErr     net.Error
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return apperror.ExitUnfinishedDownload
+	case errors.Is(err, syscall.ENOSPC):
+		return apperror.ExitNotEnoughSpace
+	case errors.As(err, &statusErr):
+		return httpExitStatus(statusErr.Code)
+	case errors.As(err, &ftpErr):
+		switch {
+		case ftpErr.Code == 550:
+			return apperror.ExitResourceNotFound
+		case ftpErr.Permanent():
+			return apperror.ExitFtpCommand
+		default:
+			return apperror.ExitFtpNetwork
+		}
+	case errors.As(err, &rangeErr), errors.Is(err, internalhttp.ErrRangeIgnored):
+		return apperror.ExitHttpProtocol
+	case errors.As(err, &dnsErr):
+		return apperror.ExitNameResFailed
+	case internalhttp.IsCertificateError(err):
+		return apperror.ExitHttpAuth
+	case errors.As(err, &circuitErr):
+		return apperror.ExitNetworkProblem
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return apperror.ExitTimeout
+	case errors.As(err, &linkErr):
+		return apperror.ExitRenameFile
+	case errors.As(err, &pathErr):
+		switch pathErr.Op {
+		case "mkdir":
+			return apperror.ExitCreateDir
+		case "open":
+			return apperror.ExitCreateFile
+		default:
+			return apperror.ExitIOError
+		}
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return apperror.ExitNetworkProblem
+	default:
+		return apperror.ExitUnknownError
+	}
+}
+
+// httpExitStatus returns the exit status of an unexpected HTTP status code.
+// Server errors and throttling are network problems worth retrying later.
+func httpExitStatus(code int) apperror.ExitStatus {
+	switch {
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return apperror.ExitResourceNotFound
+	case code == http.StatusUnauthorized || code == http.StatusForbidden ||
+		code == http.StatusProxyAuthRequired:
+		return apperror.ExitHttpAuth
+	case code == http.StatusRequestTimeout:
+		return apperror.ExitTimeout
+	case code == http.StatusTooManyRequests || code >= 500:
+		return apperror.ExitNetworkProblem
+	case code >= 300 && code < 400:
+		return apperror.ExitHttpRedirect
+	default:
+		return apperror.ExitHttpProtocol
+	}
+}
+
+// tlsError wraps an error loading the TLS options: files that cannot be
+// read are ExitOpenFile, bad certificates and values ExitOptionParse
+func tlsError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return apperror.Wrap(apperror.ExitOpenFile, err)
+	}
+	return apperror.Wrap(apperror.ExitOptionParse, err)
+}
+
+// checkURI returns an ExitBadUrl error if uri cannot be downloaded
+func checkURI(uri string) error {
+	u, err := util.ParseURI(uri)
+	if err != nil {
+		return apperror.Wrap(apperror.ExitBadUrl, err)
+	}
+	switch u.Protocol {
+	case "http", "https", "ftp", "ftps", "s3":
+		return nil
+	}
+	return apperror.New(apperror.ExitBadUrl, fmt.Sprintf("unsupported protocol %q in %s", u.Protocol, uri))
+}
+
+// downloadErrors is the error of several failed downloads. Its causes can
+// be inspected with errors.Is, errors.As and apperror.Code.
+type downloadErrors []error
+
+func (errs downloadErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d downloads failed:", len(errs))
+	for i, err := range errs {
+		fmt.Fprintf(&b, "\n%d. %v", i+1, err)
+	}
+	return b.String()
+}
+
+func (errs downloadErrors) Unwrap() []error {
+	return errs
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/internal/ftp"
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestClassify(t *testing.T) {
+	status := func(code int) error {
+		return &internalhttp.StatusError{Code: code, Status: fmt.Sprintf("%d %s", code, http.StatusText(code))}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want apperror.ExitStatus
+	}{
+		{"404", status(http.StatusNotFound), apperror.ExitResourceNotFound},
+		{"410", status(http.StatusGone), apperror.ExitResourceNotFound},
+		{"401", status(http.StatusUnauthorized), apperror.ExitHttpAuth},
+		{"403", fmt.Errorf("worker 0 failed segment 1: %w", status(http.StatusForbidden)), apperror.ExitHttpAuth},
+		{"408", status(http.StatusRequestTimeout), apperror.ExitTimeout},
+		{"429", status(http.StatusTooManyRequests), apperror.ExitNetworkProblem},
+		{"503", status(http.StatusServiceUnavailable), apperror.ExitNetworkProblem},
+		{"302", status(http.StatusFound), apperror.ExitHttpRedirect},
+		{"400", status(http.StatusBadRequest), apperror.ExitHttpProtocol},
+		{"range", &internalhttp.RangeError{Reason: "range mismatch"}, apperror.ExitHttpProtocol},
+		{"ftp 550", &ftp.Error{Code: 550, Message: "No such file"}, apperror.ExitResourceNotFound},
+		{"ftp 530", &ftp.Error{Code: 530, Message: "Not logged in"}, apperror.ExitFtpCommand},
+		{"ftp 425", &ftp.Error{Code: 425, Message: "Can't open data connection"}, apperror.ExitFtpNetwork},
+		{"dns", &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}, apperror.ExitNameResFailed},
+		{"timeout", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, apperror.ExitTimeout},
+		{"deadline", context.DeadlineExceeded, apperror.ExitTimeout},
+		{"reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, apperror.ExitNetworkProblem},
+		{"eof", fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), apperror.ExitNetworkProblem},
+		{"unknown authority", &url.Error{Op: "Get", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, apperror.ExitHttpAuth},
+		{"certificate refused", &net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}, apperror.ExitHttpAuth},
+		{"circuit", &CircuitOpenError{Host: "a", Until: time.Now()}, apperror.ExitNetworkProblem},
+		{"disk full", &os.PathError{Op: "write", Path: "f", Err: syscall.ENOSPC}, apperror.ExitNotEnoughSpace},
+		{"mkdir", fmt.Errorf("failed to create directory: %w", &os.PathError{Op: "mkdir", Path: "d", Err: os.ErrPermission}), apperror.ExitCreateDir},
+		{"open", &os.PathError{Op: "open", Path: "f", Err: os.ErrPermission}, apperror.ExitCreateFile},
+		{"rename", &os.LinkError{Op: "rename", Old: "a", New: "b", Err: os.ErrPermission}, apperror.ExitRenameFile},
+		{"canceled", context.Canceled, apperror.ExitUnfinishedDownload},
+		{"coded", apperror.New(apperror.ExitCannotResume, "changed"), apperror.ExitCannotResume},
+		{"unknown", errors.New("something else"), apperror.ExitUnknownError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+			var appErr *apperror.Error
+			if !errors.As(err, &appErr) {
+				t.Fatalf("classify(%v) = %v, not an *apperror.Error", tt.err, err)
+			}
+			if appErr.Code != tt.want {
+				t.Errorf("classify(%v) code = %d, want %d", tt.err, appErr.Code, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("classify(%v) lost the cause", tt.err)
+			}
+		})
+	}
+	if classify(nil) != nil {
+		t.Error("classify(nil) != nil")
+	}
+}
+
+func TestEngine_ExitStatusOfFailures(t *testing.T) {
+	var requests atomic.Int32
+	missing := notFoundServer(t, &requests)
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer denied.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxTries, "1")
+
+	e := NewDownloadEngine(opt)
+	defer e.Shutdown()
+	missingGID, err := e.AddURI([]string{missing.URL + "/missing.bin"}, opt.Clone())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deniedGID, err := e.AddURI([]string{denied.URL + "/denied.bin"}, opt.Clone())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runErr := e.Run()
+	for gid, want := range map[GID]apperror.ExitStatus{
+		missingGID: apperror.ExitResourceNotFound,
+		deniedGID:  apperror.ExitHttpAuth,
+	} {
+		var appErr *apperror.Error
+		status := e.GetRequestGroup(gid).GetFullStatus()
+		if !errors.As(status.Error, &appErr) || appErr.Code != want {
+			t.Errorf("download %s error = %v, want code %d", gid, status.Error, want)
+		}
+		if !errors.Is(runErr, status.Error) {
+			t.Errorf("Run error does not wrap the error of %s: %v", gid, runErr)
+		}
+	}
+	if code := apperror.Code(runErr); code != apperror.ExitResourceNotFound && code != apperror.ExitHttpAuth {
+		t.Errorf("Code(Run error) = %d", code)
+	}
+}
+
+func TestRequestGroup_CancelledIsUnfinished(t *testing.T) {
+	var started atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const size = 1 << 20
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(size))
+			return
+		}
+		var start, end int64
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.(http.Flusher).Flush()
+		started.Store(true)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	rg := NewRequestGroup("cancelled-gid", []string{server.URL + "/f"}, opt)
+	done := make(chan struct{})
+	go func() {
+		rg.Execute(context.Background())
+		close(done)
+	}()
+	waitFor(t, "request", started.Load)
+	rg.Cancel()
+	<-done
+
+	if code := apperror.Code(rg.GetFullStatus().Error); code != apperror.ExitUnfinishedDownload {
+		t.Errorf("cancelled download code = %d, want %d", code, apperror.ExitUnfinishedDownload)
+	}
+}
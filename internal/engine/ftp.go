@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/divyam234/hydra/internal/ftp"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// isFTP reports whether uri uses the ftp or ftps scheme
+func isFTP(uri string) bool {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok {
+		return false
+	}
+	scheme = strings.ToLower(scheme)
+	return scheme == "ftp" || scheme == "ftps"
+}
+
+// getFTPClient returns the FTP client of the request group, creating it on first use
+func (rg *RequestGroup) getFTPClient() *ftp.Client {
+	rg.ftpOnce.Do(func() {
+		cfg := ftp.Config{
+			User:        rg.options.Get(option.FtpUser),
+			Password:    rg.options.Get(option.FtpPasswd),
+			Credentials: rg.netrc.Lookup,
+			TLSConfig:   rg.tlsConfig,
+		}
+		if pasv, err := rg.options.GetAsBool(option.FtpPasv); err == nil {
+			cfg.Active = !pasv
+		}
+		cfg.ExplicitTLS, _ = rg.options.GetAsBool(option.FtpTLS)
+		if t, _ := rg.options.GetAsInt(option.ConnectTimeout); t > 0 {
+			cfg.DialTimeout = time.Duration(t) * time.Second
+		}
+		rg.ftpClient = ftp.NewClient(cfg)
+	})
+	return rg.ftpClient
+}
+
+// probeFTP looks up the size of the file at uri.
+// REST support is assumed, servers without it fail the ranged transfer.
+func (rg *RequestGroup) probeFTP(ctx context.Context, uri string) (*resourceInfo, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	info, err := rg.getFTPClient().Stat(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return &resourceInfo{
+		length:       info.Size,
+		acceptRanges: true,
+		lastModified: info.ModTime,
+	}, nil
+}
+
+// openFTPRange retrieves length bytes from offset, or the rest of the file if length is negative
+func (rg *RequestGroup) openFTPRange(ctx context.Context, uri string, offset, length int64) (io.ReadCloser, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	return rg.getFTPClient().OpenRange(ctx, u, offset, length)
+}
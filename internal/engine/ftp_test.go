@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/divyam234/hydra/internal/ftp/ftptest"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func ftpTestData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 239)
+	}
+	return data
+}
+
+func TestRequestGroup_FTP_Segmented(t *testing.T) {
+	data := ftpTestData(6 * 1024 * 1024)
+	srv := ftptest.NewServer(map[string][]byte{"pub/file.bin": data})
+	defer srv.Close()
+
+	sum := sha256.Sum256(data)
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Split, "4")
+	opt.Put(option.Checksum, "sha-256="+hex.EncodeToString(sum[:]))
+	opt.Put(option.RemoteTime, "true")
+
+	rg := NewRequestGroup("ftp-gid", []string{srv.URL + "/pub/file.bin"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	outPath := filepath.Join(tmpDir, "file.bin")
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("Downloaded data does not match")
+	}
+
+	if srv.CountCommand("RETR") < 2 {
+		t.Errorf("Expected multiple ranged transfers, got %d RETR", srv.CountCommand("RETR"))
+	}
+	if srv.CountCommand("REST") == 0 {
+		t.Error("Expected REST for segments past the start")
+	}
+
+	stat, _ := os.Stat(outPath)
+	if !stat.ModTime().Equal(srv.ModTime) {
+		t.Errorf("Expected mtime %v from MDTM, got %v", srv.ModTime, stat.ModTime())
+	}
+}
+
+func TestRequestGroup_FTP_ActiveMode(t *testing.T) {
+	data := ftpTestData(1024 * 1024)
+	srv := ftptest.NewServer(map[string][]byte{"f.bin": data})
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Split, "2")
+	opt.Put(option.FtpPasv, "false")
+
+	rg := NewRequestGroup("ftp-active-gid", []string{srv.URL + "/f.bin"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "f.bin"))
+	if !bytes.Equal(got, data) {
+		t.Fatal("Downloaded data does not match")
+	}
+	if srv.CountCommand("PORT") == 0 {
+		t.Error("Expected active mode transfers")
+	}
+}
+
+func TestRequestGroup_FTP_Credentials(t *testing.T) {
+	data := ftpTestData(64 * 1024)
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"private.bin": data})
+	srv.User = "user"
+	srv.Password = "pass"
+	srv.Start()
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.MaxTries, "1")
+
+	rg := NewRequestGroup("ftp-anon-gid", []string{srv.URL + "/private.bin"}, opt)
+	if err := rg.Execute(context.Background()); err == nil {
+		t.Fatal("Expected anonymous login to fail")
+	}
+
+	opt.Put(option.FtpUser, "user")
+	opt.Put(option.FtpPasswd, "pass")
+	rg = NewRequestGroup("ftp-auth-gid", []string{srv.URL + "/private.bin"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download with credentials failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "private.bin"))
+	if !bytes.Equal(got, data) {
+		t.Fatal("Downloaded data does not match")
+	}
+}
+
+func TestRequestGroup_FTP_ExplicitTLS(t *testing.T) {
+	data := ftpTestData(2 * 1024 * 1024)
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"secure.bin": data})
+	srv.EnableTLS(false)
+	srv.Start()
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Split, "2")
+	opt.Put(option.FtpTLS, "true")
+	opt.Put(option.CheckCertificate, "false")
+
+	rg := NewRequestGroup("ftp-tls-gid", []string{srv.URL + "/secure.bin"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "secure.bin"))
+	if !bytes.Equal(got, data) {
+		t.Fatal("Downloaded data does not match")
+	}
+	if srv.CountCommand("AUTH") == 0 {
+		t.Error("Expected AUTH TLS")
+	}
+}
+
+func TestRequestGroup_FTP_SingleWithoutSize(t *testing.T) {
+	data := ftpTestData(300 * 1024)
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"nosize.bin": data})
+	srv.DisableSize = true
+	srv.Start()
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+
+	rg := NewRequestGroup("ftp-nosize-gid", []string{srv.URL + "/nosize.bin"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "nosize.bin"))
+	if !bytes.Equal(got, data) {
+		t.Fatal("Downloaded data does not match")
+	}
+}
+
+func TestRequestGroup_FTP_NotFound(t *testing.T) {
+	srv := ftptest.NewServer(map[string][]byte{})
+	defer srv.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+
+	rg := NewRequestGroup("ftp-missing-gid", []string{srv.URL + "/missing.bin"}, opt)
+	if err := rg.Execute(context.Background()); err == nil {
+		t.Fatal("Expected error for missing file")
+	}
+}
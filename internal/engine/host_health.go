@@ -0,0 +1,285 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/internal/retry"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// CircuitState is the state of the circuit breaker of a host
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests at once until the cooldown has passed
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial request through after the cooldown
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// HostStatus is the health of a host as seen by all downloads of an engine
+type HostStatus struct {
+	Host                string
+	State               CircuitState
+	Requests            int64
+	Failures            int64
+	ConsecutiveFailures int
+	LastLatency         time.Duration // Until the response headers arrived
+	LastError           string
+	OpenUntil           time.Time // When an open circuit lets a trial request through
+}
+
+// ErrorRate returns the fraction of requests to the host that failed
+func (s HostStatus) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Requests)
+}
+
+// CircuitOpenError is returned instead of sending a request to a host whose
+// circuit is open
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time // When the host may be tried again
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s until %s", e.Host, e.Until.Format(time.TimeOnly))
+}
+
+// hostHealth tracks the health of each host across downloads. After
+// threshold consecutive failures the circuit of a host opens: requests to
+// it fail at once for the cooldown, then a single trial request decides
+// whether it closes again.
+type hostHealth struct {
+	mu        sync.Mutex
+	hosts     map[string]*hostState
+	threshold int // Consecutive failures opening the circuit, 0 to never open it
+	cooldown  time.Duration
+	now       func() time.Time // For testing
+}
+
+type hostState struct {
+	requests    int64
+	failures    int64
+	consecutive int
+	latency     time.Duration
+	lastErr     string
+	open        bool
+	openUntil   time.Time
+	trial       bool // A trial request of a half-open circuit is in flight
+}
+
+func newHostHealth(threshold int, cooldown time.Duration) *hostHealth {
+	return &hostHealth{
+		hosts:     make(map[string]*hostState),
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// newHostHealthFromOptions creates a hostHealth configured by the
+// circuit-breaker options
+func newHostHealthFromOptions(opt *option.Option) *hostHealth {
+	threshold, _ := opt.GetAsInt(option.CircuitBreakerThreshold)
+	cooldown, err := retry.ParseWait(opt.Get(option.CircuitBreakerCooldown))
+	if err != nil || cooldown <= 0 {
+		cooldown, _ = retry.ParseWait(option.DefaultCircuitBreakerCooldown)
+	}
+	return newHostHealth(threshold, cooldown)
+}
+
+// allow returns a CircuitOpenError if no request may be sent to the host
+// of uri now. Once the cooldown has passed, the first caller is let through
+// as the trial request and must report its outcome.
+func (h *hostHealth) allow(uri string) error {
+	host := hostOf(uri)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.hosts[host]
+	if s == nil || !s.open {
+		return nil
+	}
+	now := h.now()
+	if now.Before(s.openUntil) {
+		return &CircuitOpenError{Host: host, Until: s.openUntil}
+	}
+	if s.trial {
+		return &CircuitOpenError{Host: host, Until: now.Add(h.cooldown)}
+	}
+	s.trial = true
+	return nil
+}
+
+// open reports whether requests to the host of uri are failing at once
+func (h *hostHealth) open(uri string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.hosts[hostOf(uri)]
+	return s != nil && s.open && (h.now().Before(s.openUntil) || s.trial)
+}
+
+// done records the outcome of a request to the host of uri: err is nil once
+// the response headers arrived after latency, or the error opening it.
+// A latency of 0 is not recorded.
+func (h *hostHealth) done(uri string, latency time.Duration, err error) {
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return // Never sent
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.stateNoLock(hostOf(uri))
+	if errors.Is(err, context.Canceled) {
+		// Says nothing about the host
+		s.trial = false
+		return
+	}
+	s.requests++
+	if hostFault(err) {
+		h.failNoLock(s, err)
+		return
+	}
+	// The host answered, even if not with what was asked for
+	s.consecutive = 0
+	s.open, s.trial = false, false
+	if err == nil && latency > 0 {
+		s.latency = latency
+	}
+}
+
+// broke records that a transfer from the host of uri failed with err after
+// its response arrived
+func (h *hostHealth) broke(uri string, err error) {
+	if !hostFault(err) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failNoLock(h.stateNoLock(hostOf(uri)), err)
+}
+
+func (h *hostHealth) failNoLock(s *hostState, err error) {
+	s.failures++
+	s.consecutive++
+	s.lastErr = err.Error()
+	if s.trial || (h.threshold > 0 && s.consecutive >= h.threshold) {
+		s.open, s.trial = true, false
+		s.openUntil = h.now().Add(h.cooldown)
+	}
+}
+
+func (h *hostHealth) stateNoLock(host string) *hostState {
+	s := h.hosts[host]
+	if s == nil {
+		s = &hostState{}
+		h.hosts[host] = s
+	}
+	return s
+}
+
+// status returns the health of every host seen, sorted by host
+func (h *hostHealth) status() []HostStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	statuses := make([]HostStatus, 0, len(h.hosts))
+	for host, s := range h.hosts {
+		st := HostStatus{
+			Host:                host,
+			Requests:            s.requests,
+			Failures:            s.failures,
+			ConsecutiveFailures: s.consecutive,
+			LastLatency:         s.latency,
+			LastError:           s.lastErr,
+		}
+		switch {
+		case !s.open:
+			st.State = CircuitClosed
+		case now.Before(s.openUntil):
+			st.State = CircuitOpen
+			st.OpenUntil = s.openUntil
+		default:
+			st.State = CircuitHalfOpen
+		}
+		statuses = append(statuses, st)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+	return statuses
+}
+
+// hostFault reports whether a request failing with err counts against the
+// health of the host: network and server errors do, while client errors,
+// cancellations and local disk errors do not
+func hostFault(err error) bool {
+	if err == nil || !retry.Retryable(err) {
+		return false
+	}
+	var pathErr *os.PathError
+	var circuitErr *CircuitOpenError
+	return !errors.As(err, &pathErr) && !errors.As(err, &circuitErr) &&
+		!errors.Is(err, errResourceChanged) && !errors.Is(err, internalhttp.ErrRangeIgnored)
+}
+
+// hostOf returns the host (with port) of uri, or uri itself if it does not
+// parse
+func hostOf(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return uri
+}
+
+// HostHealth returns the health of every host the engine's downloads have
+// sent requests to
+func (e *DownloadEngine) HostHealth() []HostStatus {
+	return e.hosts.status()
+}
+
+// healthyMirror returns the next mirror after uri whose host's circuit is
+// not open, or "" if there is none
+func (rg *RequestGroup) healthyMirror(uri string) string {
+	uris := rg.mirrors.URIs()
+	start := 0
+	for i, u := range uris {
+		if u == uri {
+			start = i + 1
+			break
+		}
+	}
+	for i := range uris {
+		if next := uris[(start+i)%len(uris)]; next != uri && !rg.health.open(next) {
+			return next
+		}
+	}
+	return ""
+}
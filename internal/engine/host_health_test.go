@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestHostHealth_Circuit(t *testing.T) {
+	h := newHostHealth(3, time.Minute)
+	now := time.Unix(1000, 0)
+	h.now = func() time.Time { return now }
+
+	const uri = "http://mirror.example:8080/file.iso"
+	serverErr := &internalhttp.StatusError{Code: http.StatusBadGateway, Status: "502 Bad Gateway"}
+
+	// Client errors say nothing about the host's health
+	h.done(uri, 0, &internalhttp.StatusError{Code: http.StatusNotFound, Status: "404 Not Found"})
+	for i := 0; i < 2; i++ {
+		h.done(uri, 0, serverErr)
+	}
+	if err := h.allow(uri); err != nil {
+		t.Fatalf("circuit opened after 2 failures: %v", err)
+	}
+	h.broke(uri, fmt.Errorf("read: %w", errors.New("connection reset")))
+
+	var circuitErr *CircuitOpenError
+	if err := h.allow(uri); !errors.As(err, &circuitErr) || circuitErr.Host != "mirror.example:8080" {
+		t.Fatalf("allow after 3 failures = %v, want an open circuit", err)
+	}
+	if !h.open("http://mirror.example:8080/other") {
+		t.Error("circuit is not shared by the host's other files")
+	}
+	if h.open("http://other.example/file.iso") {
+		t.Error("circuit of an unrelated host is open")
+	}
+
+	st := h.status()
+	if len(st) != 1 || st[0].State != CircuitOpen || st[0].Requests != 3 || st[0].Failures != 3 ||
+		st[0].ConsecutiveFailures != 3 || st[0].LastError == "" {
+		t.Fatalf("status = %+v", st)
+	}
+
+	// After the cooldown a single trial request goes through
+	now = now.Add(time.Minute)
+	if err := h.allow(uri); err != nil {
+		t.Fatalf("trial request refused: %v", err)
+	}
+	if err := h.allow(uri); err == nil {
+		t.Fatal("second request let through during the trial")
+	}
+	if st := h.status(); st[0].State != CircuitHalfOpen {
+		t.Errorf("state during the trial = %v, want half-open", st[0].State)
+	}
+
+	// A failed trial opens the circuit again
+	h.done(uri, 0, serverErr)
+	if err := h.allow(uri); err == nil {
+		t.Fatal("circuit closed after a failed trial")
+	}
+
+	// A successful trial closes it
+	now = now.Add(time.Minute)
+	h.allow(uri)
+	h.done(uri, 20*time.Millisecond, nil)
+	if err := h.allow(uri); err != nil {
+		t.Fatalf("circuit still open after a successful trial: %v", err)
+	}
+	st = h.status()
+	if st[0].State != CircuitClosed || st[0].ConsecutiveFailures != 0 || st[0].LastLatency != 20*time.Millisecond {
+		t.Errorf("status = %+v", st[0])
+	}
+	if rate := st[0].ErrorRate(); rate != 4.0/5 {
+		t.Errorf("error rate = %v, want 4/5", rate)
+	}
+}
+
+func TestHostHealth_Disabled(t *testing.T) {
+	h := newHostHealth(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		h.done("http://a.example/", 0, errors.New("connection refused"))
+	}
+	if err := h.allow("http://a.example/"); err != nil {
+		t.Errorf("circuit opened with the breaker disabled: %v", err)
+	}
+}
+
+func TestEngine_CircuitSharedAcrossDownloads(t *testing.T) {
+	var requests atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxTries, "2")
+	opt.Put(option.CircuitBreakerThreshold, "2")
+	opt.Put(option.CircuitBreakerCooldown, "1m")
+
+	e := NewDownloadEngine(opt)
+	defer e.Shutdown()
+
+	first, _ := e.AddURI([]string{down.URL + "/a.bin"}, opt)
+	e.wg.Wait()
+	if e.GetRequestGroup(first).GetFullStatus().Error == nil {
+		t.Fatal("download from a failing host succeeded")
+	}
+	sent := requests.Load()
+
+	// The next download does not send a single request to the host
+	opt2 := opt.Clone()
+	opt2.Put(option.MaxTries, "1")
+	second, _ := e.AddURI([]string{down.URL + "/b.bin"}, opt2)
+	e.wg.Wait()
+
+	var circuitErr *CircuitOpenError
+	if err := e.GetRequestGroup(second).GetFullStatus().Error; !errors.As(err, &circuitErr) {
+		t.Errorf("second download failed with %v, want an open circuit", err)
+	}
+	if n := requests.Load(); n != sent {
+		t.Errorf("host got %d more requests with its circuit open", n-sent)
+	}
+
+	hosts := e.HostHealth()
+	if len(hosts) != 1 || hosts[0].State != CircuitOpen || hosts[0].Failures != 2 {
+		t.Errorf("HostHealth() = %+v, want one open host with 2 failures", hosts)
+	}
+}
+
+func TestRequestGroup_CircuitRoutesToMirror(t *testing.T) {
+	data := make([]byte, 2*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 229)
+	}
+	good := setupRangeServer(t, data)
+	defer good.Close()
+
+	// The bad mirror answers the probe, then fails every segment request
+	var badGets atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && !strings.HasSuffix(r.Header.Get("Range"), "=0-0") {
+			badGets.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		good.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer bad.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "mirrored.bin")
+	opt.Put(option.Split, "4")
+	opt.Put(option.MaxConnPerServer, "4")
+	opt.Put(option.MaxPiecesPerSegment, "1")
+	opt.Put(option.MaxTries, "2")
+	opt.Put(option.CircuitBreakerThreshold, "2")
+	opt.Put(option.CircuitBreakerCooldown, "1m")
+
+	rg := NewRequestGroup("circuit-gid", []string{bad.URL, good.URL}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "mirrored.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+	// Requests already on their way when the circuit opened may fail too
+	if n := badGets.Load(); n > 4 {
+		t.Errorf("bad mirror got %d segment requests, want at most 4", n)
+	}
+	if !rg.health.open(bad.URL) {
+		t.Error("circuit of the bad mirror is not open")
+	}
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/divyam234/hydra/internal/metalink"
+	"github.com/divyam234/hydra/internal/ui"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// AddMetalink adds one download per file of ml. Each file's mirrors, size and
+// hashes are applied on top of a copy of opt. The output name given in opt is
+// only kept for single-file Metalinks.
+func (e *DownloadEngine) AddMetalink(ctx context.Context, ml *metalink.Metalink, opt *option.Option, customUI ui.UserInterface, priority int) ([]GID, error) {
+	gids := make([]GID, 0, len(ml.Files))
+	for _, f := range ml.Files {
+		gid, err := e.AddURIWithPriority(ctx, f.URLs(), metalinkOptions(f, opt, len(ml.Files) > 1), customUI, priority)
+		if err != nil {
+			return gids, fmt.Errorf("failed to add %s: %w", f.Name, err)
+		}
+		gids = append(gids, gid)
+	}
+	return gids, nil
+}
+
+// metalinkOptions derives the options of a single Metalink file download
+func metalinkOptions(f *metalink.File, opt *option.Option, multiFile bool) *option.Option {
+	fileOpt := opt.Clone()
+
+	if multiFile || fileOpt.Get(option.Out) == "" {
+		fileOpt.Put(option.Out, f.Name)
+	}
+	// A checksum given by the user takes precedence
+	if fileOpt.Get(option.Checksum) == "" {
+		if checksum := f.Checksum(); checksum != "" {
+			fileOpt.Put(option.Checksum, checksum)
+		}
+	}
+	if f.Size > 0 {
+		fileOpt.Put(option.ExpectedSize, strconv.FormatInt(f.Size, 10))
+	}
+	if f.Pieces != nil {
+		fileOpt.Put(option.PieceHashes, fmt.Sprintf("%s:%d:%s",
+			f.Pieces.Type, f.Pieces.Length, strings.Join(f.Pieces.Hashes, ",")))
+	}
+	return fileOpt
+}
+
+// parsePieceHashes parses the piece-hashes option ("algo:pieceLength:h1,h2,...")
+func parsePieceHashes(s string) (algo string, pieceLength int64, hashes []string, err error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return "", 0, nil, fmt.Errorf("invalid piece hashes: expected algo:length:hashes")
+	}
+	pieceLength, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || pieceLength <= 0 {
+		return "", 0, nil, fmt.Errorf("invalid piece length %q", parts[1])
+	}
+	return parts[0], pieceLength, strings.Split(parts[2], ","), nil
+}
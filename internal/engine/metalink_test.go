@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/divyam234/hydra/internal/metalink"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestDownloadEngine_AddMetalink(t *testing.T) {
+	iso := make([]byte, 3*1024*1024)
+	for i := range iso {
+		iso[i] = byte(i % 241)
+	}
+	readme := []byte("read me first\n")
+
+	var isoGets, shortGets atomic.Int32
+	isoMirror := countingServer(t, iso, &isoGets)
+	defer isoMirror.Close()
+	// Serves a truncated copy, must be dropped because of the announced size
+	shortMirror := countingServer(t, iso[:1024*1024], &shortGets)
+	defer shortMirror.Close()
+	readmeServer := setupRangeServer(t, readme)
+	defer readmeServer.Close()
+
+	isoSum := sha256.Sum256(iso)
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="images/distro.iso">
+    <size>%d</size>
+    <hash type="sha-256">%s</hash>
+    <url priority="1">%s/distro.iso</url>
+    <url priority="2">%s/distro.iso</url>
+  </file>
+  <file name="README">
+    <url>%s/README</url>
+  </file>
+</metalink>`, len(iso), hex.EncodeToString(isoSum[:]), shortMirror.URL, isoMirror.URL, readmeServer.URL)
+
+	ml, err := metalink.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Split, "4")
+	opt.Put(option.Out, "ignored.bin")
+
+	e := NewDownloadEngine(opt)
+	defer e.Shutdown()
+
+	gids, err := e.AddMetalink(context.Background(), ml, opt, nil, 0)
+	if err != nil {
+		t.Fatalf("AddMetalink failed: %v", err)
+	}
+	if len(gids) != 2 {
+		t.Fatalf("Expected one download per file, got %d", len(gids))
+	}
+	if err := e.Run(); err != nil {
+		t.Fatalf("Downloads failed: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "images", "distro.iso"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, iso) {
+		t.Error("ISO content mismatch")
+	}
+	got, _ = os.ReadFile(filepath.Join(tmpDir, "README"))
+	if !bytes.Equal(got, readme) {
+		t.Error("README content mismatch")
+	}
+
+	status := e.GetRequestGroup(gids[0]).GetFullStatus()
+	if !status.ChecksumVerified || !status.ChecksumOK {
+		t.Error("Expected the Metalink hash to be verified")
+	}
+	if shortGets.Load() != 0 {
+		t.Errorf("Mirror with the wrong size served %d segments", shortGets.Load())
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "ignored.bin")); err == nil {
+		t.Error("Output name must not be used for multi-file Metalinks")
+	}
+}
+
+func TestMetalinkOptions(t *testing.T) {
+	f := &metalink.File{
+		Name:   "a.bin",
+		Size:   1000,
+		Hashes: []metalink.Hash{{Type: "sha-1", Value: "abc"}},
+		Pieces: &metalink.Pieces{Type: "sha-1", Length: 512, Hashes: []string{"h1", "h2"}},
+	}
+
+	opt := option.GetDefaultOptions()
+	fileOpt := metalinkOptions(f, opt, false)
+	if fileOpt.Get(option.Out) != "a.bin" {
+		t.Errorf("Out = %q", fileOpt.Get(option.Out))
+	}
+	if fileOpt.Get(option.Checksum) != "sha-1=abc" {
+		t.Errorf("Checksum = %q", fileOpt.Get(option.Checksum))
+	}
+	if fileOpt.Get(option.ExpectedSize) != "1000" {
+		t.Errorf("ExpectedSize = %q", fileOpt.Get(option.ExpectedSize))
+	}
+	if fileOpt.Get(option.PieceHashes) != "sha-1:512:h1,h2" {
+		t.Errorf("PieceHashes = %q", fileOpt.Get(option.PieceHashes))
+	}
+	if opt.Get(option.Checksum) != "" {
+		t.Error("Base options must not be modified")
+	}
+
+	// User settings win for single-file Metalinks
+	opt.Put(option.Out, "custom.bin")
+	opt.Put(option.Checksum, "md5=123")
+	fileOpt = metalinkOptions(f, opt, false)
+	if fileOpt.Get(option.Out) != "custom.bin" || fileOpt.Get(option.Checksum) != "md5=123" {
+		t.Errorf("User options overridden: out=%q checksum=%q", fileOpt.Get(option.Out), fileOpt.Get(option.Checksum))
+	}
+}
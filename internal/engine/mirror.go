@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"sync"
+)
+
+// mirrorFailureThreshold is the number of consecutive failures after which a
+// mirror is taken out of rotation, as long as another mirror is still usable
+const mirrorFailureThreshold = 3
+
+// mirror tracks a single source URI of a download
+type mirror struct {
+	uri      string
+	failures int  // Consecutive failures
+	disabled bool // Taken out of rotation
+}
+
+// mirrorPool distributes requests across all URIs of a download and
+// fails over to the next mirror when one returns errors
+type mirrorPool struct {
+	mu      sync.Mutex
+	mirrors []*mirror
+}
+
+// newMirrorPool creates a mirrorPool for the given URIs, keeping their order
+func newMirrorPool(uris []string) *mirrorPool {
+	p := &mirrorPool{
+		mirrors: make([]*mirror, 0, len(uris)),
+	}
+	seen := make(map[string]bool, len(uris))
+	for _, uri := range uris {
+		if uri == "" || seen[uri] {
+			continue
+		}
+		seen[uri] = true
+		p.mirrors = append(p.mirrors, &mirror{uri: uri})
+	}
+	return p
+}
+
+// Pick returns the mirror a worker should start with.
+// Workers are spread round-robin across the enabled mirrors.
+func (p *mirrorPool) Pick(workerID int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	enabled := p.enabledNoLock()
+	if len(enabled) == 0 {
+		return ""
+	}
+	if workerID < 0 {
+		workerID = -workerID
+	}
+	return enabled[workerID%len(enabled)].uri
+}
+
+// Failover records a failure against uri and returns the next mirror to try.
+// If uri is the only usable mirror, it is returned again.
+func (p *mirrorPool) Failover(uri string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idx := p.indexNoLock(uri)
+	if idx == -1 {
+		// Mirror was removed while in use, start over from the first usable one
+		if enabled := p.enabledNoLock(); len(enabled) > 0 {
+			return enabled[0].uri
+		}
+		return uri
+	}
+
+	m := p.mirrors[idx]
+	m.failures++
+	if m.failures >= mirrorFailureThreshold && len(p.enabledNoLock()) > 1 {
+		m.disabled = true
+	}
+
+	// Walk forward from the failed mirror to the next usable one
+	for i := 1; i <= len(p.mirrors); i++ {
+		next := p.mirrors[(idx+i)%len(p.mirrors)]
+		if !next.disabled && next != m {
+			return next.uri
+		}
+	}
+	return uri
+}
+
+// ReportSuccess resets the failure count of uri
+func (p *mirrorPool) ReportSuccess(uri string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if idx := p.indexNoLock(uri); idx != -1 {
+		p.mirrors[idx].failures = 0
+	}
+}
+
+// Remove drops uri from the pool permanently.
+// Returns false if uri was not part of the pool.
+func (p *mirrorPool) Remove(uri string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idx := p.indexNoLock(uri)
+	if idx == -1 {
+		return false
+	}
+	p.mirrors = append(p.mirrors[:idx], p.mirrors[idx+1:]...)
+	return true
+}
+
+// Replace swaps uri for next, e.g. after a signed URL expired. The mirror
+// keeps its place and starts over without failures.
+// Returns false if uri was not part of the pool.
+func (p *mirrorPool) Replace(uri, next string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idx := p.indexNoLock(uri)
+	if idx == -1 {
+		return false
+	}
+	if p.indexNoLock(next) != -1 {
+		// next is a mirror already
+		p.mirrors = append(p.mirrors[:idx], p.mirrors[idx+1:]...)
+		return true
+	}
+	p.mirrors[idx] = &mirror{uri: next}
+	return true
+}
+
+// URIs returns all mirrors still in the pool, including disabled ones
+func (p *mirrorPool) URIs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	uris := make([]string, len(p.mirrors))
+	for i, m := range p.mirrors {
+		uris[i] = m.uri
+	}
+	return uris
+}
+
+// Len returns the number of mirrors in the pool
+func (p *mirrorPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.mirrors)
+}
+
+func (p *mirrorPool) indexNoLock(uri string) int {
+	for i, m := range p.mirrors {
+		if m.uri == uri {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *mirrorPool) enabledNoLock() []*mirror {
+	enabled := make([]*mirror, 0, len(p.mirrors))
+	for _, m := range p.mirrors {
+		if !m.disabled {
+			enabled = append(enabled, m)
+		}
+	}
+	// Never leave the pool without a usable mirror
+	if len(enabled) == 0 {
+		return p.mirrors
+	}
+	return enabled
+}
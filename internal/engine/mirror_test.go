@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestMirrorPool_PickRoundRobin(t *testing.T) {
+	p := newMirrorPool([]string{"http://a/f", "http://b/f", "http://a/f", "http://c/f"})
+
+	if p.Len() != 3 {
+		t.Fatalf("Expected duplicates to be dropped, got %d mirrors", p.Len())
+	}
+
+	expected := []string{"http://a/f", "http://b/f", "http://c/f", "http://a/f"}
+	for i, want := range expected {
+		if got := p.Pick(i); got != want {
+			t.Errorf("Pick(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestMirrorPool_Failover(t *testing.T) {
+	p := newMirrorPool([]string{"http://a/f", "http://b/f"})
+
+	if next := p.Failover("http://a/f"); next != "http://b/f" {
+		t.Errorf("Expected failover to b, got %s", next)
+	}
+	if next := p.Failover("http://b/f"); next != "http://a/f" {
+		t.Errorf("Expected failover to a, got %s", next)
+	}
+
+	// Repeated failures take a mirror out of rotation
+	for i := 0; i < mirrorFailureThreshold; i++ {
+		p.Failover("http://a/f")
+	}
+	for i := 0; i < 4; i++ {
+		if got := p.Pick(i); got != "http://b/f" {
+			t.Errorf("Pick(%d) = %s, expected disabled mirror to be skipped", i, got)
+		}
+	}
+
+	// The last usable mirror is never disabled
+	for i := 0; i < mirrorFailureThreshold*2; i++ {
+		if next := p.Failover("http://b/f"); next != "http://b/f" {
+			t.Errorf("Expected last mirror to be retried, got %s", next)
+		}
+	}
+}
+
+func TestMirrorPool_SuccessResetsFailures(t *testing.T) {
+	p := newMirrorPool([]string{"http://a/f", "http://b/f"})
+
+	for i := 0; i < mirrorFailureThreshold-1; i++ {
+		p.Failover("http://a/f")
+	}
+	p.ReportSuccess("http://a/f")
+	p.Failover("http://a/f")
+
+	if got := p.Pick(0); got != "http://a/f" {
+		t.Errorf("Mirror should still be enabled after success, got %s", got)
+	}
+}
+
+func TestMirrorPool_Remove(t *testing.T) {
+	p := newMirrorPool([]string{"http://a/f", "http://b/f"})
+
+	if !p.Remove("http://a/f") {
+		t.Error("Expected Remove to succeed")
+	}
+	if p.Remove("http://a/f") {
+		t.Error("Expected second Remove to fail")
+	}
+	if next := p.Failover("http://a/f"); next != "http://b/f" {
+		t.Errorf("Failover from removed mirror should return b, got %s", next)
+	}
+}
+
+func TestMirrorPool_Replace(t *testing.T) {
+	p := newMirrorPool([]string{"http://a/f?sig=1", "http://b/f"})
+	p.Failover("http://a/f?sig=1")
+
+	if !p.Replace("http://a/f?sig=1", "http://a/f?sig=2") {
+		t.Fatal("Expected Replace to succeed")
+	}
+	if got := p.URIs(); got[0] != "http://a/f?sig=2" || got[1] != "http://b/f" {
+		t.Errorf("URIs after Replace = %v", got)
+	}
+	if p.Replace("http://a/f?sig=1", "http://a/f?sig=3") {
+		t.Error("Expected Replace of a replaced URI to fail")
+	}
+
+	// Replacing a mirror with another mirror drops it
+	p.Replace("http://a/f?sig=2", "http://b/f")
+	if got := p.URIs(); len(got) != 1 || got[0] != "http://b/f" {
+		t.Errorf("URIs after Replace with a mirror = %v", got)
+	}
+}
+
+// countingServer wraps a range server and counts ranged GET requests
+func countingServer(t *testing.T, data []byte, count *atomic.Int32) *httptest.Server {
+	inner := setupRangeServer(t, data)
+	t.Cleanup(inner.Close)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.Header.Get("Range") != "" {
+			count.Add(1)
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+}
+
+func TestRequestGroup_Mirrors_DistributeSegments(t *testing.T) {
+	data := make([]byte, 8*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	var countA, countB atomic.Int32
+	serverA := countingServer(t, data, &countA)
+	defer serverA.Close()
+	serverB := countingServer(t, data, &countB)
+	defer serverB.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "mirrored.dat")
+	opt.Put(option.Split, "4")
+
+	rg := NewRequestGroup("mirror-gid", []string{serverA.URL + "/f", serverB.URL + "/f"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "mirrored.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("Downloaded data does not match")
+	}
+
+	if countA.Load() == 0 || countB.Load() == 0 {
+		t.Errorf("Expected both mirrors to serve segments, got a=%d b=%d", countA.Load(), countB.Load())
+	}
+}
+
+func TestRequestGroup_Mirrors_FailoverOnError(t *testing.T) {
+	data := make([]byte, 4*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+
+	good := setupRangeServer(t, data)
+	defer good.Close()
+
+	// Answers HEAD like the good mirror but fails every GET
+	var badGets atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			good.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		badGets.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "failover.dat")
+	opt.Put(option.Split, "2")
+	opt.Put(option.MaxTries, "3")
+
+	rg := NewRequestGroup("failover-gid", []string{bad.URL + "/f", good.URL + "/f"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download should succeed via the good mirror: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "failover.dat"))
+	if !bytes.Equal(got, data) {
+		t.Fatal("Downloaded data does not match")
+	}
+	if badGets.Load() == 0 {
+		t.Error("Expected the failing mirror to have been tried")
+	}
+}
+
+func TestRequestGroup_Mirrors_LengthMismatchDropped(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	other := make([]byte, 512*1024)
+
+	var otherGets atomic.Int32
+	good := setupRangeServer(t, data)
+	defer good.Close()
+	mismatched := countingServer(t, other, &otherGets)
+	defer mismatched.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "mismatch.dat")
+	opt.Put(option.Split, "4")
+
+	rg := NewRequestGroup("mismatch-gid", []string{good.URL + "/f", mismatched.URL + "/f"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if otherGets.Load() != 0 {
+		t.Errorf("Mirror with a different length should not serve segments, got %d requests", otherGets.Load())
+	}
+	if rg.mirrors.Len() != 1 {
+		t.Errorf("Expected mismatched mirror to be dropped, %d mirrors left", rg.mirrors.Len())
+	}
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// maxRedirects is the number of redirects followed for one request
+const maxRedirects = 10
+
+// loadNetrc reads the .netrc file of the download unless no-netrc is set.
+// A file given by netrc-path must be usable; problems with the default
+// file are reported and the file is ignored.
+func (rg *RequestGroup) loadNetrc() error {
+	if off, _ := rg.options.GetAsBool(option.NoNetrc); off {
+		return nil
+	}
+	path := rg.options.Get(option.NetrcPath)
+	if path != "" {
+		n, err := internalhttp.LoadNetrc(path)
+		if err != nil {
+			return apperror.Wrap(apperror.ExitOpenFile, err)
+		}
+		rg.netrc = n
+		return nil
+	}
+
+	path = internalhttp.DefaultNetrcPath()
+	if path == "" {
+		return nil
+	}
+	n, err := internalhttp.LoadNetrc(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			rg.console.Printf("Ignoring %s: %v\n", path, err)
+		}
+		return nil
+	}
+	rg.netrc = n
+	return nil
+}
+
+// setNetrcAuth sets the .netrc login for the host of req, unless its URL
+// carries credentials
+func (rg *RequestGroup) setNetrcAuth(req *http.Request) {
+	if req.URL.User != nil {
+		return
+	}
+	if login, password, ok := rg.netrc.Lookup(req.URL.Hostname()); ok {
+		req.SetBasicAuth(login, password)
+	}
+}
+
+// checkRedirect decides whether the HTTP client follows a redirect.
+// Credentials never follow a redirect to another host, not even to a
+// subdomain: once a hop has left the host of the original request, the
+// Authorization header the client copies from it is dropped and the .netrc
+// login of the new host, if there is one, is sent instead. The auth provider
+// or S3 signer, if any, authorizes redirects to the same host again, since
+// Digest and SigV4 credentials depend on the URL.
+func (rg *RequestGroup) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return apperror.New(apperror.ExitHttpRedirect, fmt.Sprintf("stopped after %d redirects", maxRedirects))
+	}
+	left := !strings.EqualFold(req.URL.Host, via[0].URL.Host)
+	for _, hop := range via[1:] {
+		left = left || !strings.EqualFold(hop.URL.Host, via[0].URL.Host)
+	}
+	if left {
+		req.Header.Del("Authorization")
+		rg.setNetrcAuth(req)
+	} else if auth := rg.authFor(req.URL); auth != nil {
+		return auth.Authorize(req)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// authLog records the Authorization headers a server received
+type authLog struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (l *authLog) add(r *http.Request) {
+	l.mu.Lock()
+	l.seen = append(l.seen, r.Header.Get("Authorization"))
+	l.mu.Unlock()
+}
+
+func (l *authLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.seen...)
+}
+
+// authServer serves data to requests logging in as user, answering 401 to
+// all others
+func authServer(t *testing.T, data []byte, user, pass string, log *authLog) *httptest.Server {
+	inner := setupRangeServer(t, data)
+	t.Cleanup(inner.Close)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != pass {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// onLocalhost returns the URL of server with the host name localhost, so
+// that it counts as another host than 127.0.0.1
+func onLocalhost(server *httptest.Server) string {
+	return strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+}
+
+func writeNetrc(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func basicAuth(user, pass string) string {
+	req, _ := http.NewRequest(http.MethodGet, "http://x", nil)
+	req.SetBasicAuth(user, pass)
+	return req.Header.Get("Authorization")
+}
+
+func TestRequestGroup_NetrcPerMirror(t *testing.T) {
+	data := bytes.Repeat([]byte("netrc"), 300*1024)
+	var logA, logB authLog
+	serverA := authServer(t, data, "alice", "a-secret", &logA)
+	serverB := authServer(t, data, "bob", "b-secret", &logB)
+
+	opt := option.GetDefaultOptions()
+	dir := t.TempDir()
+	opt.Put(option.Dir, dir)
+	opt.Put(option.Out, "mirrored.bin")
+	opt.Put(option.Split, "4")
+	opt.Put(option.MaxConnPerServer, "2")
+	opt.Put(option.NetrcPath, writeNetrc(t,
+		"machine 127.0.0.1 login alice password a-secret\nmachine localhost login bob password b-secret\n"))
+
+	rg := NewRequestGroup("netrc-mirrors", []string{serverA.URL + "/f", onLocalhost(serverB) + "/f"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "mirrored.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("content mismatch")
+	}
+
+	for name, check := range map[string]struct {
+		log  *authLog
+		want string
+	}{
+		"127.0.0.1": {&logA, basicAuth("alice", "a-secret")},
+		"localhost": {&logB, basicAuth("bob", "b-secret")},
+	} {
+		seen := check.log.get()
+		if len(seen) == 0 {
+			t.Errorf("%s got no requests", name)
+		}
+		for _, auth := range seen {
+			if auth != check.want {
+				t.Errorf("%s got Authorization %q, want its own login", name, auth)
+			}
+		}
+	}
+}
+
+func TestRequestGroup_NetrcNotLeakedOnRedirect(t *testing.T) {
+	data := bytes.Repeat([]byte("r"), 64*1024)
+	tests := []struct {
+		name     string
+		netrc    string
+		httpUser string
+		want     string // Authorization seen by the redirect target
+	}{
+		{
+			name:  "netrc login stays on its host",
+			netrc: "machine 127.0.0.1 login alice password a-secret\n",
+		},
+		{
+			name:     "explicit login stays on its host",
+			netrc:    "",
+			httpUser: "alice",
+		},
+		{
+			name:  "target gets its own netrc login",
+			netrc: "machine 127.0.0.1 login alice password a-secret\nmachine localhost login bob password b-secret\n",
+			want:  basicAuth("bob", "b-secret"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var targetLog authLog
+			target := setupRangeServer(t, data)
+			defer target.Close()
+			logged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				targetLog.add(r)
+				target.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer logged.Close()
+
+			origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if u, _, ok := r.BasicAuth(); !ok || u != "alice" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				http.Redirect(w, r, onLocalhost(logged)+"/f", http.StatusFound)
+			}))
+			defer origin.Close()
+
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, t.TempDir())
+			opt.Put(option.Out, "redirected.bin")
+			opt.Put(option.NetrcPath, writeNetrc(t, tt.netrc))
+			if tt.httpUser != "" {
+				opt.Put(option.HttpUser, tt.httpUser)
+				opt.Put(option.HttpPasswd, "a-secret")
+			}
+
+			rg := NewRequestGroup("netrc-redirect", []string{origin.URL + "/f"}, opt)
+			if err := rg.Execute(context.Background()); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			seen := targetLog.get()
+			if len(seen) == 0 {
+				t.Fatal("redirect target got no requests")
+			}
+			for _, auth := range seen {
+				if auth != tt.want {
+					t.Errorf("redirect target got Authorization %q, want %q", auth, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestGroup_NoNetrc(t *testing.T) {
+	var log authLog
+	server := authServer(t, []byte("secret data"), "alice", "a-secret", &log)
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxTries, "1")
+	opt.Put(option.NetrcPath, writeNetrc(t, "machine 127.0.0.1 login alice password a-secret\n"))
+	opt.Put(option.NoNetrc, "true")
+
+	rg := NewRequestGroup("no-netrc", []string{server.URL + "/f"}, opt)
+	if code := apperror.Code(rg.Execute(context.Background())); code != apperror.ExitHttpAuth {
+		t.Errorf("exit status = %d, want ExitHttpAuth", code)
+	}
+	for _, auth := range log.get() {
+		if auth != "" {
+			t.Errorf("Authorization %q sent with no-netrc", auth)
+		}
+	}
+}
+
+func TestRequestGroup_NetrcPathMissing(t *testing.T) {
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.NetrcPath, filepath.Join(t.TempDir(), "missing"))
+
+	rg := NewRequestGroup("netrc-missing", []string{"http://127.0.0.1:1/f"}, opt)
+	if code := apperror.Code(rg.Execute(context.Background())); code != apperror.ExitOpenFile {
+		t.Errorf("exit status = %d, want ExitOpenFile", code)
+	}
+}
+
+func TestCheckRedirect_Subdomain(t *testing.T) {
+	rg := NewRequestGroup("redirect-gid", []string{"https://example.com/f"}, option.GetDefaultOptions())
+	first, _ := http.NewRequest(http.MethodGet, "https://example.com/f", nil)
+	first.SetBasicAuth("alice", "a-secret")
+
+	// The HTTP client keeps Authorization on redirects to subdomains
+	next, _ := http.NewRequest(http.MethodGet, "https://cdn.example.com/f", nil)
+	next.Header.Set("Authorization", first.Header.Get("Authorization"))
+	if err := rg.checkRedirect(next, []*http.Request{first}); err != nil {
+		t.Fatal(err)
+	}
+	if auth := next.Header.Get("Authorization"); auth != "" {
+		t.Errorf("Authorization %q follows the redirect to a subdomain", auth)
+	}
+
+	same, _ := http.NewRequest(http.MethodGet, "https://example.com/g", nil)
+	same.Header.Set("Authorization", first.Header.Get("Authorization"))
+	if err := rg.checkRedirect(same, []*http.Request{first}); err != nil {
+		t.Fatal(err)
+	}
+	if same.Header.Get("Authorization") == "" {
+		t.Error("Authorization dropped on a redirect to the same host")
+	}
+
+	via := make([]*http.Request, maxRedirects)
+	for i := range via {
+		via[i] = first
+	}
+	if code := apperror.Code(rg.checkRedirect(same, via)); code != apperror.ExitHttpRedirect {
+		t.Errorf("too many redirects: exit status = %d, want ExitHttpRedirect", code)
+	}
+}
+
+// Go's client copies Authorization to every hop on the original host or a
+// subdomain of it, not just to the next one
+func TestRequestGroup_RedirectChainToSubdomain(t *testing.T) {
+	data := bytes.Repeat([]byte("chain"), 1000)
+	target := setupRangeServer(t, data)
+	defer target.Close()
+	var subLog authLog
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, port, _ := net.SplitHostPort(r.Host)
+		switch {
+		case strings.HasPrefix(r.Host, "localhost:"):
+			http.Redirect(w, r, "http://sub.localhost:"+port+"/a", http.StatusFound)
+		case r.URL.Path == "/a":
+			subLog.add(r)
+			http.Redirect(w, r, "http://sub.localhost:"+port+"/b", http.StatusFound)
+		default:
+			subLog.add(r)
+			target.Config.Handler.ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.Out, "chain.bin")
+	opt.Put(option.NoNetrc, "true")
+	opt.Put(option.HttpUser, "alice")
+	opt.Put(option.HttpPasswd, "a-secret")
+
+	// Every host name leads to the test server
+	transport, err := internalhttp.NewTransport(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	rg := NewRequestGroup("redirect-chain", []string{onLocalhost(server) + "/f"}, opt)
+	rg.SetHTTPTransport(transport)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	seen := subLog.get()
+	if len(seen) < 2 {
+		t.Fatalf("subdomain got %d requests, want both hops", len(seen))
+	}
+	for _, auth := range seen {
+		if auth != "" {
+			t.Errorf("subdomain got Authorization %q", auth)
+		}
+	}
+}
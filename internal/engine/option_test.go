@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/divyam234/hydra/pkg/apperror"
 	"github.com/divyam234/hydra/pkg/option"
 )
 
@@ -105,6 +107,10 @@ func TestOption_LowestSpeedLimit(t *testing.T) {
 			return
 		}
 
+		var start, end int64
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/1000", start, end))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", end-start+1))
 		w.WriteHeader(http.StatusPartialContent)
 		if f, ok := w.(http.Flusher); ok {
 			f.Flush()
@@ -136,7 +142,7 @@ func TestOption_LowestSpeedLimit(t *testing.T) {
 	err := rg.Execute(context.Background())
 	if err == nil {
 		t.Error("Expected error due to low speed")
-	} else if !strings.Contains(err.Error(), "lowest limit") {
+	} else if !strings.Contains(err.Error(), "lowest limit") || apperror.Code(err) != apperror.ExitTooSlowSpeed {
 		t.Errorf("Unexpected error: %v", err)
 	}
 }
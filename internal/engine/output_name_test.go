@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestOutputName(t *testing.T) {
+	data := []byte("release contents")
+
+	mux := http.NewServeMux()
+	serve := func(disposition string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if disposition != "" {
+				w.Header().Set("Content-Disposition", disposition)
+			}
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}
+	}
+	mux.HandleFunc("/files/app-1.2.tar.gz", serve(""))
+	mux.HandleFunc("/download", http.RedirectHandler("/files/app-1.2.tar.gz", http.StatusFound).ServeHTTP)
+	mux.HandleFunc("/export", serve(`attachment; filename="export.csv"; filename*=UTF-8''%E2%82%AC%20export.csv`))
+	mux.HandleFunc("/evil", serve(`attachment; filename="../../evil.sh"`))
+	mux.HandleFunc("/unsafe", serve(`attachment; filename="a:b?.txt"`))
+	mux.HandleFunc("/", serve(""))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		path string
+		out  string
+		want string
+	}{
+		{"OutWins", "/export", "mine.csv", "mine.csv"},
+		{"ContentDisposition", "/export", "", "€ export.csv"},
+		{"FinalRedirectURL", "/download", "", "app-1.2.tar.gz"},
+		{"TraversalRejected", "/evil", "", "evil"},
+		{"Sanitized", "/unsafe", "", "a_b_.txt"},
+		{"NoName", "/", "", "index.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, tmpDir)
+			if tt.out != "" {
+				opt.Put(option.Out, tt.out)
+			}
+
+			rg := NewRequestGroup("name-gid", []string{server.URL + tt.path}, opt)
+			if err := rg.Execute(context.Background()); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			want := filepath.Join(tmpDir, tt.want)
+			if rg.outputPath != want {
+				t.Errorf("output path = %q, want %q", rg.outputPath, want)
+			}
+			content, err := os.ReadFile(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, data) {
+				t.Error("content mismatch")
+			}
+			entries, _ := os.ReadDir(tmpDir)
+			if len(entries) != 1 {
+				t.Errorf("expected only the downloaded file, got %d entries", len(entries))
+			}
+		})
+	}
+}
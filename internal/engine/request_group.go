@@ -2,11 +2,16 @@ package engine
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,12 +19,16 @@ import (
 
 	"github.com/divyam234/hydra/internal/control"
 	"github.com/divyam234/hydra/internal/disk"
+	"github.com/divyam234/hydra/internal/ftp"
 	internalhttp "github.com/divyam234/hydra/internal/http"
 	"github.com/divyam234/hydra/internal/limit"
+	"github.com/divyam234/hydra/internal/retry"
+	"github.com/divyam234/hydra/internal/s3"
 	"github.com/divyam234/hydra/internal/segment"
 	"github.com/divyam234/hydra/internal/stats"
 	"github.com/divyam234/hydra/internal/ui"
 	"github.com/divyam234/hydra/internal/util"
+	"github.com/divyam234/hydra/pkg/apperror"
 	"github.com/divyam234/hydra/pkg/option"
 )
 
@@ -27,6 +36,7 @@ import (
 type RequestGroup struct {
 	gid                GID
 	uris               []string
+	mirrors            *mirrorPool
 	options            *option.Option
 	diskAdaptor        disk.DiskAdaptor
 	segmentMan         *segment.SegmentMan
@@ -34,14 +44,31 @@ type RequestGroup struct {
 	controller         *control.Controller
 	httpClient         *http.Client
 	httpTransport      *http.Transport
+	tlsConfig          *tls.Config // Of the HTTP transport, also used for FTPS
+	ftpClient          *ftp.Client
+	ftpOnce            sync.Once
+	netrc              *internalhttp.Netrc       // Credentials by host, nil without a .netrc file
+	auth               internalhttp.AuthProvider // Authenticates HTTP requests, if set
+	s3                 *s3.Endpoint              // Store of the s3:// URIs, nil without any
+	urlRefresher       URLRefresher              // Replaces url-refresh-command, if set
+	refreshMu          sync.Mutex                // Serializes URL refreshes
+	refreshed          map[string]string         // Expired URLs and the URLs replacing them
 	limiter            *limit.BandwidthLimiter
+	sharedLimiter      *limit.SharedLimiter // Engine-wide limit, if any
 	speedCalc          *stats.SpeedCalc
 	console            ui.UserInterface
 	totalLength        int64
 	completedBytes     atomic.Int64
 	outputPath         string
-	workers            int
+	workers            *workerPool   // Running workers, nil before they start
+	tuner              *splitTuner   // Chooses the number of workers with split "auto"
+	conns              *connMonitor  // Throughput of each worker's connection
+	retry              retry.Policy  // Replaces the policy built from the options, if set
+	notFound           atomic.Int64  // "File not found" answers received
+	health             *hostHealth   // Shared by the engine's downloads
 	speedCheckInterval time.Duration // For testing
+	splitTuneInterval  time.Duration // For testing
+	slowCheckInterval  time.Duration // For testing
 
 	// State tracking
 	startTime        time.Time
@@ -50,7 +77,14 @@ type RequestGroup struct {
 	lastError        error
 	checksumOK       bool
 	checksumVerified bool
-	stateMu          sync.RWMutex // protects lastError, checksumOK, checksumVerified
+	lastModified     time.Time
+	etag             string
+	validatorURI     string      // URI the ETag and Last-Modified belong to
+	pieceFailures    map[int]int // Hash verification failures by piece index
+	checksum         string      // Resolved checksum option, "algo=digest"
+	streamHasher     *util.StreamHasher
+	hashNotify       chan struct{}
+	stateMu          sync.RWMutex // protects lastError, checksumOK, checksumVerified, pieceFailures, validators
 
 	// Pause/Resume/Cancel control
 	pauseCh    chan struct{}
@@ -70,6 +104,10 @@ func NewRequestGroup(gid GID, uris []string, opt *option.Option) *RequestGroup {
 		options:            opt,
 		diskAdaptor:        disk.NewBufferedDiskAdaptor(opt.Get(option.FileAllocation)),
 		speedCheckInterval: 30 * time.Second,
+		splitTuneInterval:  defaultSplitTuneInterval,
+		slowCheckInterval:  defaultSlowCheckInterval,
+		conns:              newConnMonitor(),
+		health:             newHostHealthFromOptions(opt),
 		pauseCh:            make(chan struct{}),
 		resumeCh:           make(chan struct{}),
 		cancelCh:           make(chan struct{}),
@@ -144,6 +182,29 @@ func (rg *RequestGroup) SetHTTPTransport(t *http.Transport) {
 	rg.httpTransport = t
 }
 
+// SetRetryPolicy replaces the retry policy built from the retry-wait,
+// max-retry-wait and max-file-not-found options
+func (rg *RequestGroup) SetRetryPolicy(p retry.Policy) {
+	rg.retry = p
+}
+
+// SetAuthProvider authenticates the HTTP requests of the download with p,
+// in place of the http-user and .netrc logins
+func (rg *RequestGroup) SetAuthProvider(p internalhttp.AuthProvider) {
+	rg.auth = p
+}
+
+// SetURLRefresher refreshes expired URLs of the download with f instead of
+// its url-refresh-command
+func (rg *RequestGroup) SetURLRefresher(f URLRefresher) {
+	rg.urlRefresher = f
+}
+
+// SetSharedLimiter makes the download draw its bandwidth from an engine-wide limit
+func (rg *RequestGroup) SetSharedLimiter(l *limit.SharedLimiter) {
+	rg.sharedLimiter = l
+}
+
 // Cleanup releases resources held by the request group
 func (rg *RequestGroup) Cleanup() {
 	// If we have a dedicated transport (not shared), close idle connections
@@ -165,12 +226,13 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 		currentState := rg.state.Load()
 		// Don't override cancelled state
 		if currentState == RGStateCancelled {
-			rg.lastError = fmt.Errorf("download cancelled")
+			rg.lastError = errDownloadCancelled
 			// Mark cancelled in rich UI
 			if tracker, ok := rg.console.(ui.DownloadTracker); ok {
 				tracker.MarkFailed(string(rg.gid), rg.lastError)
 			}
 		} else if err != nil {
+			err = classify(err)
 			rg.state.Store(RGStateError)
 			rg.lastError = err
 			// Mark failed in rich UI
@@ -187,34 +249,22 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 		return fmt.Errorf("no URIs provided")
 	}
 
-	uriStr := rg.uris[0]
-	u, err := util.ParseURI(uriStr)
-	if err != nil {
+	rg.mirrors = newMirrorPool(rg.uris)
+	defer rg.closeFTP()
+	uriStr := rg.mirrors.Pick(0)
+	if err := checkURI(uriStr); err != nil {
 		return err
 	}
 
-	// 1. Resolve Output Path
-	out := rg.options.Get(option.Out)
-	if out == "" {
-		out = filepath.Base(u.Path)
-		if out == "" || out == "/" || out == "." {
-			out = "index.html"
-		}
-	}
-	dir := rg.options.Get(option.Dir)
-	if dir != "" {
-		out = filepath.Join(dir, out)
-	}
-	rg.outputPath = out
-
 	// Initialize Rate Limiter
-	maxSpeed := 0
-	if optStr := rg.options.Get(option.MaxDownloadLimit); optStr != "" {
-		if val, err := option.ParseUnitNumber(optStr); err == nil {
-			maxSpeed = int(val)
-		}
+	maxSpeed := parseSpeed(rg.options.Get(option.MaxDownloadLimit))
+	rg.stateMu.Lock()
+	if rg.sharedLimiter != nil {
+		rg.limiter = rg.sharedLimiter.Join(maxSpeed)
+	} else {
+		rg.limiter = limit.NewBandwidthLimiter(maxSpeed)
 	}
-	rg.limiter = limit.NewBandwidthLimiter(maxSpeed)
+	rg.stateMu.Unlock()
 
 	// Initialize Stats
 	rg.speedCalc = stats.NewSpeedCalc()
@@ -235,36 +285,119 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 		rg.console = ui.NewConsole(quiet, logWriter)
 	}
 
+	// Initialize HTTP Client
+	transport := rg.httpTransport
+	if transport == nil {
+		if transport, err = internalhttp.NewTransport(rg.options); err != nil {
+			return tlsError(err)
+		}
+	}
+	rg.tlsConfig = transport.TLSClientConfig
+	rg.httpClient = internalhttp.NewClientWithTransport(transport, rg.options)
+	rg.httpClient.CheckRedirect = rg.checkRedirect
+	if err := rg.loadNetrc(); err != nil {
+		return err
+	}
+	if err := rg.resolveS3(); err != nil {
+		return err
+	}
+	uriStr = rg.mirrors.Pick(0)
+
+	// 1. Resolve Output Path. Without --out the name comes from the server,
+	// so the file has to be probed first.
+	var info *resourceInfo
+	var probeErr error
+	out := rg.options.Get(option.Out)
+	if out == "" {
+		var infoURI string
+		info, infoURI, probeErr = rg.fetchHeaders(ctx)
+		if probeErr == nil {
+			uriStr = infoURI
+		}
+		out = outputName(info, uriStr)
+	}
+	dir := rg.options.Get(option.Dir)
+	if dir != "" {
+		out = filepath.Join(dir, out)
+	}
+	rg.outputPath = out
+
+	// Metalink file names may contain subdirectories
+	if err := os.MkdirAll(filepath.Dir(rg.outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
 	// 2. Initialize Controller and check for resume
 	rg.controller = control.NewController(rg.outputPath)
 
-	// Initialize HTTP Client
-	if rg.httpTransport != nil {
-		rg.httpClient = internalhttp.NewClientWithTransport(rg.httpTransport, rg.options)
-	} else {
-		rg.httpClient = internalhttp.NewClient(rg.options)
+	// The checksum may have to be looked up in a checksum file
+	if rg.checksum, err = rg.resolveChecksum(ctx, filepath.Base(rg.outputPath)); err != nil {
+		return err
 	}
 
-	var resumed bool
+	var resumed, restarted bool
 	var loadedCF *control.ControlFile
 
 	if rg.controller.Exists() {
 		// fmt.Printf("Found control file, attempting to resume...\n")
 		loadedCF, err = rg.controller.Load()
 		if err == nil {
-			// Basic validation
-			if loadedCF.TotalLength > 0 {
+			// Basic validation, the progress is meaningless without the file
+			_, statErr := os.Stat(rg.outputPath)
+			if loadedCF.TotalLength > 0 && statErr == nil {
 				resumed = true
-				rg.totalLength = loadedCF.TotalLength
-				// fmt.Printf("Resuming download of %s (Size: %d)\n", out, rg.totalLength)
+			}
+		} else {
+			// fmt.Printf("Failed to load control file: %v. Starting fresh.\n", err)
+		}
+	}
 
-				// Register resumed download with rich UI
-				if tracker, ok := rg.console.(ui.DownloadTracker); ok {
-					tracker.RegisterDownload(string(rg.gid), filepath.Base(rg.outputPath), rg.totalLength)
+	if resumed {
+		// The remote file must not have changed since the control file was
+		// written. Without an answer, If-Range still guards every request.
+		if info == nil && probeErr == nil {
+			var infoURI string
+			info, infoURI, probeErr = rg.fetchHeaders(ctx)
+			if probeErr == nil {
+				uriStr = infoURI
+			}
+		}
+		if probeErr == nil {
+			if reason := resourceChanged(loadedCF, info); reason != "" {
+				if alwaysResume, _ := rg.options.GetAsBool(option.AlwaysResume); alwaysResume {
+					return apperror.New(apperror.ExitCannotResume, "cannot resume: remote file changed ("+reason+")")
 				}
+				rg.console.Printf("Remote file changed (%s), restarting download\n", reason)
+				resumed, restarted = false, true
+			} else {
+				rg.setValidators(uriStr, info.etag, info.lastModified)
 			}
 		} else {
-			// fmt.Printf("Failed to load control file: %v. Starting fresh.\n", err)
+			info = nil
+			lastModified, _ := http.ParseTime(loadedCF.LastModified)
+			if len(rg.uris) == 1 {
+				rg.setValidators(uriStr, loadedCF.ETag, lastModified)
+			}
+		}
+	}
+
+	if resumed {
+		rg.totalLength = loadedCF.TotalLength
+		if rg.checksum == "" {
+			rg.checksum = loadedCF.Checksum
+		}
+		// fmt.Printf("Resuming download of %s (Size: %d)\n", out, rg.totalLength)
+
+		// Register resumed download with rich UI
+		if tracker, ok := rg.console.(ui.DownloadTracker); ok {
+			tracker.RegisterDownload(string(rg.gid), filepath.Base(rg.outputPath), rg.totalLength)
+		}
+	}
+
+	if restarted {
+		// Stale data of the old version must not survive in the new file
+		if err := os.Remove(rg.outputPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove outdated file: %w", err)
 		}
 	}
 
@@ -291,40 +424,43 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 			tracker.RegisterDownload(string(rg.gid), filepath.Base(out), 0)
 		}
 
-		// Get File Size (HEAD Request)
-		headReq, err := http.NewRequestWithContext(ctx, "HEAD", uriStr, nil)
-		if err != nil {
-			return err
+		// Get File Size (HEAD Request or FTP SIZE), trying each mirror in turn
+		if probeErr != nil {
+			return probeErr
 		}
-
-		rg.enrichRequest(headReq)
-
-		headResp, err := rg.httpClient.Do(headReq)
-		if err != nil {
-			return fmt.Errorf("failed to fetch headers: %w", err)
+		if info == nil {
+			var infoURI string
+			info, infoURI, err = rg.fetchHeaders(ctx)
+			if err != nil {
+				return err
+			}
+			uriStr = infoURI
 		}
-		headResp.Body.Close()
+		rg.setValidators(uriStr, info.etag, info.lastModified)
 
-		if headResp.StatusCode < 200 || headResp.StatusCode >= 300 {
-			return fmt.Errorf("server returned error: %s", headResp.Status)
+		// Digest headers verify the download if no checksum was given
+		if rg.checksum == "" {
+			rg.checksum = info.digest
 		}
 
-		rg.totalLength = headResp.ContentLength
+		rg.totalLength = info.length
 		// Check for single connection fallback
 		if rg.totalLength <= 0 {
 			// fmt.Println("File size unknown. Falling back to single connection download.")
 			if err := rg.downloadSingle(ctx, uriStr, rg.httpClient); err != nil {
 				return err
 			}
+			rg.applyRemoteTime()
 			return rg.verifyChecksum()
 		}
 
 		// Check Accept-Ranges
-		if headResp.Header.Get("Accept-Ranges") != "bytes" {
+		if !info.acceptRanges {
 			// fmt.Println("Server does not support 'Accept-Ranges'. Falling back to single connection download.")
 			if err := rg.downloadSingle(ctx, uriStr, rg.httpClient); err != nil {
 				return err
 			}
+			rg.applyRemoteTime()
 			return rg.verifyChecksum()
 		}
 
@@ -334,6 +470,13 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 		}
 	}
 
+	// All mirrors must serve the same file before segments are spread across them
+	if rg.mirrors.Len() > 1 {
+		if err := rg.validateMirrors(ctx, uriStr); err != nil {
+			return err
+		}
+	}
+
 	// 3. Initialize Segment System
 	var pieceLength int64
 	if resumed {
@@ -342,6 +485,22 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 		pieceLength = segment.CalculateOptimalPieceLength(rg.totalLength)
 	}
 
+	// Piece hashes dictate the piece length
+	var hashAlgo string
+	var pieceHashes []string
+	if ph := rg.options.Get(option.PieceHashes); ph != "" {
+		var hashLength int64
+		hashAlgo, hashLength, pieceHashes, err = parsePieceHashes(ph)
+		if err != nil {
+			return err
+		}
+		if resumed && hashLength != pieceLength {
+			return apperror.New(apperror.ExitPieceLengthDiff,
+				fmt.Sprintf("piece length %d of the control file differs from the hashed piece length %d", pieceLength, hashLength))
+		}
+		pieceLength = hashLength
+	}
+
 	// Initialize storage
 	rg.pieceStorage = segment.NewDefaultPieceStorage(rg.totalLength, pieceLength)
 	maxPieces, _ := rg.options.GetAsInt(option.MaxPiecesPerSegment)
@@ -351,6 +510,9 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 	if sel := rg.options.Get(option.PieceSelector); sel == "random" {
 		rg.segmentMan.SetSelector(segment.NewRandomSelector())
 	}
+	if n, _ := rg.options.GetAsInt(option.EndgameDuplicates); n > 0 {
+		rg.segmentMan.SetDuplicateEndgame(n)
+	}
 
 	// Restore bitfield if resumed
 	if resumed {
@@ -374,7 +536,7 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 		// Save initial control file for fresh downloads
 		// But only after we have totalLength
 		if rg.totalLength > 0 {
-			if err := rg.controller.Save(string(rg.gid), rg.pieceStorage, rg.uris, rg.outputPath); err != nil {
+			if err := rg.controller.Save(rg.controlState(), rg.pieceStorage); err != nil {
 				// fmt.Printf("Initial save error: %v\n", err)
 			}
 		}
@@ -386,46 +548,79 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 	}
 	defer rg.diskAdaptor.Close()
 
+	if pieceHashes != nil {
+		if ps, ok := rg.pieceStorage.(*segment.DefaultPieceStorage); ok {
+			if err := ps.SetPieceHashes(hashAlgo, pieceHashes, rg.diskAdaptor); err != nil {
+				return fmt.Errorf("invalid piece hashes: %w", err)
+			}
+		}
+	}
+
+	// Hash the file while it is downloaded instead of reading it again at the end
+	if resumed {
+		rg.initStreamHasher(loadedCF.Hash)
+	} else {
+		rg.initStreamHasher(nil)
+	}
+
 	// Start Workers
-	maxConns, _ := rg.options.GetAsInt(option.Split)
+	var maxConns int
+	if rg.options.Get(option.Split) == autoSplit {
+		rg.tuner = newSplitTuner(rg.autoSplitLimit())
+		maxConns = rg.tuner.size()
+	} else {
+		maxConns, _ = rg.options.GetAsInt(option.Split)
+	}
 	if maxConns <= 0 {
 		maxConns = 1
 	}
 
-	var wg sync.WaitGroup
 	errChan := make(chan error, maxConns)
 
 	// Create context for workers that we can cancel
 	workerCtx, cancelWorkers := context.WithCancel(ctx)
 
+	// The number of workers may change while downloading (ChangeOptions)
+	pool := newWorkerPool(func(workerID int) {
+		if err := rg.downloadWorker(workerCtx, workerID); err != nil {
+			select {
+			case errChan <- err:
+			case <-workerCtx.Done():
+			}
+		}
+	})
+	rg.stateMu.Lock()
+	rg.workers = pool
+	rg.stateMu.Unlock()
+	pool.resize(maxConns)
+
 	// Ensure we wait for workers to finish before closing resources
 	// This must be deferred BEFORE diskAdaptor.Close() so it runs AFTER workers are done
 	// (defer runs in LIFO order, so this block runs FIRST, then diskAdaptor.Close())
 	doneChan := make(chan struct{})
 	go func() {
-		wg.Wait()
+		pool.wait()
 		close(doneChan)
 	}()
 
+	hashDone := make(chan struct{})
+	go func() {
+		defer close(hashDone)
+		rg.hashLoop(workerCtx)
+	}()
+
+	singleFallback := false
 	defer func() {
 		cancelWorkers()
 		<-doneChan
-		// Save control file after workers are done to capture final progress
-		if rg.totalLength > 0 && rg.pieceStorage != nil {
+		<-hashDone
+		// Save control file after workers are done to capture final progress.
+		// A finished download has already removed it.
+		if err != nil && !singleFallback && rg.totalLength > 0 && rg.pieceStorage != nil {
 			rg.saveControlFile()
 		}
 	}()
 
-	for i := 0; i < maxConns; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			if err := rg.downloadWorker(workerCtx, workerID, uriStr); err != nil {
-				errChan <- err
-			}
-		}(i)
-	}
-
 	// Immediate save for testing/consistency
 	rg.saveControlFile()
 
@@ -435,20 +630,34 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 	defer ticker.Stop()
 	defer statsTicker.Stop()
 
+	// Tune the number of workers from the throughput in auto mode
+	var tuneC <-chan time.Time
+	if rg.tuner != nil {
+		tuneTicker := time.NewTicker(rg.splitTuneInterval)
+		defer tuneTicker.Stop()
+		tuneC = tuneTicker.C
+	}
+	lastTotal, lastTune := int64(0), time.Now()
+
+	// Drop connections far slower than the others
+	slowCheck := time.NewTicker(rg.slowCheckInterval)
+	defer slowCheck.Stop()
+
 	for {
 		select {
 		case <-rg.cancelCh:
 			// Download was cancelled
 			rg.saveControlFile()
-			return fmt.Errorf("download cancelled")
+			return errDownloadCancelled
 		case <-rg.pauseCh:
 			// Download was paused, wait for resume or cancel
 			rg.saveControlFile()
 			select {
 			case <-rg.resumeCh:
 				// Resumed, continue
+				lastTotal, lastTune = rg.speedCalc.GetTotalBytes(), time.Now()
 			case <-rg.cancelCh:
-				return fmt.Errorf("download cancelled")
+				return errDownloadCancelled
 			case <-ctx.Done():
 				return ctx.Err()
 			}
@@ -456,10 +665,30 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 			// Save will happen in deferred function after workers finish
 			return ctx.Err()
 		case err := <-errChan:
+			if errors.Is(err, internalhttp.ErrRangeIgnored) {
+				cancelWorkers()
+				<-doneChan
+				<-hashDone
+				singleFallback = true
+				return rg.restartSingle(ctx, uriStr)
+			}
 			rg.saveControlFile()
 			return err
 		case <-ticker.C:
 			rg.saveControlFile()
+		case now := <-slowCheck.C:
+			if !rg.IsPaused() {
+				rg.conns.check(now, rg.slowCheckInterval/2)
+			}
+		case now := <-tuneC:
+			total := rg.speedCalc.GetTotalBytes()
+			speed := float64(total-lastTotal) / now.Sub(lastTune).Seconds()
+			lastTotal, lastTune = total, now
+			// A split set with ChangeOptions ends tuning
+			if rg.IsPaused() || rg.options.Get(option.Split) != autoSplit {
+				continue
+			}
+			pool.resize(rg.tuner.observe(speed))
 		case <-statsTicker.C:
 			// Skip stats if paused
 			if rg.IsPaused() {
@@ -474,12 +703,18 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 				written = rg.totalLength
 			}
 
-			rg.console.PrintProgress(string(rg.gid), rg.totalLength, written, speed, maxConns)
+			rg.console.PrintProgress(string(rg.gid), rg.totalLength, written, speed, pool.size())
 
 		case <-doneChan:
 			// Check if any errors occurred during download
 			select {
 			case err := <-errChan:
+				if errors.Is(err, internalhttp.ErrRangeIgnored) {
+					cancelWorkers()
+					<-hashDone
+					singleFallback = true
+					return rg.restartSingle(ctx, uriStr)
+				}
 				rg.saveControlFile()
 				return err
 			default:
@@ -490,7 +725,7 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 			if written > rg.totalLength {
 				written = rg.totalLength
 			}
-			rg.console.PrintProgress(string(rg.gid), rg.totalLength, written, 0, maxConns)
+			rg.console.PrintProgress(string(rg.gid), rg.totalLength, written, 0, pool.size())
 
 			if !rg.segmentMan.IsAllComplete() {
 				rg.saveControlFile()
@@ -505,6 +740,19 @@ func (rg *RequestGroup) Execute(ctx context.Context) (err error) {
 
 			rg.controller.Remove() // Cleanup control file on success
 
+			// Only the tail written since the last update is left to hash
+			cancelWorkers()
+			<-hashDone
+			if rg.streamHasher != nil {
+				rg.streamHasher.Advance(ctx, rg.totalLength)
+			}
+
+			// Flush buffered writes before the finished file is inspected
+			if err := rg.diskAdaptor.Close(); err != nil {
+				return err
+			}
+
+			rg.applyRemoteTime()
 			return rg.verifyChecksum()
 		}
 	}
@@ -514,16 +762,195 @@ func (rg *RequestGroup) saveControlFile() {
 	if rg.pieceStorage == nil || rg.controller == nil {
 		return
 	}
-	err := rg.controller.Save(string(rg.gid), rg.pieceStorage, rg.uris, rg.outputPath)
+	err := rg.controller.Save(rg.controlState(), rg.pieceStorage)
 	if err != nil {
 		// fmt.Printf("Failed to save control file: %v\n", err)
 	}
 }
 
-// verifyChecksum performs checksum validation
+// controlState returns the download metadata kept in the control file
+func (rg *RequestGroup) controlState() control.ControlFile {
+	v := rg.validators()
+	cf := control.ControlFile{
+		GID:      string(rg.gid),
+		URIs:     rg.currentURIs(),
+		Path:     rg.outputPath,
+		ETag:     v.etag,
+		Checksum: rg.checksum,
+		Hash:     rg.hashState(),
+	}
+	if !v.lastModified.IsZero() {
+		cf.LastModified = v.lastModified.UTC().Format(http.TimeFormat)
+	}
+	return cf
+}
+
+// validators are the ETag and Last-Modified reported for one URI
+type validators struct {
+	uri          string
+	etag         string
+	lastModified time.Time
+}
+
+// setValidators records the ETag and Last-Modified reported for uri
+func (rg *RequestGroup) setValidators(uri, etag string, lastModified time.Time) {
+	rg.stateMu.Lock()
+	defer rg.stateMu.Unlock()
+	rg.validatorURI = uri
+	rg.etag = etag
+	rg.lastModified = lastModified
+}
+
+// validators returns the recorded validators, all from the same response
+func (rg *RequestGroup) validators() validators {
+	rg.stateMu.RLock()
+	defer rg.stateMu.RUnlock()
+	return validators{uri: rg.validatorURI, etag: rg.etag, lastModified: rg.lastModified}
+}
+
+// ifRange returns the If-Range value for ranged requests to uri, or an empty
+// string. Weak ETags must not be used in If-Range (RFC 9110 section 13.1.5).
+func (v validators) ifRange(uri string) string {
+	if uri != v.uri {
+		return "" // Mirrors have validators of their own
+	}
+	if v.etag != "" && !strings.HasPrefix(v.etag, "W/") {
+		return v.etag
+	}
+	if !v.lastModified.IsZero() {
+		return v.lastModified.UTC().Format(http.TimeFormat)
+	}
+	return ""
+}
+
+// changed reports whether the ETag or Last-Modified of resp differ from v.
+// Validators missing on either side do not count.
+func (v validators) changed(resp *http.Response) bool {
+	if etag := resp.Header.Get("ETag"); etag != "" && v.etag != "" && etag != v.etag {
+		return true
+	}
+	t, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return err == nil && !v.lastModified.IsZero() && !t.Equal(v.lastModified)
+}
+
+// resourceChanged compares the remote file with the state saved in the
+// control file and describes the difference, if any
+func resourceChanged(cf *control.ControlFile, info *resourceInfo) string {
+	if info.length > 0 && info.length != cf.TotalLength {
+		return fmt.Sprintf("length %d, expected %d", info.length, cf.TotalLength)
+	}
+	if !info.acceptRanges {
+		return "ranged requests not supported"
+	}
+	if cf.ETag != "" && info.etag != "" && info.etag != cf.ETag {
+		return fmt.Sprintf("ETag %s, expected %s", info.etag, cf.ETag)
+	}
+	if saved, err := http.ParseTime(cf.LastModified); err == nil && !info.lastModified.IsZero() && !info.lastModified.Equal(saved) {
+		return "Last-Modified " + info.lastModified.UTC().Format(http.TimeFormat) + ", expected " + cf.LastModified
+	}
+	return ""
+}
+
+// applyRemoteTime sets the modification time of the output file to the
+// one reported by the server when remote-time is enabled
+func (rg *RequestGroup) applyRemoteTime() {
+	lastModified := rg.validators().lastModified
+	if remoteTime, _ := rg.options.GetAsBool(option.RemoteTime); !remoteTime || lastModified.IsZero() {
+		return
+	}
+	os.Chtimes(rg.outputPath, time.Now(), lastModified)
+}
+
+// initStreamHasher sets up incremental checksum verification, continuing from
+// the state saved in the control file if there is one. Without a hasher the
+// finished file is read again for verification.
+func (rg *RequestGroup) initStreamHasher(saved *control.HashState) {
+	if rg.checksum == "" {
+		return
+	}
+	algo, _, err := util.ParseChecksum(rg.checksum)
+	if err != nil {
+		return // Reported by verifyChecksum
+	}
+	h, err := util.NewStreamHasher(algo, rg.diskAdaptor)
+	if err != nil {
+		return
+	}
+
+	// The saved state is only usable if it does not reach into missing pieces
+	if saved != nil && saved.Algo == algo && saved.Offset <= rg.completedPrefix() {
+		if err := h.Restore(saved.Offset, saved.State); err != nil {
+			h, _ = util.NewStreamHasher(algo, rg.diskAdaptor)
+		}
+	}
+
+	rg.streamHasher = h
+	rg.hashNotify = make(chan struct{}, 1)
+	rg.hashNotify <- struct{}{} // Catch up with pieces restored from the control file
+}
+
+// hashLoop feeds newly completed pieces at the start of the file to the
+// stream hasher until ctx is done
+func (rg *RequestGroup) hashLoop(ctx context.Context) {
+	if rg.streamHasher == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rg.hashNotify:
+		}
+		// Errors are retried by the final update when the download finishes
+		rg.streamHasher.Advance(ctx, rg.completedPrefix())
+	}
+}
+
+// notifyHasher tells hashLoop that pieces were completed
+func (rg *RequestGroup) notifyHasher() {
+	if rg.hashNotify == nil {
+		return
+	}
+	select {
+	case rg.hashNotify <- struct{}{}:
+	default:
+	}
+}
+
+// completedPrefix returns the length of the contiguous completed part at the
+// start of the file
+func (rg *RequestGroup) completedPrefix() int64 {
+	i := rg.pieceStorage.GetBitfield().GetFirstMissingBit(0)
+	if i < 0 {
+		return rg.totalLength
+	}
+	return rg.pieceStorage.GetPiece(i).Offset
+}
+
+// hashState returns the stream hasher progress for the control file
+func (rg *RequestGroup) hashState() *control.HashState {
+	if rg.streamHasher == nil {
+		return nil
+	}
+	offset, state, err := rg.streamHasher.State()
+	if err != nil {
+		return nil
+	}
+	return &control.HashState{Algo: rg.streamHasher.Algo(), Offset: offset, State: state}
+}
+
+// verifyChecksum performs checksum validation. The stream hash is used if it
+// covers the whole file, otherwise the file is hashed from disk.
 func (rg *RequestGroup) verifyChecksum() error {
-	if checksum := rg.options.Get(option.Checksum); checksum != "" {
-		valid, err := util.VerifyChecksum(rg.outputPath, checksum)
+	if checksum := rg.checksum; checksum != "" {
+		var valid bool
+		var err error
+		if rg.streamHasher != nil && rg.streamHasher.Offset() == rg.totalLength {
+			_, expected, _ := util.ParseChecksum(checksum)
+			valid = rg.streamHasher.Sum() == expected
+		} else {
+			valid, err = util.VerifyChecksum(rg.outputPath, checksum)
+		}
 
 		rg.stateMu.Lock()
 		rg.checksumOK = valid
@@ -533,7 +960,7 @@ func (rg *RequestGroup) verifyChecksum() error {
 		if err != nil {
 			return fmt.Errorf("checksum verification error: %w", err)
 		} else if !valid {
-			return fmt.Errorf("checksum failed")
+			return apperror.New(apperror.ExitChecksum, "checksum failed")
 		}
 	}
 	return nil
@@ -588,35 +1015,304 @@ func (rg *RequestGroup) enrichRequest(req *http.Request) {
 		}
 	}
 
-	// Basic Auth
+	// Basic Auth, from the options or else from .netrc for this host. An
+	// auth provider replaces it when the request is sent.
 	user := rg.options.Get(option.HttpUser)
 	pass := rg.options.Get(option.HttpPasswd)
 	if user != "" || pass != "" {
 		req.SetBasicAuth(user, pass)
+	} else {
+		rg.setNetrcAuth(req)
 	}
 }
 
-// downloadWorker runs a single download thread
-func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr string) error {
-	maxTries, _ := rg.options.GetAsInt(option.MaxTries)
-	if maxTries <= 0 {
-		maxTries = 5 // Default
+// errResourceChanged reports that the remote file changed during a download
+var errResourceChanged = errors.New("remote file changed during download")
+
+// resourceInfo describes the remote file as reported by a mirror
+type resourceInfo struct {
+	length       int64 // <= 0 if unknown
+	acceptRanges bool
+	lastModified time.Time
+	etag         string
+	digest       string // "algo=digest" announced by the server, if any
+	filename     string // Content-Disposition file name, unsanitized
+	finalURI     string // URI after redirects
+}
+
+// outputName picks the file name for a download without --out: the
+// Content-Disposition name, else the last path segment of the URI after
+// redirects. info may be nil if the file could not be probed.
+func outputName(info *resourceInfo, uri string) string {
+	if info != nil {
+		if name, err := util.SanitizeFilename(info.filename); err == nil {
+			return name
+		}
+		if info.finalURI != "" {
+			uri = info.finalURI
+		}
 	}
-	retryWait, _ := rg.options.GetAsInt(option.RetryWait)
+	if u, err := url.Parse(uri); err == nil {
+		if last, err := url.PathUnescape(path.Base(u.EscapedPath())); err == nil {
+			if name, err := util.SanitizeFilename(last); err == nil {
+				return name
+			}
+		}
+	}
+	return "index.html"
+}
 
-	// Parse LowestSpeedLimit
-	var lowestSpeedLimit int64
-	if val := rg.options.Get(option.LowestSpeedLimit); val != "" {
-		if v, err := option.ParseUnitNumber(val); err == nil {
-			lowestSpeedLimit = v
+// fetchHeaders probes each mirror until one succeeds, going over them again
+// as the retry policy allows. It returns the file information and the URI
+// that answered it.
+func (rg *RequestGroup) fetchHeaders(ctx context.Context) (*resourceInfo, string, error) {
+	maxTries := rg.maxTries()
+	var lastErr error
+	for try := 1; ; try++ {
+		for _, uri := range rg.mirrors.URIs() {
+			if err := rg.health.allow(uri); err != nil {
+				lastErr = err
+				continue
+			}
+			info, err := rg.probe(ctx, uri)
+			if urlExpired(err) {
+				if next, ok := rg.refreshURI(ctx, uri); ok {
+					uri = next
+					info, err = rg.probe(ctx, uri)
+				}
+			}
+			if err == nil {
+				return info, uri, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				return nil, "", lastErr
+			}
+			if err := rg.checkNotFound(err); err != nil {
+				return nil, "", err
+			}
+		}
+
+		wait, ok := rg.retryWait(try, lastErr)
+		if !ok || try >= maxTries {
+			return nil, "", lastErr
+		}
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// probe returns the length and range support of the file at uri
+func (rg *RequestGroup) probe(ctx context.Context, uri string) (*resourceInfo, error) {
+	start := time.Now()
+	info, err := rg.probeURI(ctx, uri)
+	rg.health.done(uri, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	if err := rg.checkExpectedSize(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// probeURI dispatches the probe to the protocol of uri
+func (rg *RequestGroup) probeURI(ctx context.Context, uri string) (*resourceInfo, error) {
+	if isFTP(uri) {
+		return rg.probeFTP(ctx, uri)
+	}
+
+	resp, headErr := rg.head(ctx, uri)
+	var info *resourceInfo
+	if headErr == nil {
+		info = &resourceInfo{
+			length:       resp.ContentLength,
+			acceptRanges: resp.Header.Get("Accept-Ranges") == "bytes",
+			etag:         resp.Header.Get("ETag"),
+			digest:       internalhttp.DigestFromHeader(resp.Header),
+			filename:     internalhttp.FilenameFromContentDisposition(resp.Header.Get("Content-Disposition")),
+			finalURI:     resp.Request.URL.String(),
+		}
+		if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			info.lastModified = t
+		}
+		if info.acceptRanges && info.length > 0 {
+			return info, nil
+		}
+	} else if ctx.Err() != nil {
+		return nil, headErr
+	}
+
+	// HEAD was rejected or did not announce range support, which many
+	// servers honor anyway
+	rangeInfo, err := rg.probeRange(ctx, uri)
+	if err != nil {
+		if headErr != nil {
+			return nil, headErr
+		}
+		return info, nil
+	}
+	if info != nil {
+		// Digest headers of a partial response may describe the part only
+		rangeInfo.digest = info.digest
+		if rangeInfo.etag == "" {
+			rangeInfo.etag = info.etag
+		}
+		if rangeInfo.lastModified.IsZero() {
+			rangeInfo.lastModified = info.lastModified
+		}
+		if rangeInfo.length <= 0 {
+			rangeInfo.length = info.length
+		}
+		if rangeInfo.filename == "" {
+			rangeInfo.filename = info.filename
+		}
+	}
+	return rangeInfo, nil
+}
+
+// probeRange learns the length and range support of the file at uri from a
+// "Range: bytes=0-0" GET. The one-byte body is drained so that the first
+// worker reuses the connection.
+func (rg *RequestGroup) probeRange(ctx context.Context, uri string) (*resourceInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	rg.enrichRequest(req)
+
+	resp, err := rg.send(rg.httpClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe range support: %w", err)
+	}
+
+	info := &resourceInfo{
+		etag:     resp.Header.Get("ETag"),
+		filename: internalhttp.FilenameFromContentDisposition(resp.Header.Get("Content-Disposition")),
+		finalURI: resp.Request.URL.String(),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.lastModified = t
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		defer resp.Body.Close()
+		first, last, complete, err := internalhttp.ParseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || first != 0 || last != 0 {
+			// Segments cannot be trusted to a server answering with another
+			// range than the one asked for; it gets a single connection
+			info.length = -1
+			return info, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1))
+		info.length = complete
+		info.acceptRanges = complete > 0
+	case http.StatusOK:
+		// The body is the whole file, closing it is cheaper than reading it
+		resp.Body.Close()
+		info.length = resp.ContentLength
+	default:
+		resp.Body.Close()
+		return nil, internalhttp.NewStatusError(resp)
+	}
+	return info, nil
+}
+
+// checkExpectedSize rejects a mirror whose length differs from the size
+// announced for the download (e.g. by a Metalink)
+func (rg *RequestGroup) checkExpectedSize(info *resourceInfo) error {
+	expected, _ := strconv.ParseInt(rg.options.Get(option.ExpectedSize), 10, 64)
+	if expected > 0 && info.length > 0 && info.length != expected {
+		return fmt.Errorf("length mismatch: got %d, expected %d", info.length, expected)
+	}
+	return nil
+}
+
+// head issues a HEAD request against uri and checks the status code
+func (rg *RequestGroup) head(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rg.enrichRequest(req)
+
+	resp, err := rg.send(rg.httpClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch headers: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, internalhttp.NewStatusError(resp)
+	}
+	return resp, nil
+}
+
+// validateMirrors checks that every mirror other than primary reports the
+// same length and supports ranged requests. Mirrors that don't are dropped.
+func (rg *RequestGroup) validateMirrors(ctx context.Context, primary string) error {
+	uris := rg.mirrors.URIs()
+
+	var wg sync.WaitGroup
+	problems := make([]error, len(uris))
+	for i, uri := range uris {
+		if uri == primary {
+			continue
 		}
+		wg.Go(func() {
+			info, err := rg.probe(ctx, uri)
+			switch {
+			case err != nil:
+				problems[i] = err
+			case info.length != rg.totalLength:
+				problems[i] = fmt.Errorf("length mismatch: got %d, expected %d", info.length, rg.totalLength)
+			case !info.acceptRanges:
+				problems[i] = fmt.Errorf("ranged requests not supported")
+			}
+		})
 	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for i, uri := range uris {
+		if problems[i] != nil {
+			rg.mirrors.Remove(uri)
+			rg.console.Printf("Dropping mirror %s: %v\n", uri, problems[i])
+		}
+	}
+
+	if rg.mirrors.Len() == 0 {
+		return fmt.Errorf("no usable mirrors")
+	}
+	return nil
+}
+
+// updateProgress records n bytes written to segment segIndex, once per range
+func (rg *RequestGroup) updateProgress(segIndex int, n int64) {
+	if added := rg.segmentMan.UpdateSegment(segIndex, n); added > 0 {
+		rg.completedBytes.Add(added)
+		rg.speedCalc.Update(int(added))
+	}
+}
+
+// downloadWorker runs a single download thread
+func (rg *RequestGroup) downloadWorker(ctx context.Context, id int) error {
+	uriStr := rg.mirrors.Pick(id)
 
 	for {
 		// Check for cancel
 		select {
 		case <-rg.cancelCh:
-			return fmt.Errorf("download cancelled")
+			return errDownloadCancelled
 		default:
 		}
 
@@ -626,7 +1322,7 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 			case <-rg.resumeCh:
 				// Resumed
 			case <-rg.cancelCh:
-				return fmt.Errorf("download cancelled")
+				return errDownloadCancelled
 			case <-ctx.Done():
 				return ctx.Err()
 			case <-time.After(100 * time.Millisecond):
@@ -634,21 +1330,38 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 			}
 		}
 
+		// Leave if the number of connections was lowered
+		if rg.workers != nil && rg.workers.retire(id) {
+			return nil
+		}
+
 		// Get next segment
 		seg := rg.segmentMan.GetSegment()
 		if seg == nil {
 			return nil // No more work
 		}
 
+		// Options may change while downloading, so read them per segment
+		maxTries := rg.maxTries()
+
+		// Parse LowestSpeedLimit
+		var lowestSpeedLimit int64
+		if val := rg.options.Get(option.LowestSpeedLimit); val != "" {
+			if v, err := option.ParseUnitNumber(val); err == nil {
+				lowestSpeedLimit = v
+			}
+		}
+
 		var lastErr error
 		success := false
+		refreshed := false
 
 		for try := 0; try < maxTries; try++ {
 			// Check context before retry
 			select {
 			case <-rg.cancelCh:
 				rg.segmentMan.CancelSegment(seg.Index)
-				return fmt.Errorf("download cancelled")
+				return errDownloadCancelled
 			case <-ctx.Done():
 				rg.segmentMan.CancelSegment(seg.Index)
 				return ctx.Err()
@@ -656,7 +1369,8 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 			}
 
 			// Attempt download
-			err := func() error {
+			stat, connCtx := rg.conns.start(ctx, id, seg.Index)
+			err := func() (err error) {
 				// Calculate range
 				// Start from current written position to support resume within segment
 				currentStart := seg.Position + seg.Written
@@ -666,26 +1380,22 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 					return nil // Already complete
 				}
 
-				req, err := http.NewRequestWithContext(ctx, "GET", uriStr, nil)
-				if err != nil {
+				// Requests to a host with an open circuit fail at once
+				if err := rg.health.allow(uriStr); err != nil {
 					return err
 				}
-
-				// Add Range header
-				req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", currentStart, end))
-
-				// Enrich with other headers
-				rg.enrichRequest(req)
-
-				resp, err := rg.httpClient.Do(req)
+				opened := time.Now()
+				body, err := rg.openRange(connCtx, uriStr, currentStart, end)
+				rg.health.done(uriStr, time.Since(opened), err)
 				if err != nil {
 					return err
 				}
-				defer resp.Body.Close()
-
-				if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-					return fmt.Errorf("server returned %s", resp.Status)
-				}
+				defer body.Close()
+				defer func() {
+					if err != nil {
+						rg.health.broke(uriStr, err)
+					}
+				}()
 
 				// Read and write body
 				buf := util.GetBuffer()
@@ -693,9 +1403,9 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 				// buf := *bufPtr (Removed)
 
 				// Wrap reader with limiter
-				var reader io.Reader = resp.Body
+				var reader io.Reader = body
 				if rg.limiter != nil {
-					reader = limit.NewReader(resp.Body, rg.limiter, ctx)
+					reader = limit.NewReader(body, rg.limiter, connCtx)
 				}
 
 				// Speed check variables
@@ -715,6 +1425,7 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 				for {
 					n, readErr := reader.Read(buf)
 					if n > 0 {
+						stat.bytes.Add(int64(n))
 						_, writeErr := rg.diskAdaptor.WriteAt(buf[:n], currentStart)
 						if writeErr != nil {
 							return writeErr
@@ -724,9 +1435,7 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 						pendingBytes += int64(n)
 
 						if pendingBytes >= batchSize {
-							rg.segmentMan.UpdateSegment(seg.Index, pendingBytes)
-							rg.completedBytes.Add(pendingBytes)
-							rg.speedCalc.Update(int(pendingBytes))
+							rg.updateProgress(seg.Index, pendingBytes)
 							pendingBytes = 0
 						}
 
@@ -736,7 +1445,8 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 							if time.Since(lastCheckTime) >= checkInterval {
 								speed := float64(bytesSinceCheck) / time.Since(lastCheckTime).Seconds()
 								if speed < float64(lowestSpeedLimit) {
-									return fmt.Errorf("speed %.0f < lowest limit %d", speed, lowestSpeedLimit)
+									return apperror.New(apperror.ExitTooSlowSpeed,
+										fmt.Sprintf("speed %.0f < lowest limit %d", speed, lowestSpeedLimit))
 								}
 								lastCheckTime = time.Now()
 								bytesSinceCheck = 0
@@ -746,40 +1456,133 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 
 					if readErr == io.EOF {
 						if pendingBytes > 0 {
-							rg.segmentMan.UpdateSegment(seg.Index, pendingBytes)
-							rg.completedBytes.Add(pendingBytes)
-							rg.speedCalc.Update(int(pendingBytes))
+							rg.updateProgress(seg.Index, pendingBytes)
 							pendingBytes = 0
 						}
+						// The next try continues where the body ended
+						if currentStart <= end {
+							return fmt.Errorf("segment %d: %w", seg.Index, io.ErrUnexpectedEOF)
+						}
 						break
 					}
 					if readErr != nil {
 						if pendingBytes > 0 {
-							rg.segmentMan.UpdateSegment(seg.Index, pendingBytes)
-							rg.completedBytes.Add(pendingBytes)
-							rg.speedCalc.Update(int(pendingBytes))
+							rg.updateProgress(seg.Index, pendingBytes)
 						}
 						return readErr
 					}
 				}
 				return nil
 			}()
+			rg.conns.finish(id, stat)
 
 			if err == nil {
 				success = true
-				rg.segmentMan.CompleteSegment(seg.Index)
+				failed := rg.segmentMan.CompleteSegment(seg.Index)
+				// A duplicate request for the range is no longer needed
+				rg.conns.dropFinished(rg.segmentMan.IsActive)
+				if len(failed) == 0 {
+					rg.mirrors.ReportSuccess(uriStr)
+					rg.notifyHasher()
+					break
+				}
+				// Corrupt pieces are downloaded again, preferably from another mirror
+				if err := rg.handleCorruptPieces(failed, maxTries); err != nil {
+					return err
+				}
+				uriStr = rg.mirrors.Failover(uriStr)
 				break
 			}
 
+			// In duplicate endgame mode the other request for the range
+			// finished first
+			if rg.segmentMan.LostToDuplicate(seg) {
+				success = true
+				break
+			}
+
+			// An expired URL is refreshed once and the range continues
+			// from where it got to
+			if !refreshed && urlExpired(err) {
+				if next, ok := rg.refreshURI(ctx, uriStr); ok {
+					uriStr, refreshed = next, true
+					try--
+					continue
+				}
+			}
+
+			// A host with an open circuit is skipped if another mirror
+			// is healthy
+			var circuitErr *CircuitOpenError
+			if errors.As(err, &circuitErr) {
+				if next := rg.healthyMirror(uriStr); next != "" {
+					uriStr = next
+					try--
+					continue
+				}
+			}
+
+			// A connection dropped for being slow is not a failure of the
+			// range, which continues on a fresh connection
+			if stat.evicted.Load() && ctx.Err() == nil {
+				uriStr = rg.mirrors.Failover(uriStr)
+				try--
+				continue
+			}
+
 			lastErr = err
 
+			// In auto mode an overloaded server gets fewer connections
+			var statusErr *internalhttp.StatusError
+			if errors.As(err, &statusErr) && statusErr.Throttled() && rg.throttled() && rg.workers.retire(id) {
+				rg.segmentMan.CancelSegment(seg.Index)
+				return nil
+			}
+
+			// Retrying cannot help once the file has changed
+			if errors.Is(err, errResourceChanged) {
+				rg.segmentMan.CancelSegment(seg.Index)
+				return err
+			}
+
+			// A mirror that ignores ranges is dropped; without another
+			// mirror the download continues over a single connection
+			if errors.Is(err, internalhttp.ErrRangeIgnored) {
+				if rg.mirrors.Len() <= 1 {
+					rg.segmentMan.CancelSegment(seg.Index)
+					return err
+				}
+				rg.mirrors.Remove(uriStr)
+				uriStr = rg.mirrors.Pick(id)
+				continue
+			}
+
+			// Too many "file not found" answers fail the download
+			if err := rg.checkNotFound(err); err != nil {
+				rg.segmentMan.CancelSegment(seg.Index)
+				return err
+			}
+
+			// Continue the segment from the next mirror
+			uriStr = rg.mirrors.Failover(uriStr)
+
+			wait, ok := rg.retryWait(try+1, err)
+			if !ok {
+				// Retrying cannot help, but another mirror might
+				if rg.mirrors.Len() > 1 {
+					continue
+				}
+				rg.segmentMan.CancelSegment(seg.Index)
+				return fmt.Errorf("worker %d failed segment %d: %w", id, seg.Index, err)
+			}
+
 			// Wait before retry
 			if try < maxTries-1 {
 				select {
 				case <-ctx.Done():
 					rg.segmentMan.CancelSegment(seg.Index)
 					return ctx.Err()
-				case <-time.After(time.Duration(retryWait) * time.Second):
+				case <-time.After(wait):
 					// Continue loop
 				}
 			}
@@ -793,15 +1596,121 @@ func (rg *RequestGroup) downloadWorker(ctx context.Context, id int, uriStr strin
 	}
 }
 
+// openRange opens the byte range [start, end] of the file at uri
+func (rg *RequestGroup) openRange(ctx context.Context, uri string, start, end int64) (io.ReadCloser, error) {
+	if isFTP(uri) {
+		return rg.openFTPRange(ctx, uri, start, end-start+1)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add Range header
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	// One snapshot, so that the validators compared below are those sent
+	v := rg.validators()
+	ifRange := v.ifRange(uri)
+	if ifRange != "" {
+		req.Header.Set("If-Range", ifRange)
+	}
+
+	// Enrich with other headers
+	rg.enrichRequest(req)
+
+	resp, err := rg.send(rg.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if err := internalhttp.CheckPartialResponse(resp, start, end, rg.totalLength); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	case http.StatusOK:
+		// The server ignores the range when the validator does not match,
+		// but also when it does not support ranges at all
+		if ifRange != "" && v.changed(resp) {
+			resp.Body.Close()
+			return nil, apperror.Wrap(apperror.ExitCannotResume, errResourceChanged)
+		}
+		// The whole file is fine if that is what was asked for
+		if start != 0 || end != rg.totalLength-1 || (resp.ContentLength >= 0 && resp.ContentLength != rg.totalLength) {
+			resp.Body.Close()
+			return nil, internalhttp.ErrRangeIgnored
+		}
+	default:
+		resp.Body.Close()
+		return nil, internalhttp.NewStatusError(resp)
+	}
+
+	// Never write past the requested range
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, end-start+1), resp.Body}, nil
+}
+
+// closeFTP closes the idle control connections of the FTP client, if any
+func (rg *RequestGroup) closeFTP() {
+	if rg.ftpClient != nil {
+		rg.ftpClient.CloseIdleConnections()
+	}
+}
+
+// restartSingle abandons the segmented download after the server answered
+// a ranged request with the whole file and downloads it again over a single
+// connection. Workers must have stopped.
+func (rg *RequestGroup) restartSingle(ctx context.Context, uri string) error {
+	rg.console.Printf("Server ignored the range request, downloading over a single connection\n")
+
+	if err := rg.diskAdaptor.Close(); err != nil {
+		return err
+	}
+	rg.controller.Remove()
+	if err := os.Remove(rg.outputPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	rg.streamHasher = nil
+	rg.completedBytes.Store(0)
+
+	if err := rg.downloadSingle(ctx, uri, rg.httpClient); err != nil {
+		return err
+	}
+	rg.applyRemoteTime()
+	return rg.verifyChecksum()
+}
+
+// handleCorruptPieces takes failed pieces out of the progress and gives up
+// on a piece that failed verification maxTries times
+func (rg *RequestGroup) handleCorruptPieces(pieces []int, maxTries int) error {
+	rg.stateMu.Lock()
+	defer rg.stateMu.Unlock()
+
+	if rg.pieceFailures == nil {
+		rg.pieceFailures = make(map[int]int)
+	}
+	for _, i := range pieces {
+		rg.completedBytes.Add(-rg.pieceStorage.GetPiece(i).Length)
+		rg.pieceFailures[i]++
+		if rg.pieceFailures[i] >= maxTries {
+			return apperror.New(apperror.ExitChecksum,
+				fmt.Sprintf("piece %d failed hash verification %d times", i, rg.pieceFailures[i]))
+		}
+		rg.console.Printf("Piece %d failed hash verification, downloading it again\n", i)
+	}
+	return nil
+}
+
 // downloadSingle handles single-connection legacy download
 func (rg *RequestGroup) downloadSingle(ctx context.Context, uriStr string, client *http.Client) error {
-	maxTries, _ := rg.options.GetAsInt(option.MaxTries)
-	if maxTries <= 0 {
-		maxTries = 5
-	}
-	retryWait, _ := rg.options.GetAsInt(option.RetryWait)
+	maxTries := rg.maxTries()
 
 	var lastErr error
+	refreshed := false
 	for try := 0; try < maxTries; try++ {
 		select {
 		case <-ctx.Done():
@@ -810,6 +1719,11 @@ func (rg *RequestGroup) downloadSingle(ctx context.Context, uriStr string, clien
 		}
 
 		err := func() error {
+			// Requests to a host with an open circuit fail at once
+			if err := rg.health.allow(uriStr); err != nil {
+				return err
+			}
+
 			// Check for existing file to support simple resume in single mode
 			var startPos int64 = 0
 			fileMode := os.O_CREATE | os.O_WRONLY
@@ -819,35 +1733,61 @@ func (rg *RequestGroup) downloadSingle(ctx context.Context, uriStr string, clien
 				fileMode = os.O_APPEND | os.O_WRONLY
 			}
 
-			req, err := http.NewRequestWithContext(ctx, "GET", uriStr, nil)
-			if err != nil {
-				return err
-			}
+			var body io.ReadCloser
+			if isFTP(uriStr) {
+				// FTP servers resume with REST, no fallback needed
+				var err error
+				body, err = rg.openFTPRange(ctx, uriStr, startPos, -1)
+				if err != nil {
+					return err
+				}
+			} else {
+				req, err := http.NewRequestWithContext(ctx, "GET", uriStr, nil)
+				if err != nil {
+					return err
+				}
 
-			if startPos > 0 {
-				req.Header.Set("Range", fmt.Sprintf("bytes=%d-", startPos))
-			}
+				if startPos > 0 {
+					req.Header.Set("Range", fmt.Sprintf("bytes=%d-", startPos))
+					// A file changed since is sent whole and restarted below
+					if ifRange := rg.validators().ifRange(uriStr); ifRange != "" {
+						req.Header.Set("If-Range", ifRange)
+					}
+				}
 
-			rg.enrichRequest(req)
+				rg.enrichRequest(req)
 
-			resp, err := client.Do(req)
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
+				resp, err := rg.send(client, req)
+				if err != nil {
+					return err
+				}
+				body = resp.Body
 
-			if startPos > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
-				// File already complete or range error
-				return nil
-			}
+				if startPos > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+					// File already complete or range error
+					body.Close()
+					return nil
+				}
 
-			if startPos > 0 && resp.StatusCode != http.StatusPartialContent {
-				// Server doesn't support resume, restart
-				startPos = 0
-				fileMode = os.O_CREATE | os.O_WRONLY
-			} else if startPos == 0 && resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("server returned %s", resp.Status)
+				switch {
+				case startPos > 0 && resp.StatusCode == http.StatusOK:
+					// Server doesn't support resume or the file changed, restart
+					startPos = 0
+					fileMode = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+				case startPos > 0 && resp.StatusCode == http.StatusPartialContent:
+					// The body must continue exactly where the file ends
+					cr := resp.Header.Get("Content-Range")
+					if first, _, _, err := internalhttp.ParseContentRange(cr); err != nil || first != startPos {
+						body.Close()
+						return &internalhttp.RangeError{Start: startPos, End: -1, Got: cr, Reason: "range mismatch"}
+					}
+				case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent,
+					startPos == 0 && resp.StatusCode != http.StatusOK:
+					body.Close()
+					return internalhttp.NewStatusError(resp)
+				}
 			}
+			defer body.Close()
 
 			f, err := os.OpenFile(rg.outputPath, fileMode, 0666)
 			if err != nil {
@@ -857,9 +1797,9 @@ func (rg *RequestGroup) downloadSingle(ctx context.Context, uriStr string, clien
 
 			buf := util.GetBuffer()
 			defer util.PutBuffer(buf)
-			var reader io.Reader = resp.Body
+			var reader io.Reader = body
 			if rg.limiter != nil {
-				reader = limit.NewReader(resp.Body, rg.limiter, ctx)
+				reader = limit.NewReader(body, rg.limiter, ctx)
 			}
 
 			totalWritten := startPos
@@ -893,16 +1833,38 @@ func (rg *RequestGroup) downloadSingle(ctx context.Context, uriStr string, clien
 			return nil
 		}()
 
+		rg.health.done(uriStr, 0, err)
 		if err == nil {
 			return nil
 		}
+		// An expired URL is refreshed, and again after it worked for a while
+		if !urlExpired(err) {
+			refreshed = false
+		} else if !refreshed {
+			if next, ok := rg.refreshURI(ctx, uriStr); ok {
+				uriStr, refreshed = next, true
+				try--
+				continue
+			}
+		}
 		lastErr = err
+		if err := rg.checkNotFound(err); err != nil {
+			return err
+		}
+		uriStr = rg.mirrors.Failover(uriStr)
 
+		wait, ok := rg.retryWait(try+1, err)
+		if !ok {
+			if rg.mirrors.Len() > 1 {
+				continue
+			}
+			return fmt.Errorf("downloadSingle failed: %w", err)
+		}
 		if try < maxTries-1 {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
-			case <-time.After(time.Duration(retryWait) * time.Second):
+			case <-time.After(wait):
 			}
 		}
 	}
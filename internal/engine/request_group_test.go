@@ -1,8 +1,10 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -227,10 +229,13 @@ func TestRequestGroup_Retry_On_Failure(t *testing.T) {
 			return
 		}
 
+		var start, end int64
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
 		w.Header().Set("Accept-Ranges", "bytes")
-		w.Header().Set("Content-Length", "100")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/100", start, end))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", end-start+1))
 		w.WriteHeader(http.StatusPartialContent)
-		w.Write(make([]byte, 100))
+		w.Write(make([]byte, end-start+1))
 	}))
 	defer server.Close()
 
@@ -288,6 +293,227 @@ func TestRequestGroup_Fallback_To_Single(t *testing.T) {
 	}
 }
 
+// A server that advertises ranges but answers ranged GETs with the whole
+// file must not corrupt the output
+func TestRequestGroup_RangeIgnored(t *testing.T) {
+	data := make([]byte, 3*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	// Validators are sent, so ranged requests carry If-Range; the whole file
+	// still comes back unchanged
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != "HEAD" {
+			w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "ignored.bin")
+	opt.Put(option.Split, "4")
+
+	rg := NewRequestGroup("range-ignored-gid", []string{server.URL}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	fullPath := filepath.Join(tmpDir, "ignored.bin")
+	downloaded, _ := os.ReadFile(fullPath)
+	if !bytes.Equal(downloaded, data) {
+		t.Errorf("Content mismatch: got %d bytes", len(downloaded))
+	}
+	if _, err := os.Stat(fullPath + ".hydra"); !os.IsNotExist(err) {
+		t.Error("Control file should be removed")
+	}
+}
+
+// Partial responses that do not match the requested range are retried
+func TestRequestGroup_BadPartialResponse(t *testing.T) {
+	data := make([]byte, 2*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+
+	tests := []struct {
+		name      string
+		misbehave func(w http.ResponseWriter)
+	}{
+		{"WrongContentRange", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-99/%d", len(data)))
+			w.Header().Set("Content-Length", "100")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[:100])
+		}},
+		{"Truncated", func(w http.ResponseWriter) {
+			// Claims the whole file but closes the connection early
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(data)-1, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[:1000])
+			panic(http.ErrAbortHandler)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "GET" && gets.Add(1) == 1 {
+					tt.misbehave(w)
+					return
+				}
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			}))
+			defer server.Close()
+
+			tmpDir := t.TempDir()
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, tmpDir)
+			opt.Put(option.Out, "bad.bin")
+			opt.Put(option.Split, "1")
+			opt.Put(option.RetryWait, "0")
+
+			rg := NewRequestGroup("bad-partial-gid", []string{server.URL}, opt)
+			if err := rg.Execute(context.Background()); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			downloaded, _ := os.ReadFile(filepath.Join(tmpDir, "bad.bin"))
+			if !bytes.Equal(downloaded, data) {
+				t.Errorf("Content mismatch: got %d bytes", len(downloaded))
+			}
+			if gets.Load() < 2 {
+				t.Errorf("Expected the bad response to be retried, got %d requests", gets.Load())
+			}
+		})
+	}
+}
+
+// noAcceptRanges hides the Accept-Ranges header set by http.ServeContent
+type noAcceptRanges struct {
+	http.ResponseWriter
+}
+
+func (w noAcceptRanges) WriteHeader(code int) {
+	w.Header().Del("Accept-Ranges")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Servers that reject HEAD or leave out Accept-Ranges are probed with a
+// one-byte ranged GET and still downloaded in segments
+func TestRequestGroup_RangeProbe(t *testing.T) {
+	data := make([]byte, 4*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 249)
+	}
+
+	tests := []struct {
+		name       string
+		headStatus int // 0 answers HEAD without Accept-Ranges
+	}{
+		{"HeadForbidden", http.StatusForbidden},
+		{"HeadNotAllowed", http.StatusMethodNotAllowed},
+		{"NoAcceptRanges", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rangeGets, conns atomic.Int32
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "HEAD" && tt.headStatus != 0 {
+					w.WriteHeader(tt.headStatus)
+					return
+				}
+				if r.Header.Get("Range") != "" {
+					rangeGets.Add(1)
+				}
+				http.ServeContent(noAcceptRanges{w}, r, "", time.Time{}, bytes.NewReader(data))
+			}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			tmpDir := t.TempDir()
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, tmpDir)
+			opt.Put(option.Out, "probed.bin")
+			opt.Put(option.Split, "1")
+
+			rg := NewRequestGroup("probe-gid", []string{server.URL}, opt)
+			if err := rg.Execute(context.Background()); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			downloaded, _ := os.ReadFile(filepath.Join(tmpDir, "probed.bin"))
+			if !bytes.Equal(downloaded, data) {
+				t.Errorf("Content mismatch: got %d bytes", len(downloaded))
+			}
+			// The probe plus one request per piece
+			if n := rangeGets.Load(); n != int32(rg.pieceStorage.GetNumPieces())+1 {
+				t.Errorf("Expected a segmented download, got %d ranged requests", n)
+			}
+			if n := conns.Load(); n != 1 {
+				t.Errorf("Expected the probe connection to be reused, got %d connections", n)
+			}
+		})
+	}
+}
+
+// A probe answered with another range than the one asked for means the
+// server's ranges cannot be trusted; the file is downloaded in one piece
+func TestRequestGroup_RangeProbeWrongStart(t *testing.T) {
+	data := make([]byte, 2*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	var rangeGets atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "HEAD":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.Header.Get("Range") != "":
+			rangeGets.Add(1)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 100-100/%d", len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[100:101])
+		default:
+			w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "wrong-start.bin")
+	opt.Put(option.Split, "4")
+	opt.Put(option.MinSplitSize, "1M")
+
+	rg := NewRequestGroup("wrong-start-gid", []string{server.URL}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	downloaded, _ := os.ReadFile(filepath.Join(tmpDir, "wrong-start.bin"))
+	if !bytes.Equal(downloaded, data) {
+		t.Errorf("Content mismatch: got %d bytes", len(downloaded))
+	}
+	if n := rangeGets.Load(); n != 1 {
+		t.Errorf("Expected only the probe to be ranged, got %d ranged requests", n)
+	}
+}
+
 // 5. Enrich Request Logic
 func TestEnrichRequest_Headers(t *testing.T) {
 	opt := option.GetDefaultOptions()
@@ -1,17 +1,26 @@
 package engine
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/divyam234/hydra/internal/control"
+	"github.com/divyam234/hydra/internal/segment"
+	"github.com/divyam234/hydra/internal/util"
+	"github.com/divyam234/hydra/pkg/apperror"
 	"github.com/divyam234/hydra/pkg/option"
 )
 
@@ -519,3 +528,272 @@ func TestResume_InterruptAndResume(t *testing.T) {
 		t.Logf("Resume success: saved %.1f%%", float64(totalFileSize-phase2Bytes)/float64(totalFileSize)*100)
 	}
 }
+
+// TestResume_StreamHash tests that the checksum state saved in the control
+// file is continued instead of hashing the existing part of the file again
+func TestResume_StreamHash(t *testing.T) {
+	const pieceLen = 1024 * 1024
+	data := make([]byte, 4*pieceLen)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+	sum := sha256.Sum256(data)
+
+	tests := []struct {
+		name       string
+		savedUntil int64 // Bytes covered by the saved hash state
+		diskPrefix []byte
+	}{
+		// The prefix on disk is wrong, so only a restored state can verify
+		{"Restored", 2 * pieceLen, make([]byte, 2*pieceLen)},
+		// The state reaches into missing pieces and must be ignored
+		{"Ignored", 3 * pieceLen, data[:2*pieceLen]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rangeGets atomic.Int32
+			server := countingServer(t, data, &rangeGets)
+			defer server.Close()
+
+			tmpDir := t.TempDir()
+			outPath := filepath.Join(tmpDir, "hashed.dat")
+			if err := os.WriteFile(outPath, tt.diskPrefix, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			h, _ := util.NewStreamHasher("sha-256", bytes.NewReader(data))
+			if err := h.Advance(context.Background(), tt.savedUntil); err != nil {
+				t.Fatal(err)
+			}
+			offset, state, _ := h.State()
+
+			// Pieces 0 and 1 are complete
+			ps := segment.NewDefaultPieceStorage(int64(len(data)), pieceLen)
+			ps.CompletePiece(0)
+			ps.CompletePiece(1)
+			cf := control.ControlFile{
+				GID:  "hash-gid",
+				URIs: []string{server.URL},
+				Path: outPath,
+				Hash: &control.HashState{Algo: "sha-256", Offset: offset, State: state},
+			}
+			if err := control.NewController(outPath).Save(cf, ps); err != nil {
+				t.Fatal(err)
+			}
+
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, tmpDir)
+			opt.Put(option.Out, "hashed.dat")
+			opt.Put(option.Checksum, "sha-256="+hex.EncodeToString(sum[:]))
+			opt.Put(option.Split, "1")
+
+			rg := NewRequestGroup("hash-gid", []string{server.URL}, opt)
+			if err := rg.Execute(context.Background()); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			if status := rg.GetFullStatus(); !status.ChecksumVerified || !status.ChecksumOK {
+				t.Error("Expected checksum to be verified")
+			}
+			if rg.streamHasher == nil || rg.streamHasher.Offset() != int64(len(data)) {
+				t.Error("Expected the checksum to be computed while downloading")
+			}
+			if n := rangeGets.Load(); n != 2 {
+				t.Errorf("Expected 2 missing pieces to be downloaded, got %d requests", n)
+			}
+			if _, err := os.Stat(outPath + ".hydra"); err == nil {
+				t.Error("Control file should be removed after completion")
+			}
+		})
+	}
+}
+
+// versionedServer serves the current version of a file with http.ServeContent,
+// which handles Range and If-Range. HEAD requests fail if rejectHead is set,
+// range probes ("bytes=0-0") too if rejectProbe is set.
+type versionedServer struct {
+	mu          sync.Mutex
+	data        []byte
+	etag        string
+	rejectHead  bool
+	rejectProbe bool
+	rangeGets   int
+}
+
+func (v *versionedServer) set(data []byte, etag string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.data, v.etag = data, etag
+}
+
+func (v *versionedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	isProbe := r.Header.Get("Range") == "bytes=0-0"
+	v.mu.Lock()
+	data, etag := v.data, v.etag
+	if r.Method == "GET" && r.Header.Get("Range") != "" && !isProbe {
+		v.rangeGets++
+	}
+	rejectHead, rejectProbe := v.rejectHead || v.rejectProbe, v.rejectProbe
+	v.mu.Unlock()
+
+	if r.Method == "HEAD" && rejectHead || isProbe && rejectProbe {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// writeHalfDone creates a control file for the first two of four pieces of
+// oldData, downloaded while the server had the ETag etag
+func writeHalfDone(t *testing.T, outPath string, oldData []byte, etag, uri string) {
+	t.Helper()
+	pieceLen := int64(len(oldData) / 4)
+	if err := os.WriteFile(outPath, oldData[:2*pieceLen], 0644); err != nil {
+		t.Fatal(err)
+	}
+	ps := segment.NewDefaultPieceStorage(int64(len(oldData)), pieceLen)
+	ps.CompletePiece(0)
+	ps.CompletePiece(1)
+	cf := control.ControlFile{GID: "changed-gid", URIs: []string{uri}, Path: outPath, ETag: etag}
+	if err := control.NewController(outPath).Save(cf, ps); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResume_RemoteChanged(t *testing.T) {
+	oldData := bytes.Repeat([]byte("nightly-1 "), 400000)
+	newData := bytes.Repeat([]byte("nightly-2 "), 400000) // Same size
+
+	tests := []struct {
+		name         string
+		alwaysResume bool
+		rejectHead   bool
+		rejectProbe  bool
+	}{
+		{"Restart", false, false, false},
+		{"AlwaysResume", true, false, false},
+		// Detected by the range probe
+		{"RangeProbe", false, true, false},
+		// Detected by If-Range on the ranged requests
+		{"IfRange", false, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := &versionedServer{rejectHead: tt.rejectHead, rejectProbe: tt.rejectProbe}
+			vs.set(newData, `"v2"`)
+			server := httptest.NewServer(vs)
+			defer server.Close()
+
+			tmpDir := t.TempDir()
+			outPath := filepath.Join(tmpDir, "nightly.bin")
+			writeHalfDone(t, outPath, oldData, `"v1"`, server.URL)
+
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, tmpDir)
+			opt.Put(option.Out, "nightly.bin")
+			opt.Put(option.Split, "1")
+			opt.Put(option.AlwaysResume, fmt.Sprintf("%v", tt.alwaysResume))
+
+			rg := NewRequestGroup("changed-gid", []string{server.URL}, opt)
+			err := rg.Execute(context.Background())
+
+			if !tt.alwaysResume && !tt.rejectProbe {
+				if err != nil {
+					t.Fatalf("Expected a restart, got %v", err)
+				}
+				content, _ := os.ReadFile(outPath)
+				if !bytes.Equal(content, newData) {
+					t.Error("Restarted download does not match the new version")
+				}
+				return
+			}
+
+			var appErr *apperror.Error
+			if !errors.As(err, &appErr) || appErr.Code != apperror.ExitCannotResume {
+				t.Fatalf("Expected ExitCannotResume, got %v", err)
+			}
+			content, _ := os.ReadFile(outPath)
+			if bytes.Contains(content, []byte("nightly-2")) {
+				t.Error("Data of the new version was mixed into the old one")
+			}
+		})
+	}
+}
+
+func TestResume_IfRangeUnchanged(t *testing.T) {
+	data := bytes.Repeat([]byte("stable "), 600000) // Split into four pieces below
+	vs := &versionedServer{rejectProbe: true}
+	vs.set(data, `"v1"`)
+	server := httptest.NewServer(vs)
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	outPath := filepath.Join(tmpDir, "stable.bin")
+	writeHalfDone(t, outPath, data, `"v1"`, server.URL)
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "stable.bin")
+	opt.Put(option.Split, "1")
+
+	rg := NewRequestGroup("stable-gid", []string{server.URL}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	content, _ := os.ReadFile(outPath)
+	if !bytes.Equal(content, data) {
+		t.Error("Resumed file content mismatch")
+	}
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.rangeGets != 2 {
+		t.Errorf("Expected only the 2 missing pieces to be requested, got %d", vs.rangeGets)
+	}
+}
+
+// A single-connection download whose file changes between tries starts over
+// instead of appending the new file to the old one
+func TestResume_SingleIfRange(t *testing.T) {
+	v1 := bytes.Repeat([]byte("one "), 50000)
+	v2 := bytes.Repeat([]byte("two "), 50000)
+	var changed atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if changed.Load() {
+			w.Header().Set("ETag", `"v2"`)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(v2))
+			return
+		}
+		// Ranges are ignored, so the file is downloaded over a single
+		// connection
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(v1)))
+		switch {
+		case r.Method == "HEAD":
+		case r.Header.Get("Range") != "":
+			w.Write(v1)
+		default:
+			// Cut off halfway, then the file changes
+			changed.Store(true)
+			w.Write(v1[:len(v1)/2])
+		}
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "changed.bin")
+
+	rg := NewRequestGroup("single-if-range", []string{server.URL}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if !changed.Load() {
+		t.Fatal("the download was not cut off")
+	}
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "changed.bin")); !bytes.Equal(content, v2) {
+		t.Errorf("got %d bytes mixing both versions, want the new file", len(content))
+	}
+}
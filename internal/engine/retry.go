@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/divyam234/hydra/internal/retry"
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// WithRetryPolicy decides the retries of all downloads with p instead of
+// the policy built from each download's retry options
+func WithRetryPolicy(p retry.Policy) EngineOption {
+	return func(e *DownloadEngine) {
+		e.retryPolicy = p
+	}
+}
+
+// maxTries returns the number of tries of each request
+func (rg *RequestGroup) maxTries() int {
+	maxTries, _ := rg.options.GetAsInt(option.MaxTries)
+	if maxTries <= 0 {
+		maxTries = 5 // Default
+	}
+	return maxTries
+}
+
+// retryPolicy returns the policy deciding the next retry. Options may change
+// while downloading, so the policy is built each time.
+func (rg *RequestGroup) retryPolicy() retry.Policy {
+	if rg.retry != nil {
+		return rg.retry
+	}
+	initial, _ := retry.ParseWait(rg.options.Get(option.RetryWait))
+	maxWait, _ := retry.ParseWait(rg.options.Get(option.MaxRetryWait))
+	maxNotFound, _ := rg.options.GetAsInt(option.MaxFileNotFound)
+	return &retry.Backoff{
+		Initial:  initial,
+		Max:      maxWait,
+		Jitter:   retry.DefaultJitter,
+		NotFound: maxNotFound > 0,
+	}
+}
+
+// retryWait asks the retry policy whether to try again after the
+// failures-th failure in a row with err, and how long to wait. Requests
+// refused by an open circuit wait at least until the host may be tried
+// again.
+func (rg *RequestGroup) retryWait(failures int, err error) (time.Duration, bool) {
+	wait, ok := rg.retryPolicy().Retry(failures, err)
+	var circuitErr *CircuitOpenError
+	if ok && errors.As(err, &circuitErr) {
+		wait = max(wait, time.Until(circuitErr.Until))
+	}
+	return wait, ok
+}
+
+// checkNotFound counts "file not found" answers. Once max-file-not-found of
+// them arrived before a single byte was downloaded, it returns the error
+// failing the download.
+func (rg *RequestGroup) checkNotFound(err error) error {
+	if !retry.NotFound(err) {
+		return nil
+	}
+	n := rg.notFound.Add(1)
+	limit, _ := rg.options.GetAsInt(option.MaxFileNotFound)
+	if limit > 0 && n >= int64(limit) && rg.completedBytes.Load() == 0 {
+		return apperror.Wrap(apperror.ExitMaxFileNotFound, fmt.Errorf("file not found %d times: %w", n, err))
+	}
+	return nil
+}
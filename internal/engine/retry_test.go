@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func notFoundServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRequestGroup_NotFoundIsNotRetried(t *testing.T) {
+	var requests atomic.Int32
+	server := notFoundServer(t, &requests)
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxTries, "5")
+
+	rg := NewRequestGroup("notfound-gid", []string{server.URL + "/missing"}, opt)
+	if err := rg.Execute(context.Background()); err == nil {
+		t.Fatal("Execute succeeded for a missing file")
+	}
+	// One HEAD and one ranged GET, without retries
+	if n := requests.Load(); n != 2 {
+		t.Errorf("server got %d requests, want 2", n)
+	}
+}
+
+func TestRequestGroup_MaxFileNotFound(t *testing.T) {
+	var requests atomic.Int32
+	server := notFoundServer(t, &requests)
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxTries, "10")
+	opt.Put(option.MaxFileNotFound, "3")
+
+	rg := NewRequestGroup("maxnotfound-gid", []string{server.URL + "/missing"}, opt)
+	err := rg.Execute(context.Background())
+
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.Code != apperror.ExitMaxFileNotFound {
+		t.Fatalf("Execute error = %v, want ExitMaxFileNotFound", err)
+	}
+	if n := requests.Load(); n != 6 {
+		t.Errorf("server got %d requests, want 3 probes of 2", n)
+	}
+}
+
+func TestRequestGroup_HonorsRetryAfter(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	for i := range data {
+		data[i] = byte(i % 233)
+	}
+	inner := setupRangeServer(t, data)
+	defer inner.Close()
+
+	// The first download request is turned away for a second
+	var rejected atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.Header.Get("Range") != "bytes=0-0" && rejected.CompareAndSwap(false, true) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "retry-after.bin")
+	opt.Put(option.Split, "1")
+
+	rg := NewRequestGroup("retryafter-gid", []string{server.URL}, opt)
+	start := time.Now()
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("download retried after %v, before the server's Retry-After", elapsed)
+	}
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "retry-after.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+}
+
+// countingPolicy retries everything without waiting and counts its calls
+type countingPolicy struct {
+	calls atomic.Int32
+}
+
+func (p *countingPolicy) Retry(failures int, err error) (time.Duration, bool) {
+	p.calls.Add(1)
+	return 0, true
+}
+
+func TestRequestGroup_CustomRetryPolicy(t *testing.T) {
+	var requests atomic.Int32
+	server := notFoundServer(t, &requests)
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxTries, "3")
+
+	policy := &countingPolicy{}
+	rg := NewRequestGroup("policy-gid", []string{server.URL + "/missing"}, opt)
+	rg.SetRetryPolicy(policy)
+	if err := rg.Execute(context.Background()); err == nil {
+		t.Fatal("Execute succeeded for a missing file")
+	}
+	// The policy retries 404s, so every try probes the server
+	if n := requests.Load(); n != 6 {
+		t.Errorf("server got %d requests, want 3 probes of 2", n)
+	}
+	if n := policy.calls.Load(); n != 3 {
+		t.Errorf("policy was asked %d times, want 3", n)
+	}
+}
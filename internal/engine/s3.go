@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/internal/s3"
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// isS3 reports whether uri uses the s3 scheme
+func isS3(uri string) bool {
+	scheme, _, ok := strings.Cut(uri, "://")
+	return ok && strings.EqualFold(scheme, "s3")
+}
+
+// resolveS3 replaces the s3:// mirrors of the download with the HTTP(S)
+// URLs of their objects, whose requests are then signed by the S3 signer
+func (rg *RequestGroup) resolveS3() error {
+	for _, uri := range rg.mirrors.URIs() {
+		if !isS3(uri) {
+			continue
+		}
+		if rg.s3 == nil {
+			endpoint, err := rg.newS3Endpoint()
+			if err != nil {
+				return err
+			}
+			rg.s3 = endpoint
+		}
+		objectURL, err := rg.s3.ObjectURL(uri)
+		if err != nil {
+			return apperror.Wrap(apperror.ExitBadUrl, err)
+		}
+		rg.mirrors.Replace(uri, objectURL)
+	}
+	return nil
+}
+
+// newS3Endpoint returns the S3 endpoint of the download. Credentials are
+// taken from the s3-access-key and s3-secret-key options, the AWS_*
+// environment variables or the shared credentials file, in that order;
+// without any, requests are sent unsigned, which public buckets allow.
+func (rg *RequestGroup) newS3Endpoint() (*s3.Endpoint, error) {
+	creds := s3.Credentials{
+		AccessKeyID:     rg.options.Get(option.S3AccessKey),
+		SecretAccessKey: rg.options.Get(option.S3SecretKey),
+		SessionToken:    rg.options.Get(option.S3SessionToken),
+	}
+	if !creds.Valid() {
+		creds = s3.EnvCredentials()
+	}
+	if !creds.Valid() {
+		var err error
+		if creds, err = rg.sharedS3Credentials(); err != nil {
+			return nil, err
+		}
+	}
+
+	region := firstNonEmpty(rg.options.Get(option.S3Region), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+	endpoint := firstNonEmpty(rg.options.Get(option.S3Endpoint), os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	e, err := s3.NewEndpoint(endpoint, region, creds)
+	if err != nil {
+		return nil, apperror.Wrap(apperror.ExitBadUrl, err)
+	}
+	return e, nil
+}
+
+// sharedS3Credentials reads the credentials of the s3-profile option, or
+// of $AWS_PROFILE, from the shared credentials file. A profile that was
+// asked for must be usable; problems with the default profile are reported
+// and the download goes on without credentials.
+func (rg *RequestGroup) sharedS3Credentials() (s3.Credentials, error) {
+	path := s3.DefaultCredentialsPath()
+	profile := firstNonEmpty(rg.options.Get(option.S3Profile), os.Getenv("AWS_PROFILE"))
+	if profile != "" {
+		creds, err := s3.LoadSharedCredentials(path, profile)
+		if err != nil {
+			return s3.Credentials{}, apperror.Wrap(apperror.ExitOpenFile, err)
+		}
+		return creds, nil
+	}
+
+	if path == "" {
+		return s3.Credentials{}, nil
+	}
+	creds, err := s3.LoadSharedCredentials(path, "default")
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			rg.console.Printf("Ignoring %v\n", err)
+		}
+		return s3.Credentials{}, nil
+	}
+	return creds, nil
+}
+
+// authFor returns the provider authorizing requests to u: the S3 signer
+// for the S3 endpoint, otherwise the auth provider of the download
+func (rg *RequestGroup) authFor(u *url.URL) internalhttp.AuthProvider {
+	if rg.s3 != nil && rg.s3.Owns(u) {
+		if rg.s3.Signer == nil {
+			return nil
+		}
+		return rg.s3.Signer
+	}
+	return rg.auth
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/internal/s3"
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// s3Server stands in for an S3-compatible store serving data at
+// /bucket/dir/object.bin to requests signed with creds. Requests without a
+// signature are served if public is set.
+type s3Server struct {
+	*httptest.Server
+	creds  s3.Credentials
+	public bool
+
+	signed   atomic.Int32 // Ranged GETs with a valid signature
+	rejected atomic.Int32
+}
+
+func newS3Server(t *testing.T, data []byte, creds s3.Credentials) *s3Server {
+	inner := setupRangeServer(t, data)
+	t.Cleanup(inner.Close)
+	s := &s3Server{creds: creds}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/dir/object.bin" {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if auth == "" && s.public {
+			inner.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		if auth == "" || auth != s.signature(r) {
+			s.rejected.Add(1)
+			http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "" {
+			s.signed.Add(1)
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// signature returns the Authorization header r should carry, signing a
+// copy of it at its X-Amz-Date
+func (s *s3Server) signature(r *http.Request) string {
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil || r.Header.Get("X-Amz-Security-Token") != s.creds.SessionToken {
+		return ""
+	}
+	req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if rng := r.Header.Get("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	s3.NewSigner(s.creds, "eu-west-1").Sign(req, date)
+	return req.Header.Get("Authorization")
+}
+
+// isolateAWSEnv hides the AWS configuration of the machine running the tests
+func isolateAWSEnv(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_S3"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+}
+
+func TestRequestGroup_S3(t *testing.T) {
+	data := bytes.Repeat([]byte("object"), 4*1024*1024/6)
+	creds := s3.Credentials{AccessKeyID: "AKIDTEST", SecretAccessKey: "test-secret", SessionToken: "session"}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, opt *option.Option)
+	}{
+		{"options", func(t *testing.T, opt *option.Option) {
+			opt.Put(option.S3AccessKey, creds.AccessKeyID)
+			opt.Put(option.S3SecretKey, creds.SecretAccessKey)
+			opt.Put(option.S3SessionToken, creds.SessionToken)
+		}},
+		{"environment", func(t *testing.T, opt *option.Option) {
+			t.Setenv("AWS_ACCESS_KEY_ID", creds.AccessKeyID)
+			t.Setenv("AWS_SECRET_ACCESS_KEY", creds.SecretAccessKey)
+			t.Setenv("AWS_SESSION_TOKEN", creds.SessionToken)
+		}},
+		{"shared credentials file", func(t *testing.T, opt *option.Option) {
+			path := filepath.Join(t.TempDir(), "credentials")
+			os.WriteFile(path, []byte("[default]\naws_access_key_id = wrong\naws_secret_access_key = wrong\n\n"+
+				"[ci]\naws_access_key_id = AKIDTEST\naws_secret_access_key = test-secret\naws_session_token = session\n"), 0600)
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+			opt.Put(option.S3Profile, "ci")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateAWSEnv(t)
+			server := newS3Server(t, data, creds)
+
+			opt := option.GetDefaultOptions()
+			dir := t.TempDir()
+			opt.Put(option.Dir, dir)
+			opt.Put(option.Split, "4")
+			opt.Put(option.MaxConnPerServer, "4")
+			opt.Put(option.MinSplitSize, "1M")
+			opt.Put(option.MaxTries, "1")
+			opt.Put(option.S3Endpoint, server.URL)
+			opt.Put(option.S3Region, "eu-west-1")
+			tt.setup(t, opt)
+
+			rg := NewRequestGroup("s3", []string{"s3://bucket/dir/object.bin"}, opt)
+			if err := rg.Execute(context.Background()); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			got, _ := os.ReadFile(filepath.Join(dir, "object.bin"))
+			if !bytes.Equal(got, data) {
+				t.Error("content mismatch")
+			}
+			if n := server.rejected.Load(); n != 0 {
+				t.Errorf("%d requests rejected", n)
+			}
+			// The range probe and the segments
+			if n := server.signed.Load(); n < 4 {
+				t.Errorf("%d signed ranged GETs, want one per segment", n)
+			}
+			if uris := rg.controlState().URIs; len(uris) != 1 || uris[0] != "s3://bucket/dir/object.bin" {
+				t.Errorf("control file URIs = %v", uris)
+			}
+		})
+	}
+}
+
+func TestRequestGroup_S3WrongCredentials(t *testing.T) {
+	isolateAWSEnv(t)
+	server := newS3Server(t, []byte("object"), s3.Credentials{AccessKeyID: "AKIDTEST", SecretAccessKey: "test-secret"})
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxTries, "1")
+	opt.Put(option.S3Endpoint, server.URL)
+	opt.Put(option.S3Region, "eu-west-1")
+	opt.Put(option.S3AccessKey, "AKIDTEST")
+	opt.Put(option.S3SecretKey, "not-the-secret")
+	rg := NewRequestGroup("s3-wrong", []string{"s3://bucket/dir/object.bin"}, opt)
+	if code := apperror.Code(rg.Execute(context.Background())); code != apperror.ExitHttpAuth {
+		t.Errorf("exit status = %d, want ExitHttpAuth", code)
+	}
+	if server.rejected.Load() == 0 {
+		t.Error("no request rejected")
+	}
+}
+
+func TestRequestGroup_S3Anonymous(t *testing.T) {
+	isolateAWSEnv(t)
+	data := []byte("public object")
+	server := newS3Server(t, data, s3.Credentials{})
+	server.public = true
+
+	opt := option.GetDefaultOptions()
+	dir := t.TempDir()
+	opt.Put(option.Dir, dir)
+	opt.Put(option.S3Endpoint, server.URL)
+	rg := NewRequestGroup("s3-public", []string{"s3://bucket/dir/object.bin"}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "object.bin")); !bytes.Equal(got, data) {
+		t.Error("content mismatch")
+	}
+}
+
+func TestRequestGroup_S3Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		uri   string
+		setup func(opt *option.Option)
+		code  apperror.ExitStatus
+	}{
+		{"no key", "s3://bucket", nil, apperror.ExitBadUrl},
+		{"bad endpoint", "s3://bucket/key", func(opt *option.Option) { opt.Put(option.S3Endpoint, "ftp://minio") }, apperror.ExitBadUrl},
+		{"missing profile", "s3://bucket/key", func(opt *option.Option) { opt.Put(option.S3Profile, "nope") }, apperror.ExitOpenFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateAWSEnv(t)
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, t.TempDir())
+			if tt.setup != nil {
+				tt.setup(opt)
+			}
+			err := NewRequestGroup("s3-error", []string{tt.uri}, opt).Execute(context.Background())
+			if code := apperror.Code(err); code != tt.code {
+				t.Errorf("exit status = %d (%v), want %d", code, err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"os"
+	"time"
+
+	"github.com/divyam234/hydra/internal/schedule"
+)
+
+// defaultScheduleInterval is how often schedules are evaluated and the
+// schedule file is checked for changes
+const defaultScheduleInterval = 5 * time.Second
+
+// WithSchedule applies time-of-day limits and pauses to all downloads
+func WithSchedule(s *schedule.Schedule) EngineOption {
+	return func(e *DownloadEngine) {
+		e.schedule = s
+	}
+}
+
+// WithScheduleFile loads the schedule from path and reloads it whenever the
+// file changes
+func WithScheduleFile(path string) EngineOption {
+	return func(e *DownloadEngine) {
+		e.scheduleFile = path
+	}
+}
+
+// SetSchedule replaces the schedule at runtime. A nil schedule removes it.
+func (e *DownloadEngine) SetSchedule(s *schedule.Schedule) {
+	e.scheduleMu.Lock()
+	e.schedule = s
+	e.scheduleMu.Unlock()
+
+	e.startScheduler()
+	e.applySchedule()
+}
+
+// startScheduler starts evaluating the schedule periodically, once
+func (e *DownloadEngine) startScheduler() {
+	e.schedulerOnce.Do(func() {
+		e.reloadScheduleFile()
+		e.applySchedule()
+
+		go func() {
+			ticker := time.NewTicker(e.scheduleInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-e.ctx.Done():
+					return
+				case <-ticker.C:
+					e.reloadScheduleFile()
+					e.applySchedule()
+				}
+			}
+		}()
+	})
+}
+
+// reloadScheduleFile reads the schedule file again if it changed. A broken
+// file keeps the previous schedule in place.
+func (e *DownloadEngine) reloadScheduleFile() {
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+
+	if e.scheduleFile == "" {
+		return
+	}
+	info, err := os.Stat(e.scheduleFile)
+	if err == nil && info.ModTime().Equal(e.scheduleModTime) {
+		return
+	}
+
+	var s *schedule.Schedule
+	if err == nil {
+		e.scheduleModTime = info.ModTime()
+		s, err = schedule.Load(e.scheduleFile)
+	}
+	if err != nil {
+		// Report each problem once
+		if msg := err.Error(); msg != e.scheduleErr {
+			e.scheduleErr = msg
+			e.printf("Failed to load schedule, keeping the previous one: %v\n", err)
+		}
+		return
+	}
+	e.scheduleErr = ""
+	e.schedule = s
+}
+
+// applySchedule sets the overall limit and pauses or resumes downloads as
+// the schedule prescribes now. Only downloads paused by the schedule are
+// resumed by it.
+func (e *DownloadEngine) applySchedule() {
+	e.scheduleMu.Lock()
+	state := e.schedule.At(e.now())
+	limit := e.overallLimit
+	if state.Limited {
+		limit = state.Limit
+	}
+	e.scheduleMu.Unlock()
+
+	if e.overallLimiter.Limit() != limit {
+		e.overallLimiter.SetLimit(limit)
+	}
+
+	if state.Paused {
+		e.mu.RLock()
+		var active []GID
+		for gid, rg := range e.requestGroups {
+			if rg.state.Load() == RGStateActive {
+				active = append(active, gid)
+			}
+		}
+		e.mu.RUnlock()
+
+		for _, gid := range active {
+			if e.Pause(gid) {
+				e.scheduleMu.Lock()
+				e.schedulePaused[gid] = true
+				e.scheduleMu.Unlock()
+			}
+		}
+		return
+	}
+
+	e.scheduleMu.Lock()
+	paused := e.schedulePaused
+	e.schedulePaused = make(map[GID]bool)
+	e.scheduleMu.Unlock()
+	for gid := range paused {
+		e.Resume(gid)
+	}
+}
+
+// printf reports a message through the engine UI, which library users see
+// through their message callback. Without a UI it is dropped.
+func (e *DownloadEngine) printf(format string, a ...interface{}) {
+	if u := e.GetUI(); u != nil {
+		u.Printf(format, a...)
+	}
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/internal/schedule"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// newScheduledEngine returns an engine whose schedule is evaluated often,
+// against a clock set by the returned function
+func newScheduledEngine(opt *option.Option) (*DownloadEngine, func(time.Time)) {
+	var clock atomic.Int64
+	e := NewDownloadEngine(opt)
+	e.scheduleInterval = 10 * time.Millisecond
+	e.now = func() time.Time { return time.Unix(0, clock.Load()).UTC() }
+	return e, func(t time.Time) { clock.Store(t.UnixNano()) }
+}
+
+// waitFor polls cond for up to two seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSchedule_PauseAndLimit(t *testing.T) {
+	data := make([]byte, 2*1024*1024)
+	server := setupRangeServer(t, data)
+	defer server.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxOverallDownloadLimit, "1M")
+	e, setClock := newScheduledEngine(opt)
+	defer e.Shutdown()
+
+	// Monday 2026-10-12
+	setClock(time.Date(2026, 10, 12, 9, 30, 0, 0, time.UTC))
+	s, err := schedule.ParseString("weekdays 09:00-18:00 limit 64K\n* 12:00-13:00 pause\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetSchedule(s)
+	if got := e.GetMaxOverallDownloadLimit(); got != 64*1024 {
+		t.Fatalf("office hours limit = %d, want %d", got, 64*1024)
+	}
+
+	dlOpt := opt.Clone()
+	dlOpt.Put(option.Out, "scheduled.bin")
+	gid, err := e.AddURI([]string{server.URL}, dlOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rg := e.GetRequestGroup(gid)
+	waitFor(t, "download to start", func() bool { return rg.state.Load() == RGStateActive })
+
+	setClock(time.Date(2026, 10, 12, 12, 30, 0, 0, time.UTC))
+	waitFor(t, "lunch pause", rg.IsPaused)
+
+	setClock(time.Date(2026, 10, 12, 13, 30, 0, 0, time.UTC))
+	waitFor(t, "resume after lunch", func() bool { return !rg.IsPaused() })
+
+	// Outside the schedule the configured overall limit applies again
+	setClock(time.Date(2026, 10, 12, 20, 0, 0, 0, time.UTC))
+	waitFor(t, "evening limit", func() bool { return e.GetMaxOverallDownloadLimit() == 1024*1024 })
+
+	e.SetMaxOverallDownloadLimit(0)
+	if got := e.GetMaxOverallDownloadLimit(); got != 0 {
+		t.Errorf("limit after SetMaxOverallDownloadLimit = %d, want 0", got)
+	}
+	e.Cancel(gid)
+}
+
+func TestSchedule_UserPauseKept(t *testing.T) {
+	data := make([]byte, 2*1024*1024)
+	server := setupRangeServer(t, data)
+	defer server.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxDownloadLimit, "64K")
+	e, setClock := newScheduledEngine(opt)
+	defer e.Shutdown()
+
+	setClock(time.Date(2026, 10, 12, 11, 0, 0, 0, time.UTC))
+	s, _ := schedule.ParseString("* 12:00-13:00 pause")
+	e.SetSchedule(s)
+
+	dlOpt := opt.Clone()
+	dlOpt.Put(option.Out, "user.bin")
+	gid, _ := e.AddURI([]string{server.URL}, dlOpt)
+	rg := e.GetRequestGroup(gid)
+	waitFor(t, "download to start", func() bool { return rg.state.Load() == RGStateActive })
+
+	if !e.Pause(gid) {
+		t.Fatal("Pause failed")
+	}
+	setClock(time.Date(2026, 10, 12, 12, 30, 0, 0, time.UTC))
+	time.Sleep(50 * time.Millisecond)
+	setClock(time.Date(2026, 10, 12, 13, 30, 0, 0, time.UTC))
+	time.Sleep(50 * time.Millisecond)
+	if !rg.IsPaused() {
+		t.Error("the schedule resumed a download paused by the user")
+	}
+	e.Cancel(gid)
+}
+
+func TestSchedule_FileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.conf")
+	if err := os.WriteFile(path, []byte("* 00:00-24:00 limit 1M\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := option.GetDefaultOptions()
+	e, setClock := newScheduledEngine(opt)
+	defer e.Shutdown()
+	setClock(time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC))
+
+	e.scheduleFile = path
+	e.startScheduler()
+	if got := e.GetMaxOverallDownloadLimit(); got != 1024*1024 {
+		t.Fatalf("limit = %d, want 1M", got)
+	}
+
+	// A broken file keeps the previous schedule
+	os.WriteFile(path, []byte("* 00:00-24:00 limit\n"), 0644)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	time.Sleep(50 * time.Millisecond)
+	if got := e.GetMaxOverallDownloadLimit(); got != 1024*1024 {
+		t.Errorf("limit after broken reload = %d, want 1M", got)
+	}
+
+	os.WriteFile(path, []byte("* 00:00-24:00 limit 2M\n"), 0644)
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second))
+	waitFor(t, "schedule reload", func() bool { return e.GetMaxOverallDownloadLimit() == 2*1024*1024 })
+}
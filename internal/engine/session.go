@@ -56,7 +56,7 @@ func (sm *SessionManager) Save(engine *DownloadEngine) error {
 
 		entry := SessionEntry{
 			GID:      gid,
-			URIs:     rg.uris,
+			URIs:     rg.currentURIs(),
 			Options:  rg.options.ToMap(),
 			State:    state,
 			Priority: rg.priority,
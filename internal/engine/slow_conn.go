@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// slowConnRatio is the fraction of the median throughput below which a
+	// connection is dropped
+	slowConnRatio = 0.25
+
+	// slowConnMinConns is the number of measured connections needed to
+	// judge one of them slow
+	slowConnMinConns = 3
+
+	// defaultSlowCheckInterval is how often connection throughput is compared
+	defaultSlowCheckInterval = 10 * time.Second
+)
+
+// connMonitor tracks the throughput of each worker's connection and drops
+// connections running far below the median, so that a single throttled
+// stream does not hold up the download. The worker then continues its range
+// on a fresh connection, from the next mirror if there is one.
+type connMonitor struct {
+	mu        sync.Mutex
+	conns     map[int]*connStat // By worker ID
+	evictions atomic.Int64
+}
+
+// connStat is the throughput of one connection
+type connStat struct {
+	segIndex  int // Segment the connection downloads
+	bytes     atomic.Int64
+	evicted   atomic.Bool
+	lastBytes int64
+	lastCheck time.Time
+	cancel    context.CancelFunc
+}
+
+func newConnMonitor() *connMonitor {
+	return &connMonitor{conns: make(map[int]*connStat)}
+}
+
+// start registers the connection of worker id downloading segment segIndex.
+// Bytes read on it must be added to the returned stat; the returned context
+// is cancelled if the connection is dropped.
+func (m *connMonitor) start(ctx context.Context, id, segIndex int) (*connStat, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &connStat{segIndex: segIndex, lastCheck: time.Now(), cancel: cancel}
+
+	m.mu.Lock()
+	m.conns[id] = c
+	m.mu.Unlock()
+	return c, ctx
+}
+
+// finish unregisters the connection c of worker id
+func (m *connMonitor) finish(id int, c *connStat) {
+	m.mu.Lock()
+	if m.conns[id] == c {
+		delete(m.conns, id)
+	}
+	m.mu.Unlock()
+	c.cancel()
+}
+
+// dropFinished cancels the connections whose segment is no longer active,
+// such as a duplicate request of a range that has been completed
+func (m *connMonitor) dropFinished(active func(segIndex int) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.conns {
+		if !active(c.segIndex) {
+			c.cancel()
+		}
+	}
+}
+
+// check measures the throughput of each connection since the last check and
+// drops those far below the median. Connections measured for less than
+// minAge and connections already dropped are left out. It returns the
+// number of dropped connections.
+func (m *connMonitor) check(now time.Time, minAge time.Duration) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type measured struct {
+		conn  *connStat
+		speed float64
+	}
+	var conns []measured
+	for _, c := range m.conns {
+		elapsed := now.Sub(c.lastCheck)
+		if elapsed < minAge || c.evicted.Load() {
+			continue
+		}
+		bytes := c.bytes.Load()
+		conns = append(conns, measured{c, float64(bytes-c.lastBytes) / elapsed.Seconds()})
+		c.lastBytes, c.lastCheck = bytes, now
+	}
+	if len(conns) < slowConnMinConns {
+		return 0
+	}
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].speed < conns[j].speed })
+	median := conns[len(conns)/2].speed
+	if len(conns)%2 == 0 {
+		median = (median + conns[len(conns)/2-1].speed) / 2
+	}
+
+	evicted := 0
+	for _, c := range conns {
+		if c.speed >= median*slowConnRatio {
+			break
+		}
+		c.conn.evicted.Store(true)
+		c.conn.cancel()
+		evicted++
+	}
+	m.evictions.Add(int64(evicted))
+	return evicted
+}
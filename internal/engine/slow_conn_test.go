@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+func TestConnMonitor_Check(t *testing.T) {
+	m := newConnMonitor()
+	start := time.Now()
+
+	var stats []*connStat
+	var ctxs []context.Context
+	for id := 0; id < 4; id++ {
+		c, ctx := m.start(context.Background(), id, id)
+		c.lastCheck = start
+		stats, ctxs = append(stats, c), append(ctxs, ctx)
+	}
+	stats[0].bytes.Store(1000)
+	stats[1].bytes.Store(1100)
+	stats[2].bytes.Store(900)
+	stats[3].bytes.Store(100) // Far below the median of 950
+
+	if n := m.check(start.Add(time.Second), 500*time.Millisecond); n != 1 {
+		t.Fatalf("check evicted %d connections, want 1", n)
+	}
+	if !stats[3].evicted.Load() || ctxs[3].Err() == nil {
+		t.Error("slow connection was not dropped")
+	}
+	for i := 0; i < 3; i++ {
+		if stats[i].evicted.Load() || ctxs[i].Err() != nil {
+			t.Errorf("connection %d dropped", i)
+		}
+	}
+
+	// Throughput is measured per interval, not since the start
+	stats[0].bytes.Add(100)
+	stats[1].bytes.Add(1000)
+	stats[2].bytes.Add(1000)
+	if n := m.check(start.Add(2*time.Second), 500*time.Millisecond); n != 1 || !stats[0].evicted.Load() {
+		t.Errorf("check evicted %d connections, want the one that slowed down", n)
+	}
+
+	// Too few connections to judge
+	m.finish(0, stats[0])
+	m.finish(3, stats[3])
+	stats[1].bytes.Add(10)
+	stats[2].bytes.Add(1000)
+	if n := m.check(start.Add(3*time.Second), 500*time.Millisecond); n != 0 {
+		t.Errorf("check evicted %d of 2 connections, want 0", n)
+	}
+	if got := m.evictions.Load(); got != 2 {
+		t.Errorf("evictions = %d, want 2", got)
+	}
+}
+
+func TestRequestGroup_EvictsSlowConnection(t *testing.T) {
+	data := make([]byte, 8*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 239)
+	}
+	inner := setupRangeServer(t, data)
+	defer inner.Close()
+
+	// The first request for the start of the file is throttled to a trickle
+	var throttled, retried atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perConn := 1024 * 1024
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") && r.Header.Get("Range") != "bytes=0-0" {
+			if throttled.CompareAndSwap(false, true) {
+				perConn = 8 * 1024
+			}
+		} else if throttled.Load() && strings.HasSuffix(r.Header.Get("Range"), "-1048575") {
+			retried.Store(true)
+		}
+		inner.Config.Handler.ServeHTTP(&slowWriter{ResponseWriter: w, perConn: perConn}, r)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, tmpDir)
+	opt.Put(option.Out, "evict.bin")
+	opt.Put(option.Split, "4")
+	opt.Put(option.MaxConnPerServer, "4")
+	opt.Put(option.MaxPiecesPerSegment, "1")
+
+	rg := NewRequestGroup("evict-gid", []string{server.URL}, opt)
+	rg.slowCheckInterval = 300 * time.Millisecond
+
+	start := time.Now()
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	// The throttled range alone would take two minutes
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Errorf("download took %v", elapsed)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "evict.bin"))
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+	if rg.conns.evictions.Load() == 0 {
+		t.Error("slow connection was not dropped")
+	}
+	if !retried.Load() {
+		t.Error("the rest of the slow range was not requested again")
+	}
+}
@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// selfSigned returns a self-signed certificate for localhost, which is its
+// own CA, and the certificate in PEM
+func selfSigned(t *testing.T, usage x509.ExtKeyUsage) (tls.Certificate, []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	cert, _ := tls.X509KeyPair(certPEM, keyPEM)
+	return cert, append(certPEM, keyPEM...)
+}
+
+// tlsServer serves data over TLS to clients with the certificate in its
+// clientCAs, counting handshakes. It returns the server and its URL on
+// localhost, for which the server name is sent.
+func tlsServer(t *testing.T, data []byte, clientCAs *x509.CertPool) (*httptest.Server, string, *atomic.Int32) {
+	t.Helper()
+	inner := setupRangeServer(t, data)
+	t.Cleanup(inner.Close)
+	serverCert, _ := selfSigned(t, x509.ExtKeyUsageServerAuth)
+	var handshakes atomic.Int32
+	server := httptest.NewUnstartedServer(inner.Config.Handler)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			handshakes.Add(1)
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/file.bin", &handshakes
+}
+
+func TestDownloadEngine_PerDownloadTLS(t *testing.T) {
+	data := bytes.Repeat([]byte("mtls"), 512*1024)
+	clientCert, clientPEM := selfSigned(t, x509.ExtKeyUsageClientAuth)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+	server, url, _ := tlsServer(t, data, clientCAs)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	certFile := filepath.Join(dir, "client.pem")
+	os.WriteFile(certFile, clientPEM, 0600)
+	sum := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+
+	// The engine has no TLS options; the download brings its own and gets
+	// a transport of its own
+	e := NewDownloadEngine(option.GetDefaultOptions())
+	defer e.Shutdown()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, dir)
+	opt.Put(option.Out, "mtls.bin")
+	opt.Put(option.Split, "4")
+	opt.Put(option.MaxConnPerServer, "4")
+	opt.Put(option.MinSplitSize, "1M")
+	opt.Put(option.CACertificate, caFile)
+	opt.Put(option.Certificate, certFile)
+	opt.Put(option.MinTLSVersion, "1.2")
+	opt.Put(option.PinnedPubkey, "localhost=sha256//"+base64.StdEncoding.EncodeToString(sum[:]))
+	gid, err := e.AddURI([]string{url}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.wg.Wait()
+	if err := e.GetRequestGroup(gid).GetFullStatus().Error; err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "mtls.bin")); !bytes.Equal(got, data) {
+		t.Error("content mismatch")
+	}
+}
+
+func TestRequestGroup_PinMismatch(t *testing.T) {
+	clientCert, clientPEM := selfSigned(t, x509.ExtKeyUsageClientAuth)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+	_, url, handshakes := tlsServer(t, []byte("pinned"), clientCAs)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	os.WriteFile(certFile, clientPEM, 0600)
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, dir)
+	opt.Put(option.CheckCertificate, "false")
+	opt.Put(option.Certificate, certFile)
+	opt.Put(option.PinnedPubkey, "localhost=sha256//"+base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)))
+	err := NewRequestGroup("pin", []string{url}, opt).Execute(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "pinned") {
+		t.Fatalf("Execute = %v, want a pin mismatch", err)
+	}
+	if code := apperror.Code(err); code != apperror.ExitHttpAuth {
+		t.Errorf("exit status = %d, want %d", code, apperror.ExitHttpAuth)
+	}
+	// Not retried: one handshake for the HEAD request, one for the GET probe
+	if n := handshakes.Load(); n > 2 {
+		t.Errorf("%d handshakes, want the mismatch not to be retried", n)
+	}
+}
+
+func TestRequestGroup_TLSOptionErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		code  apperror.ExitStatus
+	}{
+		{"missing CA file", option.CACertificate, "/nonexistent/ca.pem", apperror.ExitOpenFile},
+		{"missing certificate", option.Certificate, "/nonexistent/client.pem", apperror.ExitOpenFile},
+		{"bad version", option.MinTLSVersion, "2.0", apperror.ExitOptionParse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := option.GetDefaultOptions()
+			opt.Put(option.Dir, t.TempDir())
+			opt.Put(tt.key, tt.value)
+			err := NewRequestGroup("tls-error", []string{"https://localhost/file.bin"}, opt).Execute(context.Background())
+			if code := apperror.Code(err); code != tt.code {
+				t.Errorf("exit status = %d (%v), want %d", code, err, tt.code)
+			}
+		})
+	}
+}
+
+func TestDownloadEngine_TLSOptionError(t *testing.T) {
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.CACertificate, "/nonexistent/ca.pem")
+	e := NewDownloadEngine(opt)
+	defer e.Shutdown()
+
+	// Downloads that would share the engine's transport are refused
+	_, err := e.AddURI([]string{"https://localhost/file.bin"}, opt.Clone())
+	if code := apperror.Code(err); code != apperror.ExitOpenFile {
+		t.Errorf("AddURI exit status = %d (%v), want %d", code, err, apperror.ExitOpenFile)
+	}
+
+	// A download with TLS options of its own does not need it
+	own := opt.Clone()
+	own.Put(option.CACertificate, "")
+	gid, err := e.AddURI([]string{"https://localhost:1/file.bin"}, own)
+	if err != nil {
+		t.Fatalf("AddURI with own TLS options: %v", err)
+	}
+	e.Cancel(gid)
+}
+
+func TestDownloadEngine_LoadSessionSharesTransport(t *testing.T) {
+	dir := t.TempDir()
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, dir)
+	session := filepath.Join(dir, "session.json")
+	e := NewDownloadEngine(opt, WithSessionFile(session))
+	defer e.Shutdown()
+
+	saved := Session{Downloads: []SessionEntry{
+		{GID: "restored", URIs: []string{"https://localhost/file.bin"}, Options: opt.ToMap(), State: RGStatePaused},
+	}}
+	data, _ := json.Marshal(saved)
+	os.WriteFile(session, data, 0644)
+	if err := e.LoadSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	if rg := e.GetRequestGroup("restored"); rg == nil || rg.httpTransport != e.sharedTransport {
+		t.Error("restored download does not use the shared transport")
+	}
+}
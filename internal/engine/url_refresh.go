@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	internalhttp "github.com/divyam234/hydra/internal/http"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// URLRefresher returns a new URL for oldURL once the server stopped
+// accepting it, e.g. a presigned URL that expired
+type URLRefresher func(ctx context.Context, oldURL string) (string, error)
+
+// WithURLRefresher refreshes the expired URLs of all downloads with f, in
+// place of their url-refresh-command
+func WithURLRefresher(f URLRefresher) EngineOption {
+	return func(e *DownloadEngine) {
+		e.urlRefresher = f
+	}
+}
+
+// urlExpired reports whether err is the answer of a server that no longer
+// accepts a URL: 401 Unauthorized, 403 Forbidden or 410 Gone
+func urlExpired(err error) bool {
+	var statusErr *internalhttp.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.Code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// refresher returns the hook refreshing expired URLs, nil if there is none
+func (rg *RequestGroup) refresher() URLRefresher {
+	if rg.urlRefresher != nil {
+		return rg.urlRefresher
+	}
+	if command := rg.options.Get(option.URLRefreshCommand); command != "" {
+		return commandRefresher(command)
+	}
+	return nil
+}
+
+// commandRefresher runs command with the shell and takes the first line it
+// prints as the new URL. The old URL is passed in HYDRA_URL.
+func commandRefresher(command string) URLRefresher {
+	return func(ctx context.Context, oldURL string) (string, error) {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", command)
+		}
+		cmd.Env = append(os.Environ(), "HYDRA_URL="+oldURL)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("%w: %s", err, msg)
+			}
+			return "", err
+		}
+		line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		if line = strings.TrimSpace(line); line == "" {
+			return "", fmt.Errorf("command printed no URL")
+		}
+		return line, nil
+	}
+}
+
+// refreshURI replaces uri, which the server stopped accepting, with a new
+// URL from the refresher, in the mirrors, the control file and the session.
+// Workers failing on the same URL share one refresh. It returns false if
+// there is no refresher or it failed.
+func (rg *RequestGroup) refreshURI(ctx context.Context, uri string) (string, bool) {
+	refresh := rg.refresher()
+	if refresh == nil {
+		return "", false
+	}
+	rg.refreshMu.Lock()
+	defer rg.refreshMu.Unlock()
+
+	// Another worker may have refreshed the URL already
+	if next, ok := rg.refreshed[uri]; ok {
+		for i := 0; i < len(rg.refreshed); i++ {
+			newer, ok := rg.refreshed[next]
+			if !ok {
+				break
+			}
+			next = newer
+		}
+		return next, true
+	}
+
+	next, err := refresh(ctx, uri)
+	if err == nil && next == uri {
+		err = fmt.Errorf("got the same URL")
+	}
+	if err == nil {
+		err = checkURI(next)
+	}
+	if err != nil {
+		rg.console.Printf("Could not refresh expired URL: %v\n", err)
+		return "", false
+	}
+	if rg.refreshed == nil {
+		rg.refreshed = make(map[string]string)
+	}
+	rg.refreshed[uri] = next
+
+	rg.mirrors.Replace(uri, next)
+	rg.stateMu.Lock()
+	uris := make([]string, len(rg.uris))
+	for i, u := range rg.uris {
+		if u == uri {
+			u = next
+		}
+		uris[i] = u
+	}
+	rg.uris = uris
+	if rg.validatorURI == uri {
+		rg.validatorURI = next
+	}
+	rg.stateMu.Unlock()
+	rg.saveControlFile()
+	return next, true
+}
+
+// currentURIs returns the URIs of the download, with expired URLs replaced
+// by their refreshed ones
+func (rg *RequestGroup) currentURIs() []string {
+	rg.stateMu.RLock()
+	defer rg.stateMu.RUnlock()
+	return rg.uris
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/divyam234/hydra/pkg/apperror"
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// signingServer serves data to URLs carrying its current signature. The
+// first signature expires after uses ranged requests; later ones never do.
+type signingServer struct {
+	*httptest.Server
+	uses int
+
+	mu      sync.Mutex
+	current int
+	used    int
+	signed  atomic.Int32 // Calls of refresh
+}
+
+func newSigningServer(t *testing.T, data []byte, uses int) *signingServer {
+	inner := setupRangeServer(t, data)
+	t.Cleanup(inner.Close)
+	s := &signingServer{uses: uses, current: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		ok := r.URL.Query().Get("sig") == fmt.Sprint(s.current)
+		if ok && s.current == 1 && r.Header.Get("Range") != "" {
+			s.used++
+			ok = s.used <= s.uses
+		}
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "Request has expired", http.StatusForbidden)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *signingServer) url(sig int) string {
+	return fmt.Sprintf("%s/file.bin?sig=%d", s.URL, sig)
+}
+
+// refresh signs the URL again
+func (s *signingServer) refresh(ctx context.Context, oldURL string) (string, error) {
+	s.signed.Add(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current++
+	return s.url(s.current), nil
+}
+
+func TestRequestGroup_URLRefresh(t *testing.T) {
+	data := bytes.Repeat([]byte("signed"), 8*1024*1024/6)
+	tests := []struct {
+		name  string
+		start int // Signature of the URL the download starts with
+	}{
+		{"expires mid-download", 1},
+		{"expired before the probe", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSigningServer(t, data, 3)
+
+			opt := option.GetDefaultOptions()
+			dir := t.TempDir()
+			opt.Put(option.Dir, dir)
+			opt.Put(option.Out, "signed.bin")
+			opt.Put(option.Split, "8")
+			opt.Put(option.MaxConnPerServer, "4")
+			opt.Put(option.MinSplitSize, "1M")
+			opt.Put(option.MaxTries, "1") // Only the refresh may retry
+
+			rg := NewRequestGroup("url-refresh", []string{server.url(tt.start)}, opt)
+			rg.SetURLRefresher(server.refresh)
+			if err := rg.Execute(context.Background()); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			got, _ := os.ReadFile(filepath.Join(dir, "signed.bin"))
+			if !bytes.Equal(got, data) {
+				t.Error("content mismatch")
+			}
+
+			// Workers failing together share one refresh
+			if n := server.signed.Load(); n != 1 {
+				t.Errorf("URL refreshed %d times, want 1", n)
+			}
+			if uris := rg.controlState().URIs; len(uris) != 1 || uris[0] != server.url(2) {
+				t.Errorf("control file URIs = %v, want [%s]", uris, server.url(2))
+			}
+		})
+	}
+}
+
+func TestRequestGroup_URLRefreshFails(t *testing.T) {
+	server := newSigningServer(t, []byte("signed data"), 0)
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Dir, t.TempDir())
+	opt.Put(option.MaxTries, "1")
+	rg := NewRequestGroup("url-refresh-fails", []string{server.url(0)}, opt)
+	var calls atomic.Int32
+	rg.SetURLRefresher(func(ctx context.Context, oldURL string) (string, error) {
+		calls.Add(1)
+		return "", errors.New("signing service down")
+	})
+	if code := apperror.Code(rg.Execute(context.Background())); code != apperror.ExitHttpAuth {
+		t.Errorf("exit status = %d, want ExitHttpAuth", code)
+	}
+	if calls.Load() == 0 {
+		t.Error("refresher not called")
+	}
+	if uris := rg.currentURIs(); uris[0] != server.url(0) {
+		t.Errorf("URIs = %v after a failed refresh", uris)
+	}
+}
+
+func TestCommandRefresher(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	got, err := commandRefresher(`echo "$HYDRA_URL&sig=2"; echo ignored`)(context.Background(), "https://example.com/f?x=1")
+	if err != nil || got != "https://example.com/f?x=1&sig=2" {
+		t.Errorf("refresh = %q, %v", got, err)
+	}
+
+	_, err = commandRefresher(`echo "token expired" >&2; exit 3`)(context.Background(), "https://example.com/f")
+	if err == nil || !strings.Contains(err.Error(), "token expired") {
+		t.Errorf("failing command: %v", err)
+	}
+	if _, err := commandRefresher("true")(context.Background(), "https://example.com/f"); err == nil {
+		t.Error("command without output succeeded")
+	}
+}
+
+func TestRequestGroup_URLRefreshCommandOption(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	data := []byte("signed data")
+	server := newSigningServer(t, data, 100)
+
+	opt := option.GetDefaultOptions()
+	dir := t.TempDir()
+	opt.Put(option.Dir, dir)
+	opt.Put(option.Out, "signed.bin")
+	opt.Put(option.MaxTries, "1")
+	opt.Put(option.URLRefreshCommand, "echo "+server.url(1))
+
+	rg := NewRequestGroup("url-refresh-command", []string{server.url(0)}, opt)
+	if err := rg.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "signed.bin")); !bytes.Equal(got, data) {
+		t.Error("content mismatch")
+	}
+}
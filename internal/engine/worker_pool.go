@@ -0,0 +1,94 @@
+package engine
+
+import "sync"
+
+// workerPool runs the download workers of a request group and lets their
+// number change while the download runs. Workers above the target number
+// retire between segments.
+type workerPool struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	run     func(id int)
+	running []bool // By worker ID
+	gen     []int  // Incremented each time a worker ID is started
+	live    int
+	target  int
+	closed  bool // All workers finished, no new ones may start
+}
+
+func newWorkerPool(run func(id int)) *workerPool {
+	return &workerPool{run: run}
+}
+
+// resize sets the number of workers, starting the missing ones. It does
+// nothing once all workers have finished.
+func (p *workerPool) resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.target = n
+	for id := 0; id < n; id++ {
+		for len(p.running) <= id {
+			p.running = append(p.running, false)
+			p.gen = append(p.gen, 0)
+		}
+		if p.running[id] {
+			continue
+		}
+		p.running[id] = true
+		p.gen[id]++
+		p.live++
+		p.wg.Add(1)
+		go func(gen int) {
+			defer p.done(id, gen)
+			p.run(id)
+		}(p.gen[id])
+	}
+}
+
+// retire reports whether worker id is above the target number. If so the
+// worker no longer counts as running and must return.
+func (p *workerPool) retire(id int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id < p.target || !p.running[id] {
+		return false
+	}
+	p.stop(id)
+	return true
+}
+
+// done records that a worker returned. A retired worker has already been
+// accounted for and its ID may have been started again.
+func (p *workerPool) done(id, gen int) {
+	p.mu.Lock()
+	if p.gen[id] == gen && p.running[id] {
+		p.stop(id)
+	}
+	p.mu.Unlock()
+	p.wg.Done()
+}
+
+func (p *workerPool) stop(id int) {
+	p.running[id] = false
+	p.live--
+	if p.live == 0 {
+		p.closed = true
+	}
+}
+
+// size returns the target number of workers
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.target
+}
+
+// wait blocks until all workers have returned
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
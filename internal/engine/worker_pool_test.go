@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerPool_Resize(t *testing.T) {
+	finish := make(chan struct{})
+	var p *workerPool
+	p = newWorkerPool(func(id int) {
+		for {
+			if p.retire(id) {
+				return
+			}
+			select {
+			case <-finish:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	})
+	live := func() int {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.live
+	}
+
+	p.resize(2)
+	if live() != 2 {
+		t.Fatalf("live = %d, want 2", live())
+	}
+	p.resize(4)
+	if live() != 4 || p.size() != 4 {
+		t.Fatalf("live = %d, size = %d; want 4, 4", live(), p.size())
+	}
+
+	p.resize(1)
+	waitFor(t, "workers to retire", func() bool { return live() == 1 })
+
+	// Retired IDs start again
+	p.resize(3)
+	if live() != 3 {
+		t.Fatalf("live = %d after growing again, want 3", live())
+	}
+
+	close(finish)
+	p.wait()
+
+	// Finished pools do not start workers
+	p.resize(2)
+	if live() != 0 {
+		t.Errorf("live = %d after all workers returned, want 0", live())
+	}
+}
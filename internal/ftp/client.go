@@ -0,0 +1,246 @@
+// Package ftp implements the subset of FTP and FTPS needed to download files:
+// passive and active transfers, REST-based ranged retrieval, SIZE and MDTM.
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUser and DefaultPassword are used when no credentials are given
+const (
+	DefaultUser     = "anonymous"
+	DefaultPassword = "hydra@"
+)
+
+// CredentialsFunc returns the login for a host, ok is false if there is none
+type CredentialsFunc func(host string) (user, password string, ok bool)
+
+// Config holds the settings shared by all connections of a Client
+type Config struct {
+	User         string          // Used when the URL has no user info
+	Password     string          // Used when the URL has no user info
+	Credentials  CredentialsFunc // Per-host login, used without User and user info
+	Active       bool            // Use active (PORT) instead of passive mode
+	ExplicitTLS  bool            // Upgrade ftp:// connections with AUTH TLS
+	TLSConfig    *tls.Config     // Required for ftps:// and ExplicitTLS
+	DialTimeout  time.Duration   // Timeout for establishing connections
+	ReplyTimeout time.Duration   // Timeout for each control reply
+}
+
+// Client downloads files over FTP, keeping idle control connections for reuse
+type Client struct {
+	cfg  Config
+	mu   sync.Mutex
+	idle map[string][]*Conn
+}
+
+// NewClient creates a new Client
+func NewClient(cfg Config) *Client {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 30 * time.Second
+	}
+	if cfg.ReplyTimeout <= 0 {
+		cfg.ReplyTimeout = 30 * time.Second
+	}
+	return &Client{
+		cfg:  cfg,
+		idle: make(map[string][]*Conn),
+	}
+}
+
+// Stat returns the size and modification time of the file at u
+func (c *Client) Stat(ctx context.Context, u *url.URL) (*FileInfo, error) {
+	var info *FileInfo
+	err := c.withConn(ctx, u, func(conn *Conn) error {
+		var err error
+		info, err = conn.Stat(filePath(u))
+		return err
+	}, true)
+	return info, err
+}
+
+// OpenRange returns a reader over length bytes of the file at u starting at offset.
+// A negative length reads to the end of the file.
+func (c *Client) OpenRange(ctx context.Context, u *url.URL, offset, length int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := c.withConn(ctx, u, func(conn *Conn) error {
+		data, err := conn.Retr(ctx, filePath(u), offset)
+		if err != nil {
+			return err
+		}
+
+		r := &dataReader{
+			client: c,
+			key:    connKey(u),
+			conn:   conn,
+			data:   data,
+			r:      data,
+			length: length,
+		}
+		if length >= 0 {
+			r.r = io.LimitReader(data, length)
+		}
+		r.stop = context.AfterFunc(ctx, func() { data.Close() })
+		rc = r
+		return nil
+	}, false)
+	return rc, err
+}
+
+// CloseIdleConnections closes all pooled control connections
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = make(map[string][]*Conn)
+	c.mu.Unlock()
+
+	for _, conns := range idle {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+}
+
+// withConn runs fn on a pooled or new connection. If fn fails on a pooled
+// connection that went stale, it is retried once on a fresh connection.
+// When release is set, the connection is returned to the pool after fn succeeds.
+func (c *Client) withConn(ctx context.Context, u *url.URL, fn func(*Conn) error, release bool) error {
+	key := connKey(u)
+	for attempt := 0; ; attempt++ {
+		conn, reused, err := c.getConn(ctx, u, key)
+		if err != nil {
+			return err
+		}
+
+		err = fn(conn)
+		if err == nil {
+			if release {
+				c.putConn(key, conn)
+			}
+			return nil
+		}
+
+		if isNetError(err) {
+			conn.Close()
+			if reused && attempt == 0 && ctx.Err() == nil {
+				continue
+			}
+		} else {
+			// The server answered, so the connection is still usable
+			c.putConn(key, conn)
+		}
+		return err
+	}
+}
+
+func (c *Client) getConn(ctx context.Context, u *url.URL, key string) (*Conn, bool, error) {
+	c.mu.Lock()
+	if conns := c.idle[key]; len(conns) > 0 {
+		conn := conns[len(conns)-1]
+		c.idle[key] = conns[:len(conns)-1]
+		c.mu.Unlock()
+		return conn, true, nil
+	}
+	c.mu.Unlock()
+
+	user, pass := c.cfg.User, c.cfg.Password
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	} else if user == "" && c.cfg.Credentials != nil {
+		if login, password, ok := c.cfg.Credentials(u.Hostname()); ok {
+			user, pass = login, password
+		}
+	}
+	if user == "" {
+		user, pass = DefaultUser, DefaultPassword
+	}
+
+	implicitTLS := strings.EqualFold(u.Scheme, "ftps")
+	conn, err := dial(ctx, hostPort(u), implicitTLS, &c.cfg, user, pass)
+	if err != nil {
+		return nil, false, err
+	}
+	return conn, false, nil
+}
+
+func (c *Client) putConn(key string, conn *Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.idle[key] = append(c.idle[key], conn)
+}
+
+// dataReader reads a transfer and hands the control connection back when closed
+type dataReader struct {
+	client *Client
+	key    string
+	conn   *Conn
+	data   net.Conn
+	r      io.Reader
+	length int64
+	read   int64
+	stop   func() bool
+	closed bool
+}
+
+func (r *dataReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if err == io.EOF && r.length >= 0 && r.read < r.length {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Close ends the transfer. Closing before all data was read aborts it.
+func (r *dataReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.stop()
+	r.data.Close()
+
+	if err := r.conn.Finish(); err != nil {
+		r.conn.Close()
+		if isNetError(err) {
+			// Connection state is unknown, the data itself may still be complete
+			return nil
+		}
+		return err
+	}
+	r.client.putConn(r.key, r.conn)
+	return nil
+}
+
+// filePath returns the path to retrieve, relative to the login directory (RFC 1738)
+func filePath(u *url.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "21"
+	if strings.EqualFold(u.Scheme, "ftps") {
+		port = "990"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func connKey(u *url.URL) string {
+	user := ""
+	if u.User != nil {
+		user = u.User.Username()
+	}
+	return fmt.Sprintf("%s://%s@%s", strings.ToLower(u.Scheme), user, hostPort(u))
+}
@@ -0,0 +1,417 @@
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is a negative reply received from an FTP server
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ftp: %d %s", e.Code, e.Message)
+}
+
+// Permanent reports whether the reply is a permanent negative completion (5xx)
+func (e *Error) Permanent() bool {
+	return e.Code >= 500 && e.Code < 600
+}
+
+// FileInfo describes a remote file
+type FileInfo struct {
+	Size    int64     // -1 if the server does not support SIZE
+	ModTime time.Time // Zero if the server does not support MDTM
+}
+
+// Conn is a single logged-in FTP control connection
+type Conn struct {
+	conn      net.Conn
+	text      *textproto.Conn
+	host      string
+	tlsConfig *tls.Config // Used for data connections when protected is set
+	protected bool        // PROT P was accepted
+	passive   bool
+	noEPSV    bool // Server rejected EPSV, use PASV
+	timeout   time.Duration
+}
+
+// dial opens a control connection and logs in
+func dial(ctx context.Context, addr string, implicitTLS bool, cfg *Config, user, pass string) (*Conn, error) {
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	c := &Conn{
+		conn:    nc,
+		host:    host,
+		passive: !cfg.Active,
+		timeout: cfg.ReplyTimeout,
+	}
+	if cfg.TLSConfig != nil {
+		c.tlsConfig = cfg.TLSConfig.Clone()
+		if c.tlsConfig.ServerName == "" {
+			c.tlsConfig.ServerName = host
+		}
+		// Data connections must resume the control session on most servers
+		if c.tlsConfig.ClientSessionCache == nil {
+			c.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(4)
+		}
+	}
+
+	// Abort the handshake if the context is cancelled
+	stop := context.AfterFunc(ctx, func() { nc.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if implicitTLS {
+		if c.tlsConfig == nil {
+			nc.Close()
+			return nil, fmt.Errorf("ftp: TLS is not configured")
+		}
+		tc := tls.Client(nc, c.tlsConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		c.conn = tc
+	}
+	c.text = textproto.NewConn(c.conn)
+
+	if err := c.login(ctx, implicitTLS, cfg.ExplicitTLS, user, pass); err != nil {
+		c.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	c.conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (c *Conn) login(ctx context.Context, implicitTLS, explicitTLS bool, user, pass string) error {
+	if _, _, err := c.readReply(2); err != nil {
+		return err
+	}
+
+	if explicitTLS && !implicitTLS {
+		if c.tlsConfig == nil {
+			return fmt.Errorf("ftp: TLS is not configured")
+		}
+		if _, _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			return err
+		}
+		tc := tls.Client(c.conn, c.tlsConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		c.conn = tc
+		c.text = textproto.NewConn(c.conn)
+	}
+
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	switch {
+	case code == 331 || code == 332:
+		if _, _, err := c.cmd(2, "PASS %s", pass); err != nil {
+			return err
+		}
+	case code/100 != 2:
+		return &Error{Code: code, Message: "login rejected"}
+	}
+
+	if implicitTLS || explicitTLS {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+		c.protected = true
+	}
+
+	_, _, err = c.cmd(2, "TYPE I")
+	return err
+}
+
+// Stat returns the size and modification time of path
+func (c *Conn) Stat(path string) (*FileInfo, error) {
+	info := &FileInfo{Size: -1}
+
+	code, msg, err := c.cmd(0, "SIZE %s", path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case code == 213:
+		size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ftp: invalid SIZE reply %q", msg)
+		}
+		info.Size = size
+	case code == 550:
+		return nil, &Error{Code: code, Message: msg}
+	}
+
+	// MDTM is optional, ignore servers that don't implement it
+	if code, msg, err := c.cmd(0, "MDTM %s", path); err != nil {
+		return nil, err
+	} else if code == 213 {
+		if t, err := parseMDTM(msg); err == nil {
+			info.ModTime = t
+		}
+	}
+
+	return info, nil
+}
+
+// Retr starts retrieving path from offset and returns the data connection.
+// The transfer must be finished with Finish once the data connection is done.
+func (c *Conn) Retr(ctx context.Context, path string, offset int64) (net.Conn, error) {
+	var data net.Conn
+	var ln net.Listener
+	var err error
+
+	if c.passive {
+		addr, err := c.pasv()
+		if err != nil {
+			return nil, err
+		}
+		dialer := &net.Dialer{Timeout: c.timeout}
+		data, err = dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		ln, err = c.port()
+		if err != nil {
+			return nil, err
+		}
+		defer ln.Close()
+	}
+
+	closeData := func() {
+		if data != nil {
+			data.Close()
+		}
+	}
+
+	if offset > 0 {
+		if _, _, err := c.cmd(3, "REST %d", offset); err != nil {
+			closeData()
+			return nil, err
+		}
+	}
+	if _, _, err := c.cmd(1, "RETR %s", path); err != nil {
+		closeData()
+		return nil, err
+	}
+
+	if ln != nil {
+		if tl, ok := ln.(*net.TCPListener); ok {
+			tl.SetDeadline(time.Now().Add(c.timeout))
+		}
+		stop := context.AfterFunc(ctx, func() { ln.Close() })
+		data, err = ln.Accept()
+		stop()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.protected {
+		tc := tls.Client(data, c.tlsConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			data.Close()
+			return nil, err
+		}
+		data = tc
+	}
+	return data, nil
+}
+
+// Finish reads the reply that ends a transfer after the data connection was closed.
+// A transfer aborted by closing the data connection early is not an error.
+func (c *Conn) Finish() error {
+	code, msg, err := c.readReply(0)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case 226, 250, 426, 450, 451:
+		return nil
+	}
+	return &Error{Code: code, Message: msg}
+}
+
+// Close sends QUIT and closes the control connection
+func (c *Conn) Close() error {
+	if c.text != nil {
+		c.conn.SetDeadline(time.Now().Add(time.Second))
+		c.text.Cmd("QUIT")
+	}
+	return c.conn.Close()
+}
+
+// pasv requests a passive data port and returns the address to dial
+func (c *Conn) pasv() (string, error) {
+	if !c.noEPSV {
+		code, msg, err := c.cmd(0, "EPSV")
+		if err != nil {
+			return "", err
+		}
+		if code == 229 {
+			port, err := parseEPSV(msg)
+			if err != nil {
+				return "", err
+			}
+			return net.JoinHostPort(c.host, strconv.Itoa(port)), nil
+		}
+		c.noEPSV = true
+	}
+
+	_, msg, err := c.cmd(2, "PASV")
+	if err != nil {
+		return "", err
+	}
+	port, err := parsePASV(msg)
+	if err != nil {
+		return "", err
+	}
+	// Ignore the address in the reply, it is often wrong behind NAT
+	// and connecting elsewhere than the control host is unsafe
+	return net.JoinHostPort(c.host, strconv.Itoa(port)), nil
+}
+
+// port opens a listener for an active mode transfer and announces it
+func (c *Conn) port() (net.Listener, error) {
+	local, ok := c.netConn().LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("ftp: active mode requires a TCP connection")
+	}
+
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: local.IP})
+	if err != nil {
+		return nil, err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	if ip4 := local.IP.To4(); ip4 != nil {
+		_, _, err = c.cmd(2, "PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff)
+	} else {
+		_, _, err = c.cmd(2, "EPRT |2|%s|%d|", local.IP.String(), port)
+	}
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// netConn returns the underlying TCP connection
+func (c *Conn) netConn() net.Conn {
+	if tc, ok := c.conn.(*tls.Conn); ok {
+		return tc.NetConn()
+	}
+	return c.conn
+}
+
+// cmd sends a command and reads its reply.
+// If expect is non-zero, a reply of a different class is returned as *Error.
+func (c *Conn) cmd(expect int, format string, args ...any) (int, string, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.readReply(expect)
+}
+
+// readReply reads a (possibly multi-line) reply
+func (c *Conn) readReply(expect int) (int, string, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	code, msg, err := c.text.ReadResponse(0)
+	if err != nil {
+		return 0, "", err
+	}
+	if expect != 0 && code/100 != expect {
+		return code, msg, &Error{Code: code, Message: msg}
+	}
+	return code, msg, nil
+}
+
+// parseEPSV parses "Entering Extended Passive Mode (|||port|)"
+func parseEPSV(msg string) (int, error) {
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	if start == -1 || end <= start+1 {
+		return 0, fmt.Errorf("ftp: invalid EPSV reply %q", msg)
+	}
+	inner := msg[start+1 : end]
+	delim := inner[:1]
+	fields := strings.Split(inner, delim)
+	if len(fields) != 5 {
+		return 0, fmt.Errorf("ftp: invalid EPSV reply %q", msg)
+	}
+	port, err := strconv.Atoi(fields[3])
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("ftp: invalid EPSV port in %q", msg)
+	}
+	return port, nil
+}
+
+// parsePASV parses "Entering Passive Mode (h1,h2,h3,h4,p1,p2)"
+func parsePASV(msg string) (int, error) {
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	var inner string
+	if start != -1 && end > start {
+		inner = msg[start+1 : end]
+	} else {
+		// Some servers omit the parentheses
+		fields := strings.Fields(msg)
+		inner = fields[len(fields)-1]
+	}
+
+	parts := strings.Split(inner, ",")
+	if len(parts) != 6 {
+		return 0, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+	}
+	p1, err1 := strconv.Atoi(strings.TrimSpace(parts[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(parts[5]))
+	if err1 != nil || err2 != nil || p1 > 255 || p2 > 255 {
+		return 0, fmt.Errorf("ftp: invalid PASV port in %q", msg)
+	}
+	return p1<<8 | p2, nil
+}
+
+// parseMDTM parses a "YYYYMMDDHHMMSS[.sss]" timestamp in UTC
+func parseMDTM(msg string) (time.Time, error) {
+	msg = strings.TrimSpace(msg)
+	if i := strings.IndexByte(msg, '.'); i != -1 {
+		msg = msg[:i]
+	}
+	return time.ParseInLocation("20060102150405", msg, time.UTC)
+}
+
+// isNetError reports whether err came from the connection rather than the server
+func isNetError(err error) bool {
+	var ftpErr *Error
+	return err != nil && !errors.As(err, &ftpErr)
+}
@@ -0,0 +1,338 @@
+package ftp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/internal/ftp"
+	"github.com/divyam234/hydra/internal/ftp/ftptest"
+)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func readRange(t *testing.T, c *ftp.Client, u *url.URL, offset, length int64) []byte {
+	t.Helper()
+	rc, err := c.OpenRange(context.Background(), u, offset, length)
+	if err != nil {
+		t.Fatalf("OpenRange(%d, %d) failed: %v", offset, length, err)
+	}
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return got
+}
+
+func TestClient_Stat(t *testing.T) {
+	data := testData(12345)
+	srv := ftptest.NewServer(map[string][]byte{"pub/file.bin": data})
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{})
+	defer c.CloseIdleConnections()
+
+	info, err := c.Stat(context.Background(), mustParse(t, srv.URL+"/pub/file.bin"))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Size = %d, want %d", info.Size, len(data))
+	}
+	if !info.ModTime.Equal(srv.ModTime) {
+		t.Errorf("ModTime = %v, want %v", info.ModTime, srv.ModTime)
+	}
+}
+
+func TestClient_StatWithoutSize(t *testing.T) {
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"f": testData(10)})
+	srv.DisableSize = true
+	srv.Start()
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{})
+	defer c.CloseIdleConnections()
+
+	info, err := c.Stat(context.Background(), mustParse(t, srv.URL+"/f"))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != -1 {
+		t.Errorf("Size = %d, want -1 when SIZE is unsupported", info.Size)
+	}
+}
+
+func TestClient_NotFound(t *testing.T) {
+	srv := ftptest.NewServer(map[string][]byte{})
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{})
+	defer c.CloseIdleConnections()
+
+	_, err := c.Stat(context.Background(), mustParse(t, srv.URL+"/missing"))
+	var ftpErr *ftp.Error
+	if !errors.As(err, &ftpErr) || ftpErr.Code != 550 {
+		t.Fatalf("Expected 550 error, got %v", err)
+	}
+	if !ftpErr.Permanent() {
+		t.Error("550 should be permanent")
+	}
+
+	_, err = c.OpenRange(context.Background(), mustParse(t, srv.URL+"/missing"), 0, -1)
+	if !errors.As(err, &ftpErr) || ftpErr.Code != 550 {
+		t.Fatalf("Expected 550 error from RETR, got %v", err)
+	}
+}
+
+func TestClient_OpenRange(t *testing.T) {
+	data := testData(100000)
+	srv := ftptest.NewServer(map[string][]byte{"file.bin": data})
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{})
+	defer c.CloseIdleConnections()
+	u := mustParse(t, srv.URL+"/file.bin")
+
+	tests := []struct {
+		offset, length int64
+	}{
+		{0, -1},
+		{0, 1000},
+		{5000, 20000},
+		{99000, 1000},
+		{50000, -1},
+	}
+	for _, tt := range tests {
+		got := readRange(t, c, u, tt.offset, tt.length)
+		end := int64(len(data))
+		if tt.length >= 0 {
+			end = tt.offset + tt.length
+		}
+		if !bytes.Equal(got, data[tt.offset:end]) {
+			t.Errorf("Range %d+%d: data mismatch (got %d bytes)", tt.offset, tt.length, len(got))
+		}
+	}
+
+	// Ranges reuse the pooled control connection
+	if n := srv.CountCommand("USER"); n != 1 {
+		t.Errorf("Expected 1 login, got %d", n)
+	}
+	if n := srv.CountCommand("REST"); n != 3 {
+		t.Errorf("Expected REST for each non-zero offset, got %d", n)
+	}
+}
+
+func TestClient_ShortRead(t *testing.T) {
+	data := testData(1000)
+	srv := ftptest.NewServer(map[string][]byte{"f": data})
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{})
+	defer c.CloseIdleConnections()
+
+	rc, err := c.OpenRange(context.Background(), mustParse(t, srv.URL+"/f"), 500, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	if _, err := io.ReadAll(rc); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestClient_PASVFallback(t *testing.T) {
+	data := testData(4096)
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"f": data})
+	srv.DisableEPSV = true
+	srv.Start()
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{})
+	defer c.CloseIdleConnections()
+
+	if got := readRange(t, c, mustParse(t, srv.URL+"/f"), 0, -1); !bytes.Equal(got, data) {
+		t.Error("Data mismatch")
+	}
+	if srv.CountCommand("PASV") == 0 {
+		t.Error("Expected PASV after EPSV was rejected")
+	}
+}
+
+func TestClient_ActiveMode(t *testing.T) {
+	data := testData(4096)
+	srv := ftptest.NewServer(map[string][]byte{"f": data})
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{Active: true})
+	defer c.CloseIdleConnections()
+
+	if got := readRange(t, c, mustParse(t, srv.URL+"/f"), 100, 200); !bytes.Equal(got, data[100:300]) {
+		t.Error("Data mismatch")
+	}
+	if srv.CountCommand("PORT") == 0 {
+		t.Error("Expected PORT in active mode")
+	}
+	if srv.CountCommand("EPSV")+srv.CountCommand("PASV") != 0 {
+		t.Error("Passive commands sent in active mode")
+	}
+}
+
+func TestClient_Login(t *testing.T) {
+	data := testData(100)
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"f": data})
+	srv.User = "alice"
+	srv.Password = "secret"
+	srv.Start()
+	defer srv.Close()
+
+	// Anonymous login is rejected
+	c := ftp.NewClient(ftp.Config{})
+	_, err := c.Stat(context.Background(), mustParse(t, srv.URL+"/f"))
+	var ftpErr *ftp.Error
+	if !errors.As(err, &ftpErr) || ftpErr.Code != 530 {
+		t.Fatalf("Expected 530 error, got %v", err)
+	}
+
+	// Credentials from the config
+	c = ftp.NewClient(ftp.Config{User: "alice", Password: "secret"})
+	defer c.CloseIdleConnections()
+	if _, err := c.Stat(context.Background(), mustParse(t, srv.URL+"/f")); err != nil {
+		t.Fatalf("Stat with config credentials failed: %v", err)
+	}
+
+	// Per-host credentials, looked up by host name
+	var looked []string
+	c3 := ftp.NewClient(ftp.Config{Credentials: func(host string) (string, string, bool) {
+		looked = append(looked, host)
+		return "alice", "secret", true
+	}})
+	defer c3.CloseIdleConnections()
+	if _, err := c3.Stat(context.Background(), mustParse(t, srv.URL+"/f")); err != nil {
+		t.Fatalf("Stat with looked up credentials failed: %v", err)
+	}
+	if len(looked) != 1 || looked[0] != "127.0.0.1" {
+		t.Errorf("Credentials looked up for %v, want [127.0.0.1]", looked)
+	}
+
+	// Credentials from the URL take precedence
+	c2 := ftp.NewClient(ftp.Config{User: "bob", Password: "wrong"})
+	defer c2.CloseIdleConnections()
+	u := mustParse(t, "ftp://alice:secret@"+srv.Addr+"/f")
+	if got := readRange(t, c2, u, 0, -1); !bytes.Equal(got, data) {
+		t.Error("Data mismatch")
+	}
+}
+
+func tlsConfigFor(srv *ftptest.Server) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return &tls.Config{RootCAs: pool}
+}
+
+func TestClient_ExplicitTLS(t *testing.T) {
+	data := testData(50000)
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"f": data})
+	srv.EnableTLS(false)
+	srv.Start()
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{ExplicitTLS: true, TLSConfig: tlsConfigFor(srv)})
+	defer c.CloseIdleConnections()
+
+	if got := readRange(t, c, mustParse(t, srv.URL+"/f"), 1000, 2000); !bytes.Equal(got, data[1000:3000]) {
+		t.Error("Data mismatch")
+	}
+	for _, cmd := range []string{"AUTH", "PBSZ", "PROT"} {
+		if srv.CountCommand(cmd) != 1 {
+			t.Errorf("Expected %s to be sent once", cmd)
+		}
+	}
+}
+
+func TestClient_ImplicitTLS(t *testing.T) {
+	data := testData(50000)
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"f": data})
+	srv.EnableTLS(true)
+	srv.Start()
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{TLSConfig: tlsConfigFor(srv)})
+	defer c.CloseIdleConnections()
+
+	if got := readRange(t, c, mustParse(t, srv.URL+"/f"), 0, -1); !bytes.Equal(got, data) {
+		t.Error("Data mismatch")
+	}
+	if srv.CountCommand("AUTH") != 0 {
+		t.Error("AUTH should not be sent for implicit TLS")
+	}
+}
+
+func TestClient_UntrustedCertificate(t *testing.T) {
+	srv := ftptest.NewUnstartedServer(map[string][]byte{"f": testData(10)})
+	srv.EnableTLS(true)
+	srv.Start()
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{TLSConfig: &tls.Config{}, DialTimeout: 5 * time.Second})
+	if _, err := c.Stat(context.Background(), mustParse(t, srv.URL+"/f")); err == nil {
+		t.Fatal("Expected certificate verification to fail")
+	}
+}
+
+func TestClient_ContextCancel(t *testing.T) {
+	data := testData(64 * 1024 * 1024)
+	srv := ftptest.NewServer(map[string][]byte{"big": data})
+	defer srv.Close()
+
+	c := ftp.NewClient(ftp.Config{})
+	defer c.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rc, err := c.OpenRange(ctx, mustParse(t, srv.URL+"/big"), 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf := make([]byte, 1024)
+	if _, err := io.ReadFull(rc, buf); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, rc)
+		done <- err
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read did not stop after context cancellation")
+	}
+}
@@ -0,0 +1,434 @@
+// Package ftptest provides an in-memory FTP server for tests,
+// in the spirit of net/http/httptest.
+package ftptest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an FTP server serving files from memory
+type Server struct {
+	Addr string // host:port of the listener
+	URL  string // Base URL, e.g. ftp://127.0.0.1:2121
+
+	// Files maps paths (without leading slash) to their contents
+	Files map[string][]byte
+	// ModTime is reported by MDTM for every file
+	ModTime time.Time
+	// User and Password, if set, are required to log in
+	User     string
+	Password string
+	// DisableSize makes SIZE fail with 502
+	DisableSize bool
+	// DisableEPSV makes EPSV fail with 502
+	DisableEPSV bool
+
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	cert        *x509.Certificate
+
+	mu       sync.Mutex
+	commands []string
+	conns    map[net.Conn]bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a plain FTP server serving files
+func NewServer(files map[string][]byte) *Server {
+	s := NewUnstartedServer(files)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server that must be configured and then started
+func NewUnstartedServer(files map[string][]byte) *Server {
+	return &Server{
+		Files:   files,
+		ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		conns:   make(map[net.Conn]bool),
+	}
+}
+
+// EnableTLS makes the server accept AUTH TLS, or wrap every connection in TLS
+// (ftps://) when implicit is set. The certificate is self-signed.
+func (s *Server) EnableTLS(implicit bool) {
+	cert, leaf := selfSignedCert()
+	s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.implicitTLS = implicit
+	s.cert = leaf
+}
+
+// Certificate returns the server certificate when TLS is enabled
+func (s *Server) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Start starts listening on a random local port
+func (s *Server) Start() {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("ftptest: failed to listen: %v", err))
+	}
+	s.listener = ln
+	s.Addr = ln.Addr().String()
+	scheme := "ftp"
+	if s.implicitTLS {
+		scheme = "ftps"
+	}
+	s.URL = scheme + "://" + s.Addr
+
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Close stops the server and closes all connections
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// Commands returns all commands received so far, without arguments
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// CountCommand returns how often cmd was received
+func (s *Server) CountCommand(cmd string) int {
+	n := 0
+	for _, c := range s.Commands() {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		if !s.track(c, true) {
+			c.Close()
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.track(c, false)
+			s.handle(c)
+		}()
+	}
+}
+
+func (s *Server) track(c net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.closed {
+			return false
+		}
+		s.conns[c] = true
+	} else {
+		delete(s.conns, c)
+	}
+	return true
+}
+
+func (s *Server) record(cmd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, cmd)
+}
+
+// session holds the state of one control connection
+type session struct {
+	s         *Server
+	conn      net.Conn
+	r         *bufio.Reader
+	user      string
+	loggedIn  bool
+	protected bool
+	rest      int64
+	pasv      net.Listener
+	port      string
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+	if s.implicitTLS {
+		tc := tls.Server(c, s.tlsConfig)
+		if err := tc.Handshake(); err != nil {
+			return
+		}
+		c = tc
+	}
+
+	ss := &session{s: s, conn: c, r: bufio.NewReader(c)}
+	defer ss.closePasv()
+	ss.reply(220, "ftptest ready")
+
+	for {
+		line, err := ss.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+		s.record(cmd)
+
+		if !ss.dispatch(cmd, arg) {
+			return
+		}
+	}
+}
+
+func (ss *session) reply(code int, msg string) {
+	fmt.Fprintf(ss.conn, "%d %s\r\n", code, msg)
+}
+
+// dispatch handles one command and returns false when the session ends
+func (ss *session) dispatch(cmd, arg string) bool {
+	s := ss.s
+	switch cmd {
+	case "AUTH":
+		if s.tlsConfig == nil || s.implicitTLS {
+			ss.reply(502, "TLS not available")
+			return true
+		}
+		ss.reply(234, "Proceed with negotiation")
+		tc := tls.Server(ss.conn, s.tlsConfig)
+		if err := tc.Handshake(); err != nil {
+			return false
+		}
+		ss.conn = tc
+		ss.r = bufio.NewReader(tc)
+	case "PBSZ":
+		ss.reply(200, "PBSZ=0")
+	case "PROT":
+		ss.protected = strings.EqualFold(arg, "P")
+		ss.reply(200, "Protection level set")
+	case "USER":
+		ss.user = arg
+		ss.reply(331, "Password required")
+	case "PASS":
+		if s.User != "" && (ss.user != s.User || arg != s.Password) {
+			ss.reply(530, "Login incorrect")
+			return true
+		}
+		ss.loggedIn = true
+		ss.reply(230, "Logged in")
+	case "QUIT":
+		ss.reply(221, "Goodbye")
+		return false
+	case "NOOP":
+		ss.reply(200, "OK")
+	case "SYST":
+		ss.reply(215, "UNIX Type: L8")
+	default:
+		if !ss.loggedIn {
+			ss.reply(530, "Not logged in")
+			return true
+		}
+		ss.dispatchFile(cmd, arg)
+	}
+	return true
+}
+
+func (ss *session) dispatchFile(cmd, arg string) {
+	s := ss.s
+	switch cmd {
+	case "TYPE":
+		ss.reply(200, "Type set")
+	case "SIZE":
+		if s.DisableSize {
+			ss.reply(502, "SIZE not implemented")
+			return
+		}
+		data, ok := s.Files[strings.TrimPrefix(arg, "/")]
+		if !ok {
+			ss.reply(550, "No such file")
+			return
+		}
+		ss.reply(213, strconv.Itoa(len(data)))
+	case "MDTM":
+		if _, ok := s.Files[strings.TrimPrefix(arg, "/")]; !ok {
+			ss.reply(550, "No such file")
+			return
+		}
+		ss.reply(213, s.ModTime.UTC().Format("20060102150405"))
+	case "REST":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 0 {
+			ss.reply(501, "Invalid offset")
+			return
+		}
+		ss.rest = n
+		ss.reply(350, "Restarting")
+	case "EPSV":
+		if s.DisableEPSV {
+			ss.reply(502, "EPSV not implemented")
+			return
+		}
+		port, err := ss.listenPasv()
+		if err != nil {
+			ss.reply(425, "Cannot open data connection")
+			return
+		}
+		ss.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+	case "PASV":
+		port, err := ss.listenPasv()
+		if err != nil {
+			ss.reply(425, "Cannot open data connection")
+			return
+		}
+		ss.reply(227, fmt.Sprintf("Entering Passive Mode (127,0,0,1,%d,%d)", port>>8, port&0xff))
+	case "PORT":
+		parts := strings.Split(arg, ",")
+		if len(parts) != 6 {
+			ss.reply(501, "Invalid PORT")
+			return
+		}
+		p1, _ := strconv.Atoi(parts[4])
+		p2, _ := strconv.Atoi(parts[5])
+		ss.closePasv()
+		ss.port = net.JoinHostPort(strings.Join(parts[:4], "."), strconv.Itoa(p1<<8|p2))
+		ss.reply(200, "PORT OK")
+	case "EPRT":
+		fields := strings.Split(arg, arg[:1])
+		if len(fields) != 5 {
+			ss.reply(501, "Invalid EPRT")
+			return
+		}
+		ss.closePasv()
+		ss.port = net.JoinHostPort(fields[2], fields[3])
+		ss.reply(200, "EPRT OK")
+	case "RETR":
+		ss.retr(strings.TrimPrefix(arg, "/"))
+	default:
+		ss.reply(502, "Command not implemented")
+	}
+}
+
+func (ss *session) listenPasv() (int, error) {
+	ss.closePasv()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	ss.pasv = ln
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (ss *session) closePasv() {
+	if ss.pasv != nil {
+		ss.pasv.Close()
+		ss.pasv = nil
+	}
+}
+
+func (ss *session) retr(path string) {
+	offset := ss.rest
+	ss.rest = 0
+
+	data, ok := ss.s.Files[path]
+	if !ok {
+		ss.reply(550, "No such file")
+		return
+	}
+	if offset > int64(len(data)) {
+		ss.reply(551, "Offset beyond end of file")
+		return
+	}
+
+	var dc net.Conn
+	var err error
+	switch {
+	case ss.pasv != nil:
+		ss.reply(150, "Opening data connection")
+		dc, err = ss.pasv.Accept()
+		ss.closePasv()
+	case ss.port != "":
+		ss.reply(150, "Opening data connection")
+		dc, err = net.DialTimeout("tcp", ss.port, 5*time.Second)
+		ss.port = ""
+	default:
+		ss.reply(425, "Use PASV or PORT first")
+		return
+	}
+	if err != nil {
+		ss.reply(425, "Cannot open data connection")
+		return
+	}
+	defer dc.Close()
+
+	if ss.protected {
+		tc := tls.Server(dc, ss.s.tlsConfig)
+		if err := tc.Handshake(); err != nil {
+			ss.reply(425, "TLS negotiation failed")
+			return
+		}
+		dc = tc
+	}
+
+	if _, err := io.Copy(dc, strings.NewReader(string(data[offset:]))); err != nil {
+		ss.reply(426, "Transfer aborted")
+		return
+	}
+	dc.Close()
+	ss.reply(226, "Transfer complete")
+}
+
+func selfSignedCert() (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("ftptest: failed to generate key: %v", err))
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ftptest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("ftptest: failed to create certificate: %v", err))
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, leaf
+}
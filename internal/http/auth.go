@@ -0,0 +1,222 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider authenticates HTTP requests. Authorize is called before each
+// request, every ranged request of every connection included, so that
+// credentials which expire during a long download are renewed. Refresh is
+// called once when a request authorized by the provider is answered with
+// 401 Unauthorized; it returns whether the request should be sent again.
+// Providers are shared by the connections of a download and must be safe
+// for concurrent use.
+type AuthProvider interface {
+	Authorize(req *http.Request) error
+	Refresh(resp *http.Response) (retry bool, err error)
+}
+
+// bearerAuth sends a fixed token
+type bearerAuth struct {
+	token string
+}
+
+// NewBearerAuth returns a provider sending token as a Bearer token (RFC
+// 6750). A rejected token is not retried.
+func NewBearerAuth(token string) AuthProvider {
+	return &bearerAuth{token: token}
+}
+
+func (a *bearerAuth) Authorize(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+func (a *bearerAuth) Refresh(*http.Response) (bool, error) {
+	return false, nil
+}
+
+// Token is an OAuth2 access token
+type Token struct {
+	AccessToken string
+	TokenType   string    // "Bearer" if empty
+	Expiry      time.Time // Zero if the token does not expire
+}
+
+// expiryDelta is how long before its expiry a token is renewed, so that it
+// does not expire on the way to the server
+const expiryDelta = 10 * time.Second
+
+// valid reports whether the token can still be sent at now
+func (t *Token) valid(now time.Time) bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || now.Add(expiryDelta).Before(t.Expiry))
+}
+
+func (t *Token) header() string {
+	typ := t.TokenType
+	if typ == "" || strings.EqualFold(typ, "bearer") {
+		typ = "Bearer"
+	}
+	return typ + " " + t.AccessToken
+}
+
+// TokenSource returns new OAuth2 access tokens
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+// Token calls f(ctx)
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// oauth2Auth sends the current token of a source, renewing it when it
+// expires or is rejected
+type oauth2Auth struct {
+	src TokenSource
+	now func() time.Time // For testing
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewOAuth2Auth returns a provider sending tokens from src. A token is
+// fetched before the first request and again shortly before it expires.
+// When the server rejects a token, a new one is fetched and the request is
+// retried once.
+func NewOAuth2Auth(src TokenSource) AuthProvider {
+	return &oauth2Auth{src: src, now: time.Now}
+}
+
+func (a *oauth2Auth) Authorize(req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.token.valid(a.now()) {
+		// Connections wait for the one fetching the token, so that it is
+		// fetched once
+		token, err := a.src.Token(req.Context())
+		if err != nil {
+			return fmt.Errorf("oauth2: %w", err)
+		}
+		if token == nil || token.AccessToken == "" {
+			return fmt.Errorf("oauth2: token source returned no access token")
+		}
+		a.token = token
+	}
+	req.Header.Set("Authorization", a.token.header())
+	return nil
+}
+
+func (a *oauth2Auth) Refresh(resp *http.Response) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Another connection may have renewed the token already
+	if a.token != nil && resp.Request != nil && resp.Request.Header.Get("Authorization") == a.token.header() {
+		a.token = nil
+	}
+	return true, nil
+}
+
+// RefreshTokenSource gets access tokens from the token endpoint of an OAuth2
+// server with the refresh token grant (RFC 6749, section 6). Servers that
+// rotate refresh tokens are supported: a refresh token returned with an
+// access token replaces RefreshToken.
+type RefreshTokenSource struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string // Sent with HTTP Basic authentication, if set
+	RefreshToken string
+	Scopes       []string
+	Client       *http.Client // http.DefaultClient if nil
+
+	mu sync.Mutex
+}
+
+// tokenResponse is the JSON answer of a token endpoint
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Token fetches a new access token
+func (s *RefreshTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.RefreshToken},
+	}
+	if len(s.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.Scopes, " "))
+	}
+	if s.ClientSecret == "" && s.ClientID != "" {
+		form.Set("client_id", s.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.ClientID), url.QueryEscape(s.ClientSecret))
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var tr tokenResponse
+	jsonErr := json.Unmarshal(body, &tr)
+	if tr.Error != "" {
+		if tr.ErrorDescription != "" {
+			return nil, fmt.Errorf("token endpoint: %s: %s", tr.Error, tr.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token endpoint: %s", tr.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint: %w", NewStatusError(resp))
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("token endpoint: %w", jsonErr)
+	}
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint: no access token returned")
+	}
+
+	if tr.RefreshToken != "" {
+		s.RefreshToken = tr.RefreshToken
+	}
+	token := &Token{AccessToken: tr.AccessToken, TokenType: tr.TokenType}
+	if tr.ExpiresIn > 0 {
+		token.Expiry = start.Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
@@ -0,0 +1,261 @@
+package http
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestHashes maps the algorithms of Digest authentication (RFC 7616,
+// section 3.3), without the -sess suffix, to their hash functions
+var digestHashes = map[string]func() hash.Hash{
+	"MD5":         md5.New,
+	"SHA-256":     sha256.New,
+	"SHA-512-256": sha512.New512_256,
+}
+
+// digestStrength orders the algorithms from weakest to strongest
+var digestStrength = map[string]int{"MD5": 1, "SHA-256": 2, "SHA-512-256": 3}
+
+// digestChallenge is a Digest challenge of a WWW-Authenticate header
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string // As sent by the server, "MD5" if absent
+	qop       bool   // Whether qop "auth" is offered
+	stale     bool   // The nonce expired, the credentials were fine
+	userhash  bool
+}
+
+// newHash returns the hash function of the algorithm and whether it is a
+// -sess variant
+func (c *digestChallenge) newHash() (func() hash.Hash, bool) {
+	name, sess := strings.CutSuffix(strings.ToUpper(c.algorithm), "-SESS")
+	return digestHashes[name], sess
+}
+
+// digestAuth answers Digest challenges (RFC 7616)
+type digestAuth struct {
+	user, password string
+	cnonce         func() string // For testing
+
+	mu   sync.Mutex
+	chal *digestChallenge // Latest challenge, nil before the first 401
+	nc   uint32           // Requests sent with the nonce of chal
+}
+
+// NewDigestAuth returns a provider logging in as user with Digest
+// authentication. The first request is sent without credentials; later ones
+// answer the server's latest challenge, so that only requests after a nonce
+// expired need to be sent again. MD5, SHA-256 and SHA-512-256, with or
+// without -sess, are supported with qop "auth".
+func NewDigestAuth(user, password string) AuthProvider {
+	return &digestAuth{user: user, password: password, cnonce: newCnonce}
+}
+
+func newCnonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (a *digestAuth) Authorize(req *http.Request) error {
+	a.mu.Lock()
+	chal := a.chal
+	a.nc++
+	nc := a.nc
+	a.mu.Unlock()
+	if chal == nil {
+		return nil
+	}
+	req.Header.Set("Authorization", a.authorization(chal, req.Method, req.URL.RequestURI(), a.cnonce(), nc))
+	return nil
+}
+
+// Refresh takes the challenge of resp. The request is retried unless it
+// already answered that nonce and the server did not mark it stale, which
+// means that the credentials are wrong.
+func (a *digestAuth) Refresh(resp *http.Response) (bool, error) {
+	var best *digestChallenge
+	for _, value := range resp.Header.Values("WWW-Authenticate") {
+		for _, c := range parseAuthParams(value) {
+			if !strings.EqualFold(c.scheme, "Digest") {
+				continue
+			}
+			chal := &digestChallenge{
+				realm:     c.params["realm"],
+				nonce:     c.params["nonce"],
+				opaque:    c.params["opaque"],
+				algorithm: c.params["algorithm"],
+				stale:     strings.EqualFold(c.params["stale"], "true"),
+				userhash:  strings.EqualFold(c.params["userhash"], "true"),
+			}
+			if chal.algorithm == "" {
+				chal.algorithm = "MD5"
+			}
+			qops, offered := c.params["qop"]
+			for _, qop := range strings.Split(qops, ",") {
+				chal.qop = chal.qop || strings.TrimSpace(qop) == "auth"
+			}
+			if chal.nonce == "" || (offered && !chal.qop) {
+				continue
+			}
+			newHash, _ := chal.newHash()
+			if newHash == nil {
+				continue
+			}
+			if best == nil || digestStrength[baseAlgorithm(chal.algorithm)] > digestStrength[baseAlgorithm(best.algorithm)] {
+				best = chal
+			}
+		}
+	}
+	if best == nil {
+		return false, nil
+	}
+
+	a.mu.Lock()
+	if a.chal == nil || a.chal.nonce != best.nonce {
+		a.chal, a.nc = best, 0
+	}
+	a.mu.Unlock()
+
+	if resp.Request == nil {
+		return true, nil
+	}
+	var sent string
+	for _, c := range parseAuthParams(resp.Request.Header.Get("Authorization")) {
+		if strings.EqualFold(c.scheme, "Digest") {
+			sent = c.params["nonce"]
+		}
+	}
+	return best.stale || sent != best.nonce, nil
+}
+
+func baseAlgorithm(algorithm string) string {
+	name, _ := strings.CutSuffix(strings.ToUpper(algorithm), "-SESS")
+	return name
+}
+
+// authorization returns the Authorization header answering chal for a
+// request of method to uri
+func (a *digestAuth) authorization(chal *digestChallenge, method, uri, cnonce string, nc uint32) string {
+	newHash, sess := chal.newHash()
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	ha1 := h(a.user + ":" + chal.realm + ":" + a.password)
+	if sess {
+		ha1 = h(ha1 + ":" + chal.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	ncValue := fmt.Sprintf("%08x", nc)
+
+	var response string
+	if chal.qop {
+		response = h(ha1 + ":" + chal.nonce + ":" + ncValue + ":" + cnonce + ":auth:" + ha2)
+	} else {
+		// RFC 2069 compatibility
+		response = h(ha1 + ":" + chal.nonce + ":" + ha2)
+	}
+
+	username := a.user
+	if chal.userhash {
+		username = h(a.user + ":" + chal.realm)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Digest username=%s, realm=%s, uri=%s, algorithm=%s, nonce=%s",
+		quoteParam(username), quoteParam(chal.realm), quoteParam(uri), chal.algorithm, quoteParam(chal.nonce))
+	if chal.qop {
+		fmt.Fprintf(&b, ", nc=%s, cnonce=%s, qop=auth", ncValue, quoteParam(cnonce))
+	}
+	fmt.Fprintf(&b, ", response=%s", quoteParam(response))
+	if chal.opaque != "" {
+		fmt.Fprintf(&b, ", opaque=%s", quoteParam(chal.opaque))
+	}
+	if chal.userhash {
+		b.WriteString(", userhash=true")
+	}
+	return b.String()
+}
+
+// quoteParam returns s as a quoted string
+func quoteParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// authParams is a challenge of a WWW-Authenticate header, or the
+// credentials of an Authorization header
+type authParams struct {
+	scheme string
+	params map[string]string // By lower-case name
+}
+
+// parseAuthParams splits a WWW-Authenticate or Authorization header value
+// into its challenges and their parameters (RFC 9110, section 11)
+func parseAuthParams(value string) []authParams {
+	var out []authParams
+	s := value
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return out
+		}
+		tok, rest := cutToken(s)
+		if tok == "" {
+			// Not a token, e.g. the padding of a token68
+			s = s[1:]
+			continue
+		}
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, "=") && len(out) > 0 {
+			rest = strings.TrimLeft(rest[1:], " \t")
+			var val string
+			if strings.HasPrefix(rest, `"`) {
+				val, rest = cutQuoted(rest)
+			} else {
+				val, rest = cutToken(rest)
+			}
+			out[len(out)-1].params[strings.ToLower(tok)] = val
+		} else {
+			out = append(out, authParams{scheme: tok, params: make(map[string]string)})
+		}
+		s = rest
+	}
+}
+
+// cutToken splits s after its leading token
+func cutToken(s string) (tok, rest string) {
+	i := 0
+	for i < len(s) && s[i] > ' ' && s[i] < 0x7f && !strings.ContainsRune(`()<>@,;:\"/[]?={}`, rune(s[i])) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// cutQuoted splits s after its leading quoted string and unquotes it. An
+// unterminated string runs to the end of s.
+func cutQuoted(s string) (val, rest string) {
+	var b strings.Builder
+	i := 1
+	for ; i < len(s) && s[i] != '"'; i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	if i < len(s) {
+		i++
+	}
+	return b.String(), s[i:]
+}
@@ -0,0 +1,229 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rfc7616Challenge is the challenge of the example in RFC 7616, section 3.9.1
+func rfc7616Challenge(algorithm string) *http.Response {
+	resp := &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{}}
+	resp.Header.Add("WWW-Authenticate", `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=`+algorithm+`,
+		nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+	resp.Request, _ = http.NewRequest(http.MethodGet, "http://www.example.org/dir/index.html", nil)
+	return resp
+}
+
+func TestDigestAuth_RFC7616(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		response  string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			a := NewDigestAuth("Mufasa", "Circle of Life").(*digestAuth)
+			a.cnonce = func() string { return "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ" }
+
+			req, _ := http.NewRequest(http.MethodGet, "http://www.example.org/dir/index.html", nil)
+			if err := a.Authorize(req); err != nil || req.Header.Get("Authorization") != "" {
+				t.Fatalf("Authorize before a challenge = %v, %q", err, req.Header.Get("Authorization"))
+			}
+			if retry, err := a.Refresh(rfc7616Challenge(tt.algorithm)); err != nil || !retry {
+				t.Fatalf("Refresh = %v, %v, want a retry", retry, err)
+			}
+
+			req, _ = http.NewRequest(http.MethodGet, "http://www.example.org/dir/index.html", nil)
+			a.Authorize(req)
+			got := parseAuthParams(req.Header.Get("Authorization"))
+			if len(got) != 1 || got[0].scheme != "Digest" {
+				t.Fatalf("Authorization = %q", req.Header.Get("Authorization"))
+			}
+			want := map[string]string{
+				"username":  "Mufasa",
+				"realm":     "http-auth@example.org",
+				"uri":       "/dir/index.html",
+				"algorithm": tt.algorithm,
+				"nc":        "00000001",
+				"qop":       "auth",
+				"response":  tt.response,
+				"opaque":    "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+			}
+			for name, value := range want {
+				if got[0].params[name] != value {
+					t.Errorf("%s = %q, want %q", name, got[0].params[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestDigestAuth_Refresh(t *testing.T) {
+	a := NewDigestAuth("Mufasa", "wrong")
+	if retry, _ := a.Refresh(rfc7616Challenge("MD5")); !retry {
+		t.Fatal("first challenge not retried")
+	}
+
+	// The retry answered the nonce and was rejected: the password is wrong
+	rejected := rfc7616Challenge("MD5")
+	a.Authorize(rejected.Request)
+	if retry, _ := a.Refresh(rejected); retry {
+		t.Error("rejected credentials retried")
+	}
+
+	// An expired nonce is retried with the new one
+	stale := rfc7616Challenge("MD5")
+	a.Authorize(stale.Request)
+	stale.Header.Set("WWW-Authenticate", `Digest realm="http-auth@example.org", qop="auth", nonce="fresh", stale=true`)
+	if retry, _ := a.Refresh(stale); !retry {
+		t.Error("stale nonce not retried")
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://www.example.org/", nil)
+	a.Authorize(req)
+	if got := parseAuthParams(req.Header.Get("Authorization")); got[0].params["nonce"] != "fresh" || got[0].params["nc"] != "00000001" {
+		t.Errorf("Authorization after a stale nonce = %q", req.Header.Get("Authorization"))
+	}
+
+	// Only Digest challenges with a supported algorithm and qop are answered
+	unsupported := rfc7616Challenge("MD5")
+	unsupported.Header.Set("WWW-Authenticate", `Basic realm="x", Digest realm="x", nonce="n", qop="auth-int"`)
+	unsupported.Header.Add("WWW-Authenticate", `Digest realm="x", nonce="n", algorithm=SHA-1`)
+	if retry, _ := NewDigestAuth("u", "p").Refresh(unsupported); retry {
+		t.Error("unsupported challenge retried")
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	got := parseAuthParams(`Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple", Negotiate a87421000492aa874209af8bc028==`)
+	if len(got) != 3 {
+		t.Fatalf("got %d challenges, want 3: %+v", len(got), got)
+	}
+	if got[0].scheme != "Newauth" || got[0].params["realm"] != "apps" || got[0].params["type"] != "1" || got[0].params["title"] != `Login to "apps"` {
+		t.Errorf("first challenge = %+v", got[0])
+	}
+	if got[1].scheme != "Basic" || got[1].params["realm"] != "simple" {
+		t.Errorf("second challenge = %+v", got[1])
+	}
+	if got[2].scheme != "Negotiate" {
+		t.Errorf("third challenge = %+v", got[2])
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	a := NewBearerAuth("abc")
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	a.Authorize(req)
+	if got := req.Header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if retry, _ := a.Refresh(&http.Response{Request: req}); retry {
+		t.Error("fixed token retried")
+	}
+}
+
+func TestOAuth2Auth(t *testing.T) {
+	var fetched atomic.Int32
+	now := time.Unix(1000, 0)
+	src := TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		n := fetched.Add(1)
+		return &Token{AccessToken: fmt.Sprintf("token%d", n), Expiry: now.Add(time.Minute)}, nil
+	})
+	a := NewOAuth2Auth(src).(*oauth2Auth)
+	a.now = func() time.Time { return now }
+
+	authorize := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if err := a.Authorize(req); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	if got := authorize().Header.Get("Authorization"); got != "Bearer token1" {
+		t.Fatalf("Authorization = %q", got)
+	}
+	authorize()
+	if fetched.Load() != 1 {
+		t.Errorf("valid token fetched again")
+	}
+
+	// Renewed shortly before it expires
+	now = now.Add(time.Minute - expiryDelta)
+	if got := authorize().Header.Get("Authorization"); got != "Bearer token2" {
+		t.Errorf("Authorization near expiry = %q", got)
+	}
+
+	// A rejected token is renewed once, even if several connections report it
+	rejected := &http.Response{StatusCode: http.StatusUnauthorized, Request: authorize()}
+	for range 3 {
+		if retry, _ := a.Refresh(rejected); !retry {
+			t.Fatal("rejected token not retried")
+		}
+		authorize()
+	}
+	if fetched.Load() != 3 {
+		t.Errorf("token fetched %d times, want 3", fetched.Load())
+	}
+
+	failing := NewOAuth2Auth(TokenSourceFunc(func(context.Context) (*Token, error) {
+		return nil, errors.New("offline")
+	}))
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if err := failing.Authorize(req); err == nil || !strings.Contains(err.Error(), "offline") {
+		t.Errorf("Authorize with a failing source = %v", err)
+	}
+}
+
+func TestRefreshTokenSource(t *testing.T) {
+	var grants []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		r.ParseForm()
+		grants = append(grants, r.PostForm.Get("grant_type")+" "+r.PostForm.Get("refresh_token"))
+		if r.PostForm.Get("refresh_token") == "revoked" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"token revoked"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access-` + r.PostForm.Get("refresh_token") + `","token_type":"bearer","expires_in":3600,"refresh_token":"rotated"}`))
+	}))
+	defer server.Close()
+
+	src := &RefreshTokenSource{TokenURL: server.URL, ClientID: "client", ClientSecret: "s3cret", RefreshToken: "initial"}
+	before := time.Now()
+	token, err := src.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access-initial" || token.Expiry.Before(before.Add(time.Hour)) {
+		t.Errorf("token = %+v", token)
+	}
+	if token, _ = src.Token(context.Background()); token.AccessToken != "access-rotated" {
+		t.Errorf("rotated refresh token not used: %+v", token)
+	}
+	if len(grants) != 2 || grants[0] != "refresh_token initial" {
+		t.Errorf("grants = %q", grants)
+	}
+
+	src.RefreshToken = "revoked"
+	if _, err := src.Token(context.Background()); err == nil || !strings.Contains(err.Error(), "token revoked") {
+		t.Errorf("revoked refresh token: %v", err)
+	}
+	src.ClientSecret = "wrong"
+	if _, err := src.Token(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("wrong client secret: %v", err)
+	}
+}
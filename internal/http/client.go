@@ -13,8 +13,14 @@ import (
 	"github.com/divyam234/hydra/pkg/option"
 )
 
-// NewTransport creates a new HTTP transport with custom settings
-func NewTransport(opt *option.Option) *http.Transport {
+// NewTransport creates a new HTTP transport with custom settings. It fails
+// if the TLS options cannot be loaded.
+func NewTransport(opt *option.Option) (*http.Transport, error) {
+	tlsConfig, err := NewTLSConfig(opt)
+	if err != nil {
+		return nil, err
+	}
+
 	// Proxy function logic
 	noProxy := opt.Get(option.NoProxy)
 	proxyStr := opt.Get(option.Proxy)
@@ -85,21 +91,13 @@ func NewTransport(opt *option.Option) *http.Transport {
 		}
 	}
 
-	// TLS Configuration
-	checkCert, err := opt.GetAsBool(option.CheckCertificate)
-	if err != nil {
-		checkCert = true // Default to safe
-	}
-
 	transport := &http.Transport{
 		Proxy: proxyFunc,
 		DialContext: (&net.Dialer{
 			Timeout:   time.Duration(connectTimeout) * time.Second,
 			KeepAlive: 30 * time.Second,
 		}).DialContext,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: !checkCert,
-		},
+		TLSClientConfig:       tlsConfig,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          maxIdleConns,
 		IdleConnTimeout:       time.Duration(idleConnTimeout) * time.Second,
@@ -122,12 +120,57 @@ func NewTransport(opt *option.Option) *http.Transport {
 	keepAlive, _ := opt.GetAsBool(option.EnableHttpKeepAlive)
 	transport.DisableKeepAlives = !keepAlive
 
-	return transport
+	return transport, nil
+}
+
+// NewTLSConfig creates the TLS configuration used for HTTPS and FTPS
+// connections: certificate checks, extra CA certificates, the client
+// certificate, the minimum version and pinned public keys
+func NewTLSConfig(opt *option.Option) (*tls.Config, error) {
+	checkCert, err := opt.GetAsBool(option.CheckCertificate)
+	if err != nil {
+		checkCert = true // Default to safe
+	}
+	cfg := &tls.Config{
+		InsecureSkipVerify: !checkCert,
+	}
+
+	if path := opt.Get(option.CACertificate); path != "" {
+		if cfg.RootCAs, err = loadCertPool(path); err != nil {
+			return nil, err
+		}
+	}
+	if certFile := opt.Get(option.Certificate); certFile != "" {
+		cert, err := loadClientCertificate(certFile, opt.Get(option.PrivateKey), opt.Get(option.CertificatePassword))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	} else if opt.Get(option.PrivateKey) != "" {
+		return nil, fmt.Errorf("tls: %s needs %s", option.PrivateKey, option.Certificate)
+	}
+	if v := opt.Get(option.MinTLSVersion); v != "" {
+		if cfg.MinVersion, err = parseTLSVersion(v); err != nil {
+			return nil, err
+		}
+	}
+	if s := opt.Get(option.PinnedPubkey); s != "" {
+		pins, err := parsePins(s)
+		if err != nil {
+			return nil, err
+		}
+		cfg.VerifyConnection = pins.verify
+	}
+	return cfg, nil
 }
 
 // NewClient creates a new HTTP client with custom transport
-func NewClient(opt *option.Option) *http.Client {
-	return NewClientWithTransport(NewTransport(opt), opt)
+func NewClient(opt *option.Option) (*http.Client, error) {
+	transport, err := NewTransport(opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithTransport(transport, opt), nil
 }
 
 // NewClientWithTransport creates a new HTTP client using an existing transport
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// FilenameFromContentDisposition returns the file name suggested by a
+// Content-Disposition header, or an empty string if there is none. An RFC
+// 5987 "filename*" parameter takes precedence over "filename". The name is
+// returned as sent and must be sanitized before use.
+func FilenameFromContentDisposition(value string) string {
+	if value == "" {
+		return ""
+	}
+	if _, params, err := mime.ParseMediaType(value); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+
+	// Lenient fallback for charsets mime does not decode (ISO-8859-1) and
+	// unquoted names containing spaces
+	var plain, extended string
+	for _, param := range splitParams(value) {
+		key, val, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "filename*":
+			extended = decodeExtValue(strings.TrimSpace(val))
+		case "filename":
+			val = strings.TrimSpace(val)
+			if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+				val = strings.ReplaceAll(val[1:len(val)-1], `\"`, `"`)
+			}
+			plain = val
+		}
+	}
+	if extended != "" {
+		return extended
+	}
+	return plain
+}
+
+// splitParams splits a header value at semicolons outside quoted strings
+func splitParams(value string) []string {
+	var params []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case ';':
+			if !inQuotes {
+				params = append(params, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(params, value[start:])
+}
+
+// decodeExtValue decodes an RFC 5987 ext-value (charset'language'value).
+// UTF-8 and ISO-8859-1 are supported.
+func decodeExtValue(s string) string {
+	parts := strings.SplitN(s, "'", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	decoded, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parts[0]) {
+	case "utf-8":
+		return decoded
+	case "iso-8859-1":
+		runes := make([]rune, len(decoded))
+		for i := 0; i < len(decoded); i++ {
+			runes[i] = rune(decoded[i])
+		}
+		return string(runes)
+	}
+	return ""
+}
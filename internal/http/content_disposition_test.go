@@ -0,0 +1,31 @@
+package http
+
+import "testing"
+
+func TestFilenameFromContentDisposition(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Quoted", `attachment; filename="report.pdf"`, "report.pdf"},
+		{"Token", `attachment; filename=report.pdf`, "report.pdf"},
+		{"ExtendedUTF8", `attachment; filename*=UTF-8''%E2%82%AC%20rates.txt`, "€ rates.txt"},
+		{"ExtendedWins", `attachment; filename="fallback.txt"; filename*=UTF-8''%E2%82%AC.txt`, "€.txt"},
+		{"ExtendedFirst", `attachment; filename*=UTF-8''%E2%82%AC.txt; filename="fallback.txt"`, "€.txt"},
+		{"ExtendedLatin1", `attachment; filename*=iso-8859-1'en'%A3%20rates.txt`, "£ rates.txt"},
+		{"UnquotedSpaces", `attachment; filename=my file.zip`, "my file.zip"},
+		{"QuotedSemicolon", `attachment; filename="a;b.txt"; size=3`, "a;b.txt"},
+		{"Inline", `inline`, ""},
+		{"Empty", ``, ""},
+		{"Traversal", `attachment; filename="../../etc/passwd"`, "../../etc/passwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilenameFromContentDisposition(tt.value); got != tt.want {
+				t.Errorf("FilenameFromContentDisposition(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrRangeIgnored is returned when a server answers a ranged request with
+// the whole file (200 OK)
+var ErrRangeIgnored = errors.New("server ignored the range request")
+
+// RangeError reports a partial response that does not match the requested
+// range. It is retryable: the next attempt may reach another server or a
+// healthy replica.
+type RangeError struct {
+	Start, End int64  // Requested range, inclusive; End is -1 if open
+	Total      int64  // Expected file length, 0 if unknown
+	Got        string // Content-Range or Content-Length received
+	Reason     string
+}
+
+func (e *RangeError) Error() string {
+	rng := fmt.Sprintf("%d-", e.Start)
+	if e.End >= 0 {
+		rng += strconv.FormatInt(e.End, 10)
+	}
+	return fmt.Sprintf("invalid partial response for bytes %s: %s (got %q)", rng, e.Reason, e.Got)
+}
+
+// Retryable reports whether the request may be retried
+func (e *RangeError) Retryable() bool { return true }
+
+// ParseContentRange parses a Content-Range header of the form
+// "bytes first-last/complete". complete is -1 if it is "*".
+func ParseContentRange(s string) (first, last, complete int64, err error) {
+	unit, spec, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok || !strings.EqualFold(unit, "bytes") {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	rng, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	firstStr, lastStr, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+
+	first, err1 := strconv.ParseInt(firstStr, 10, 64)
+	last, err2 := strconv.ParseInt(lastStr, 10, 64)
+	if err1 != nil || err2 != nil || first < 0 || last < first {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	complete = -1
+	if size != "*" {
+		complete, err = strconv.ParseInt(size, 10, 64)
+		if err != nil || complete <= last {
+			return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+		}
+	}
+	return first, last, complete, nil
+}
+
+// CheckPartialResponse verifies that a 206 response carries exactly the bytes
+// start-end of a file of length total (0 if unknown)
+func CheckPartialResponse(resp *http.Response, start, end, total int64) error {
+	cr := resp.Header.Get("Content-Range")
+	rangeErr := func(got, reason string) error {
+		return &RangeError{Start: start, End: end, Total: total, Got: got, Reason: reason}
+	}
+
+	first, last, complete, err := ParseContentRange(cr)
+	if err != nil {
+		return rangeErr(cr, "malformed Content-Range")
+	}
+	if first != start || last != end {
+		return rangeErr(cr, "range mismatch")
+	}
+	if total > 0 && complete >= 0 && complete != total {
+		return rangeErr(cr, "length mismatch")
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength != end-start+1 {
+		return rangeErr(strconv.FormatInt(resp.ContentLength, 10), "Content-Length mismatch")
+	}
+	return nil
+}
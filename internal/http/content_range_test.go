@@ -0,0 +1,86 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		in                    string
+		first, last, complete int64
+		wantErr               bool
+	}{
+		{"bytes 0-99/100", 0, 99, 100, false},
+		{"bytes 100-199/*", 100, 199, -1, false},
+		{"Bytes 5-5/10", 5, 5, 10, false},
+		{"bytes */100", 0, 0, 0, true},
+		{"bytes 10-5/100", 0, 0, 0, true},
+		{"bytes 0-99/99", 0, 0, 0, true},
+		{"bytes 0-99", 0, 0, 0, true},
+		{"items 0-99/100", 0, 0, 0, true},
+		{"", 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		first, last, complete, err := ParseContentRange(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseContentRange(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (first != tt.first || last != tt.last || complete != tt.complete) {
+			t.Errorf("ParseContentRange(%q) = %d, %d, %d; want %d, %d, %d",
+				tt.in, first, last, complete, tt.first, tt.last, tt.complete)
+		}
+	}
+}
+
+func TestCheckPartialResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentRange  string
+		contentLength int64
+		wantReason    string
+	}{
+		{"Valid", "bytes 100-199/1000", 100, ""},
+		{"UnknownLength", "bytes 100-199/*", -1, ""},
+		{"Missing", "", 100, "malformed Content-Range"},
+		{"WrongStart", "bytes 0-99/1000", 100, "range mismatch"},
+		{"Shortened", "bytes 100-149/1000", 50, "range mismatch"},
+		{"WrongTotal", "bytes 100-199/2000", 100, "length mismatch"},
+		{"WrongContentLength", "bytes 100-199/1000", 1000, "Content-Length mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode:    http.StatusPartialContent,
+				Header:        http.Header{},
+				ContentLength: tt.contentLength,
+			}
+			if tt.contentRange != "" {
+				resp.Header.Set("Content-Range", tt.contentRange)
+			}
+
+			err := CheckPartialResponse(resp, 100, 199, 1000)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var rangeErr *RangeError
+			if !errors.As(err, &rangeErr) {
+				t.Fatalf("expected *RangeError, got %v", err)
+			}
+			if rangeErr.Reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", rangeErr.Reason, tt.wantReason)
+			}
+			if !rangeErr.Retryable() {
+				t.Error("range errors should be retryable")
+			}
+		})
+	}
+}
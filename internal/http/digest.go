@@ -0,0 +1,104 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// digestPreference lists the checksum algorithms of digest headers from
+// strongest to weakest
+var digestPreference = []string{"sha-512", "sha-256", "sha-1", "md5", "crc32c"}
+
+// digestAlgos maps algorithm names used by digest headers to checksum names
+// and digest sizes
+var digestAlgos = map[string]struct {
+	name string
+	size int
+}{
+	"sha-512": {"sha-512", 64},
+	"sha-256": {"sha-256", 32},
+	"sha":     {"sha-1", 20},
+	"md5":     {"md5", 16},
+	"crc32c":  {"crc32c", 4},
+}
+
+// DigestFromHeader returns the strongest whole-file digest announced by a
+// response as "algo=hexdigest", or an empty string if there is none. It
+// understands Repr-Digest (RFC 9530), Digest (RFC 3230), Content-MD5 and
+// x-goog-hash. Digests of content-encoded representations are ignored.
+func DigestFromHeader(h http.Header) string {
+	if enc := h.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		return ""
+	}
+
+	digests := make(map[string]string)
+	add := func(name, value string) {
+		algo, ok := digestAlgos[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return
+		}
+		raw, err := decodeBase64(strings.TrimSpace(value))
+		if err != nil || len(raw) != algo.size {
+			return
+		}
+		if _, seen := digests[algo.name]; !seen {
+			digests[algo.name] = hex.EncodeToString(raw)
+		}
+	}
+
+	// Repr-Digest: sha-256=:base64:, sha-512=:base64:
+	for _, item := range headerItems(h, "Repr-Digest") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		value, _, _ = strings.Cut(value, ";")
+		value = strings.TrimSpace(value)
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			continue
+		}
+		add(name, value[1:len(value)-1])
+	}
+
+	// Digest: SHA-256=base64 and x-goog-hash: crc32c=base64,md5=base64
+	for _, key := range []string{"Digest", "X-Goog-Hash"} {
+		for _, item := range headerItems(h, key) {
+			if name, value, ok := strings.Cut(item, "="); ok {
+				add(name, value)
+			}
+		}
+	}
+
+	if v := h.Get("Content-MD5"); v != "" {
+		add("md5", v)
+	}
+
+	for _, algo := range digestPreference {
+		if d, ok := digests[algo]; ok {
+			return algo + "=" + d
+		}
+	}
+	return ""
+}
+
+// headerItems splits all values of a comma separated header
+func headerItems(h http.Header, key string) []string {
+	var items []string
+	for _, v := range h.Values(key) {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	if strings.HasSuffix(s, "=") {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDigestFromHeader(t *testing.T) {
+	// Digests of "abc"
+	const (
+		sha256B64 = "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0="
+		sha256Hex = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+		md5B64    = "kAFQmDzST7DWlj99KOF/cg=="
+		md5Hex    = "900150983cd24fb0d6963f7d28e17f72"
+		crc32cB64 = "Nks/tw=="
+	)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{"ReprDigest", http.Header{"Repr-Digest": {"sha-256=:" + sha256B64 + ":"}}, "sha-256=" + sha256Hex},
+		{"ReprDigestUnknownAlgo", http.Header{"Repr-Digest": {"id-sha-256=:" + sha256B64 + ":, unixsum=:AAA=:"}}, ""},
+		{"Digest", http.Header{"Digest": {"MD5=" + md5B64 + ", SHA-256=" + sha256B64}}, "sha-256=" + sha256Hex},
+		{"ContentMD5", http.Header{"Content-Md5": {md5B64}}, "md5=" + md5Hex},
+		{"GoogHash", http.Header{"X-Goog-Hash": {"crc32c=" + crc32cB64, "md5=" + md5B64}}, "md5=" + md5Hex},
+		{"GoogHashCRC32COnly", http.Header{"X-Goog-Hash": {"crc32c=" + crc32cB64}}, "crc32c=364b3fb7"},
+		{"WrongSize", http.Header{"Digest": {"SHA-256=" + md5B64}}, ""},
+		{"Encoded", http.Header{"Content-Encoding": {"gzip"}, "Content-Md5": {md5B64}}, ""},
+		{"None", http.Header{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DigestFromHeader(tt.header); got != tt.want {
+				t.Errorf("DigestFromHeader = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// NetrcEntry is the login of a machine in a .netrc file
+type NetrcEntry struct {
+	Login    string
+	Password string
+}
+
+// Netrc holds the credentials of a .netrc file by host name
+type Netrc struct {
+	machines map[string]NetrcEntry // By lower-case host name
+	def      *NetrcEntry           // The default entry, nil if there is none
+}
+
+// DefaultNetrcPath returns the path of the user's .netrc file ($HOME/.netrc,
+// or $HOME/_netrc on Windows), "" if the home directory is unknown
+func DefaultNetrcPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(home, name)
+}
+
+// LoadNetrc reads the .netrc file at path. Files that other users can read
+// are rejected, since they hold passwords.
+func LoadNetrc(path string) (*Netrc, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if runtime.GOOS != "windows" {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			return nil, fmt.Errorf("netrc: %s must not be accessible by other users (chmod 600)", path)
+		}
+	}
+	n, err := ParseNetrc(f)
+	if err != nil {
+		return nil, fmt.Errorf("netrc: %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// ParseNetrc parses .netrc data: machine entries with login and password
+// tokens, an optional default entry, and macdef definitions, which are
+// skipped. Tokens may be double-quoted.
+func ParseNetrc(r io.Reader) (*Netrc, error) {
+	tokens, err := netrcTokens(r)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Netrc{machines: make(map[string]NetrcEntry)}
+	var entry *NetrcEntry
+	var host string
+	flush := func() {
+		if entry == nil {
+			return
+		}
+		if host == "" {
+			n.def = entry
+		} else if _, ok := n.machines[host]; !ok {
+			// The first entry of a machine wins
+			n.machines[host] = *entry
+		}
+		entry = nil
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.value {
+		case "machine", "default":
+			flush()
+			entry, host = &NetrcEntry{}, ""
+			if tok.value == "machine" {
+				if i+1 >= len(tokens) {
+					return nil, fmt.Errorf("line %d: machine without a name", tok.line)
+				}
+				i++
+				host = strings.ToLower(tokens[i].value)
+			}
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("line %d: %s without a value", tok.line, tok.value)
+			}
+			i++
+			if entry == nil {
+				return nil, fmt.Errorf("line %d: %s outside of a machine entry", tok.line, tok.value)
+			}
+			switch tok.value {
+			case "login":
+				entry.Login = tokens[i].value
+			case "password":
+				entry.Password = tokens[i].value
+			}
+		case "macdef":
+			// The macro name follows and its body was dropped by netrcTokens
+			flush()
+			i++
+		default:
+			return nil, fmt.Errorf("line %d: unexpected token %q", tok.line, tok.value)
+		}
+	}
+	flush()
+	return n, nil
+}
+
+// Lookup returns the credentials for the host name host (without a port),
+// falling back to the default entry. Host names must match exactly: an
+// entry for example.com does not apply to www.example.com.
+func (n *Netrc) Lookup(host string) (login, password string, ok bool) {
+	if n == nil {
+		return "", "", false
+	}
+	if e, found := n.machines[strings.ToLower(host)]; found {
+		return e.Login, e.Password, true
+	}
+	if n.def != nil {
+		return n.def.Login, n.def.Password, true
+	}
+	return "", "", false
+}
+
+type netrcToken struct {
+	value string
+	line  int
+}
+
+// netrcTokens splits .netrc data into tokens, dropping comments and the
+// bodies of macdef definitions, which run until an empty line
+func netrcTokens(r io.Reader) ([]netrcToken, error) {
+	var tokens []netrcToken
+	scanner := bufio.NewScanner(r)
+	inMacro := false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(text) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+		for rest := text; ; {
+			rest = strings.TrimLeft(rest, " \t\r")
+			if rest == "" {
+				break
+			}
+			var value string
+			if rest[0] == '"' {
+				var b strings.Builder
+				i := 1
+				for ; i < len(rest) && rest[i] != '"'; i++ {
+					if rest[i] == '\\' && i+1 < len(rest) {
+						i++
+					}
+					b.WriteByte(rest[i])
+				}
+				if i >= len(rest) {
+					return nil, fmt.Errorf("line %d: unterminated quoted token", line)
+				}
+				value, rest = b.String(), rest[i+1:]
+			} else {
+				end := strings.IndexAny(rest, " \t\r")
+				if end < 0 {
+					end = len(rest)
+				}
+				value, rest = rest[:end], rest[end:]
+			}
+			tokens = append(tokens, netrcToken{value: value, line: line})
+		}
+		// A macro body starts on the line after "macdef name"
+		if n := len(tokens); n >= 2 && tokens[n-2].value == "macdef" && tokens[n-2].line == line {
+			inMacro = true
+		}
+	}
+	return tokens, scanner.Err()
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	n, err := ParseNetrc(strings.NewReader(`# CI credentials
+machine example.com login alice password s3cret
+machine Files.Example.com
+	login bob
+	password "two words \"quoted\""
+	account ignored
+
+macdef init
+cd /pub
+binary
+
+machine example.com login shadowed password shadowed
+default login anonymous password guest@
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host, login, password string
+	}{
+		{"example.com", "alice", "s3cret"},
+		{"EXAMPLE.com", "alice", "s3cret"},
+		{"files.example.com", "bob", `two words "quoted"`},
+		{"www.example.com", "anonymous", "guest@"}, // Only the default applies to other hosts
+	}
+	for _, tt := range tests {
+		login, password, ok := n.Lookup(tt.host)
+		if !ok || login != tt.login || password != tt.password {
+			t.Errorf("Lookup(%q) = %q, %q, %v, want %q, %q", tt.host, login, password, ok, tt.login, tt.password)
+		}
+	}
+}
+
+func TestParseNetrc_NoDefault(t *testing.T) {
+	n, err := ParseNetrc(strings.NewReader("machine example.com login alice password s3cret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := n.Lookup("other.example.com"); ok {
+		t.Error("credentials returned for another host")
+	}
+	var none *Netrc
+	if _, _, ok := none.Lookup("example.com"); ok {
+		t.Error("nil Netrc returned credentials")
+	}
+}
+
+func TestParseNetrc_Errors(t *testing.T) {
+	for _, data := range []string{
+		"login alice password s3cret",
+		"machine example.com login",
+		"machine example.com user alice",
+		`machine example.com password "unterminated`,
+		"machine",
+	} {
+		if _, err := ParseNetrc(strings.NewReader(data)); err == nil {
+			t.Errorf("ParseNetrc(%q) succeeded", data)
+		}
+	}
+}
+
+func TestLoadNetrc_Permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not checked on Windows")
+	}
+	path := filepath.Join(t.TempDir(), ".netrc")
+	if err := os.WriteFile(path, []byte("machine example.com login alice password s3cret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadNetrc(path); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("LoadNetrc of a world-readable file = %v, want an error", err)
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	n, err := LoadNetrc(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login, _, ok := n.Lookup("example.com"); !ok || login != "alice" {
+		t.Errorf("Lookup = %q, %v", login, ok)
+	}
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError reports a response with an unexpected status code
+type StatusError struct {
+	Code       int
+	Status     string        // e.g. "503 Service Unavailable"
+	RetryAfter time.Duration // From the Retry-After header, 0 if absent
+}
+
+// NewStatusError returns the error for an unexpected response
+func NewStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		Code:       resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server returned %s", e.Status)
+}
+
+// Throttled reports whether the server asks the client to slow down
+// (429 Too Many Requests or 503 Service Unavailable)
+func (e *StatusError) Throttled() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code == http.StatusServiceUnavailable
+}
+
+// ParseRetryAfter returns the wait a Retry-After header value asks for,
+// given in seconds or as an HTTP date. Invalid values and dates in the past
+// give 0.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
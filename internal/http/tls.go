@@ -0,0 +1,259 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// tlsOptions are the options NewTLSConfig reads
+var tlsOptions = []string{
+	option.CheckCertificate,
+	option.CACertificate,
+	option.Certificate,
+	option.PrivateKey,
+	option.CertificatePassword,
+	option.MinTLSVersion,
+	option.PinnedPubkey,
+}
+
+// SameTLSConfig reports whether a and b configure TLS alike, so that their
+// downloads can share a transport
+func SameTLSConfig(a, b *option.Option) bool {
+	for _, name := range tlsOptions {
+		if a.Get(name) != b.Get(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadCertPool returns the system roots with the PEM certificates of path
+// added, path being a bundle file or a directory of them
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	files := []string{path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	found := false
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		// Files other than certificates are skipped in directories
+		found = pool.AppendCertsFromPEM(data) || found
+	}
+	if !found {
+		return nil, fmt.Errorf("tls: no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// loadClientCertificate reads the client certificate at certFile with its
+// key. PEM files may hold the key themselves if keyFile is empty; other
+// files are decoded as PKCS#12 with password.
+func loadClientCertificate(certFile, keyFile, password string) (tls.Certificate, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if block, _ := pem.Decode(data); block == nil {
+		if keyFile != "" {
+			return tls.Certificate{}, fmt.Errorf("tls: %s is not PEM; PKCS#12 files hold their own key", certFile)
+		}
+		cert, err := parsePKCS12(data, password)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("tls: %s: %w", certFile, err)
+		}
+		return cert, nil
+	}
+
+	keyData := data
+	if keyFile != "" {
+		if keyData, err = os.ReadFile(keyFile); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	cert, err := tls.X509KeyPair(data, keyData)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("tls: %s: %w", certFile, err)
+	}
+	return cert, nil
+}
+
+// parsePKCS12 decodes a PKCS#12 archive holding a private key, its
+// certificate and possibly the chain of the certificate
+func parsePKCS12(data []byte, password string) (tls.Certificate, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	var certs []*pem.Block
+	var keyPEM []byte
+	for _, block := range blocks {
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block)
+		} else {
+			keyPEM = pem.EncodeToMemory(block)
+		}
+	}
+	// The archive lists the chain in no particular order, but the
+	// certificate of the key has to come first
+	err = errors.New("no certificate")
+	for i := range certs {
+		var certPEM bytes.Buffer
+		pem.Encode(&certPEM, certs[i])
+		for j, block := range certs {
+			if j != i {
+				pem.Encode(&certPEM, block)
+			}
+		}
+		var cert tls.Certificate
+		if cert, err = tls.X509KeyPair(certPEM.Bytes(), keyPEM); err == nil {
+			return cert, nil
+		}
+	}
+	return tls.Certificate{}, err
+}
+
+// parseTLSVersion returns the version constant of "1.0" to "1.3"
+func parseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "TLS") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("tls: unknown TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", s)
+}
+
+// pinSet holds the SHA-256 hashes of the SubjectPublicKeyInfo a host may
+// present, by lower-case host name. Names starting with "*." match every
+// subdomain.
+type pinSet map[string][][sha256.Size]byte
+
+// parsePins parses pinned public keys, one host=sha256//<base64> entry per
+// line. Several pins for a host are separated by ';' or given on more lines;
+// the "sha256//" prefix is optional.
+func parsePins(s string) (pinSet, error) {
+	pins := make(pinSet)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		host, values, ok := strings.Cut(line, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !ok || host == "" {
+			return nil, fmt.Errorf("tls: pin %q is not host=sha256//<base64>", line)
+		}
+		for _, v := range strings.Split(values, ";") {
+			v = strings.TrimPrefix(strings.TrimSpace(v), "sha256//")
+			sum, err := base64.StdEncoding.DecodeString(v)
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("tls: pin for %s is not a base64 SHA-256 hash: %q", host, v)
+			}
+			pins[host] = append(pins[host], [sha256.Size]byte(sum))
+		}
+	}
+	return pins, nil
+}
+
+// lookup returns the pins of host, nil if it has none
+func (p pinSet) lookup(host string) [][sha256.Size]byte {
+	host = strings.ToLower(host)
+	if pins, ok := p[host]; ok {
+		return pins
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if pins, ok := p["*."+host]; ok {
+			return pins
+		}
+	}
+	return nil
+}
+
+// ErrPinMismatch is returned for connections whose certificates match none
+// of the pins of their host
+var ErrPinMismatch = errors.New("tls: certificate does not match the pinned public keys")
+
+// IsCertificateError reports whether err is a certificate of the server
+// failing verification or pinning, or the server refusing the handshake,
+// typically over the client certificate or the TLS version. Retrying fails
+// the same way.
+func IsCertificateError(err error) bool {
+	var (
+		verifyErr *tls.CertificateVerificationError
+		opErr     *net.OpError
+	)
+	// Alerts of the server come as a "remote error" of an unexported type
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		return true
+	}
+	return errors.As(err, &verifyErr) || errors.Is(err, ErrPinMismatch)
+}
+
+// verify checks the connection against the pins of its server name. With
+// verified chains, any certificate of a chain may match, so intermediates
+// can be pinned; without verification only the leaf is trusted to.
+func (p pinSet) verify(cs tls.ConnectionState) error {
+	pins := p.lookup(cs.ServerName)
+	if pins == nil {
+		return nil
+	}
+	var candidates []*x509.Certificate
+	for _, chain := range cs.VerifiedChains {
+		candidates = append(candidates, chain...)
+	}
+	if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+		candidates = cs.PeerCertificates[:1]
+	}
+	for _, cert := range candidates {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if subtle.ConstantTimeCompare(sum[:], pin[:]) == 1 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w of %s", ErrPinMismatch, cs.ServerName)
+}
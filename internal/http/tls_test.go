@@ -0,0 +1,348 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// testCA issues certificates for localhost servers and their clients
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for localhost, or for a client, in PEM
+func (ca *testCA) issue(t *testing.T, client bool) (certPEM, keyPEM []byte, cert tls.Certificate) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if client {
+		tmpl.Subject.CommonName = "client"
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	cert, _ = tls.X509KeyPair(certPEM, keyPEM)
+	return certPEM, keyPEM, cert
+}
+
+// pin returns the pinned-pubkey value of cert
+func pin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// newMTLSServer starts a localhost server with a certificate of ca that
+// requires client certificates of clientCAs
+func newMTLSServer(t *testing.T, ca *testCA, clientCAs *x509.CertPool) (*httptest.Server, string) {
+	t.Helper()
+	_, _, cert := ca.issue(t, false)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	// Pins apply to host names, which are sent with SNI
+	return server, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+}
+
+func get(t *testing.T, opt *option.Option, url string) (string, error) {
+	t.Helper()
+	client, err := NewClient(opt)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewTLSConfig_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	_, url := newMTLSServer(t, ca, clientCAs)
+
+	dir := t.TempDir()
+	certPEM, keyPEM, _ := ca.issue(t, true)
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+	combined := writeFile(t, dir, "client.pem", append(append([]byte{}, certPEM...), keyPEM...))
+
+	caDir := filepath.Join(dir, "certs")
+	os.Mkdir(caDir, 0700)
+	writeFile(t, caDir, "internal-ca.pem", ca.pem)
+	writeFile(t, caDir, "README", []byte("not a certificate"))
+
+	tests := []struct {
+		name string
+		opts map[string]string
+		err  string // "" for success
+	}{
+		{"cert and key files", map[string]string{option.CACertificate: caFile, option.Certificate: certFile, option.PrivateKey: keyFile}, ""},
+		{"key in the certificate file", map[string]string{option.CACertificate: caFile, option.Certificate: combined}, ""},
+		{"CA directory", map[string]string{option.CACertificate: caDir, option.Certificate: certFile, option.PrivateKey: keyFile}, ""},
+		{"no client certificate", map[string]string{option.CACertificate: caFile}, "certificate"},
+		{"unknown CA", map[string]string{option.Certificate: certFile, option.PrivateKey: keyFile}, "unknown authority"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := option.GetDefaultOptions()
+			for k, v := range tt.opts {
+				opt.Put(k, v)
+			}
+			body, err := get(t, opt, url)
+			if tt.err == "" {
+				if err != nil || body != "hello client" {
+					t.Errorf("GET = %q, %v", body, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("GET error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig_PKCS12(t *testing.T) {
+	opt := option.GetDefaultOptions()
+	opt.Put(option.Certificate, filepath.Join("testdata", "client.p12"))
+	opt.Put(option.CertificatePassword, "hydra")
+	cfg, err := NewTLSConfig(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := cfg.Certificates[0]
+	if len(cert.Certificate) != 2 || cert.Leaf == nil || cert.Leaf.Subject.CommonName != "hydra-client" {
+		t.Fatalf("certificate = %d certs, leaf %v", len(cert.Certificate), cert.Leaf)
+	}
+
+	// A server trusting the CA in the archive accepts the certificate
+	issuer, _ := x509.ParseCertificate(cert.Certificate[1])
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(issuer)
+	ca := newTestCA(t)
+	_, url := newMTLSServer(t, ca, clientCAs)
+	opt.Put(option.CACertificate, writeFile(t, t.TempDir(), "ca.pem", ca.pem))
+	if body, err := get(t, opt, url); err != nil || body != "hello hydra-client" {
+		t.Errorf("GET = %q, %v", body, err)
+	}
+
+	opt.Put(option.CertificatePassword, "wrong")
+	if _, err := NewTLSConfig(opt); err == nil {
+		t.Error("wrong password accepted")
+	}
+}
+
+func TestNewTLSConfig_Pinning(t *testing.T) {
+	ca := newTestCA(t)
+	_, _, serverCert := ca.issue(t, false)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pinned"))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	defer server.Close()
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	caFile := writeFile(t, t.TempDir(), "ca.pem", ca.pem)
+	other := newTestCA(t)
+
+	tests := []struct {
+		name     string
+		pins     string
+		insecure bool
+		ok       bool
+	}{
+		{"leaf", "localhost=" + pin(serverCert.Leaf), false, true},
+		{"one of several", "LOCALHOST=" + pin(other.cert) + ";" + pin(serverCert.Leaf), false, true},
+		{"issuer", "localhost=" + pin(ca.cert), false, true},
+		{"other host", "example.com=" + pin(other.cert), false, true},
+		{"wrong key", "localhost=" + pin(other.cert), false, false},
+		{"unverified leaf", "localhost=" + pin(serverCert.Leaf), true, true},
+		{"unverified issuer", "localhost=" + pin(ca.cert), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := option.GetDefaultOptions()
+			opt.Put(option.PinnedPubkey, tt.pins)
+			if tt.insecure {
+				opt.Put(option.CheckCertificate, "false")
+			} else {
+				opt.Put(option.CACertificate, caFile)
+			}
+			body, err := get(t, opt, url)
+			if tt.ok && (err != nil || body != "pinned") {
+				t.Errorf("GET = %q, %v", body, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrPinMismatch) {
+				t.Errorf("GET error = %v, want ErrPinMismatch", err)
+			}
+		})
+	}
+}
+
+func TestParsePins(t *testing.T) {
+	sum := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	pins, err := parsePins("files.example.com=sha256//" + sum + "\n\n*.internal=" + sum + ";" + sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]int{
+		"files.example.com":  1,
+		"FILES.example.com":  1,
+		"example.com":        0,
+		"a.b.internal":       2,
+		"internal":           0,
+		"files.example.com.": 0,
+	} {
+		if got := len(pins.lookup(host)); got != want {
+			t.Errorf("lookup(%s) = %d pins, want %d", host, got, want)
+		}
+	}
+
+	for _, bad := range []string{"example.com", "=" + sum, "example.com=sha256//short", "example.com=" + sum + ";"} {
+		if _, err := parsePins(bad); err == nil {
+			t.Errorf("parsePins(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestNewTLSConfig_Options(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		opts map[string]string
+		ok   bool
+	}{
+		{"defaults", nil, true},
+		{"min version", map[string]string{option.MinTLSVersion: "1.3"}, true},
+		{"min version with prefix", map[string]string{option.MinTLSVersion: "TLS1.2"}, true},
+		{"unknown version", map[string]string{option.MinTLSVersion: "1.4"}, false},
+		{"missing CA file", map[string]string{option.CACertificate: filepath.Join(dir, "missing.pem")}, false},
+		{"CA file without certificates", map[string]string{option.CACertificate: writeFile(t, dir, "empty.pem", []byte("nothing"))}, false},
+		{"key without certificate", map[string]string{option.PrivateKey: filepath.Join(dir, "client.key")}, false},
+		{"bad pin", map[string]string{option.PinnedPubkey: "localhost"}, false},
+	}
+	for _, tt := range tests {
+		opt := option.GetDefaultOptions()
+		for k, v := range tt.opts {
+			opt.Put(k, v)
+		}
+		_, err := NewTransport(opt)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: NewTransport error = %v", tt.name, err)
+		}
+	}
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.MinTLSVersion, "1.3")
+	cfg, _ := NewTLSConfig(opt)
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x", cfg.MinVersion)
+	}
+}
+
+func TestNewTLSConfig_MinVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	opt := option.GetDefaultOptions()
+	opt.Put(option.CheckCertificate, "false")
+	if _, err := get(t, opt, server.URL); err != nil {
+		t.Fatalf("TLS 1.2 server: %v", err)
+	}
+	opt.Put(option.MinTLSVersion, "1.3")
+	if _, err := get(t, opt, server.URL); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("TLS 1.2 server with min-tls-version 1.3: %v", err)
+	}
+}
+
+func TestSameTLSConfig(t *testing.T) {
+	a, b := option.GetDefaultOptions(), option.GetDefaultOptions()
+	b.Put(option.Split, "16")
+	if !SameTLSConfig(a, b) {
+		t.Error("options other than TLS make configs differ")
+	}
+	b.Put(option.CACertificate, "/etc/ssl/internal.pem")
+	if SameTLSConfig(a, b) {
+		t.Error("different CA certificates are the same config")
+	}
+}
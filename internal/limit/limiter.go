@@ -10,12 +10,22 @@ import (
 // BandwidthLimiter limits the rate of data transfer
 type BandwidthLimiter struct {
 	limiter *rate.Limiter
+	shared  *SharedLimiter // Limit shared with other downloads, if any
+	served  int64          // Bytes served by the shared limit, guarded by its mu
 }
 
 // NewBandwidthLimiter creates a new limiter with bytes per second limit
 func NewBandwidthLimiter(limit int) *BandwidthLimiter {
+	b := &BandwidthLimiter{limiter: rate.NewLimiter(rate.Inf, 0)}
+	b.SetLimit(limit)
+	return b
+}
+
+// SetLimit changes the limit in bytes per second, 0 for unlimited
+func (b *BandwidthLimiter) SetLimit(limit int) {
 	if limit <= 0 {
-		return &BandwidthLimiter{limiter: nil}
+		b.limiter.SetLimit(rate.Inf)
+		return
 	}
 	// Burst size approx 1 second worth of data or fixed reasonable size
 	burst := limit
@@ -26,17 +36,49 @@ func NewBandwidthLimiter(limit int) *BandwidthLimiter {
 	// Note: We don't cap burst anymore to prevent throttling on every read for high-speed downloads,
 	// allowing 256KB chunks to pass through.
 
-	return &BandwidthLimiter{
-		limiter: rate.NewLimiter(rate.Limit(limit), burst),
+	b.limiter.SetBurst(burst)
+	b.limiter.SetLimit(rate.Limit(limit))
+}
+
+// Limit returns the limit in bytes per second, 0 if unlimited
+func (b *BandwidthLimiter) Limit() int {
+	l := b.limiter.Limit()
+	if l == rate.Inf {
+		return 0
 	}
+	return int(l)
 }
 
-// Wait blocks until the limiter allows n events to happen
+// Wait blocks until the limiter, and the shared limit it joined, allow n
+// events to happen
 func (b *BandwidthLimiter) Wait(ctx context.Context, n int) error {
-	if b.limiter == nil {
+	if b == nil {
+		return nil
+	}
+	if err := b.wait(ctx, n); err != nil {
+		return err
+	}
+	return b.shared.wait(ctx, b, n)
+}
+
+// wait waits for n events of b alone. It waits for at most a tenth of a
+// second's worth of bytes at a time, so that limit changes apply quickly.
+func (b *BandwidthLimiter) wait(ctx context.Context, n int) error {
+	if b == nil {
 		return nil
 	}
-	return b.limiter.WaitN(ctx, n)
+	for n > 0 {
+		limit := b.limiter.Limit()
+		if limit == rate.Inf {
+			return nil
+		}
+		chunk := min(n, max(int(limit)/10, 1024))
+		if err := b.limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
 }
 
 // Reader wraps an io.Reader with rate limiting
@@ -0,0 +1,158 @@
+package limit
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// SharedLimiter divides one bandwidth limit fairly among the downloads that
+// joined it, however many connections each of them reads on. Reads queue for
+// the shared bucket and are served in order of how much their download got
+// so far, so every reading download gets an equal share. A paused, slow or
+// capped download has no reads queued while it is not using its share, which
+// then goes to the others.
+type SharedLimiter struct {
+	bucket *rate.Limiter
+
+	mu      sync.Mutex
+	busy    bool    // A read is taking tokens from the bucket
+	clock   int64   // Start of the read served last, in bytes served
+	waiting []*turn // Reads queued for the bucket
+}
+
+// turn is one read queued for the shared bucket
+type turn struct {
+	start int64 // Bytes the download had been served when the read queued
+	ready chan struct{}
+}
+
+// NewSharedLimiter creates a shared limiter of limit bytes per second, 0 for
+// unlimited
+func NewSharedLimiter(limit int) *SharedLimiter {
+	s := &SharedLimiter{bucket: rate.NewLimiter(rate.Inf, 0)}
+	s.SetLimit(limit)
+	return s
+}
+
+// Join returns the limiter of a new download with its own limit of own bytes
+// per second (0 for unlimited). Its reads wait for both limits.
+func (s *SharedLimiter) Join(own int) *BandwidthLimiter {
+	b := NewBandwidthLimiter(own)
+	b.shared = s
+	return b
+}
+
+// SetLimit changes the shared limit in bytes per second, 0 for unlimited
+func (s *SharedLimiter) SetLimit(limit int) {
+	if limit <= 0 {
+		s.bucket.SetLimit(rate.Inf)
+		return
+	}
+	// Unlike a download's own limiter, the bucket only holds one chunk, so
+	// that the download starting first cannot take a second's worth of
+	// bandwidth before the others get a turn
+	s.bucket.SetBurst(max(limit/10, 1024))
+	s.bucket.SetLimit(rate.Limit(limit))
+}
+
+// Limit returns the shared limit in bytes per second, 0 if unlimited
+func (s *SharedLimiter) Limit() int {
+	l := s.bucket.Limit()
+	if l == rate.Inf {
+		return 0
+	}
+	return int(l)
+}
+
+// wait waits until b may read n bytes under the shared limit. The bytes are
+// queued in chunks of a tenth of a second's worth, so that downloads take
+// turns even within large reads.
+func (s *SharedLimiter) wait(ctx context.Context, b *BandwidthLimiter, n int) error {
+	if s == nil {
+		return nil
+	}
+	for n > 0 {
+		limit := s.Limit()
+		if limit == 0 {
+			return nil
+		}
+		chunk := min(n, max(limit/10, 1024))
+		if err := s.take(ctx, b, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// take queues a read of n bytes of b and takes its tokens from the bucket
+// once it is its turn
+func (s *SharedLimiter) take(ctx context.Context, b *BandwidthLimiter, n int) error {
+	s.mu.Lock()
+	// A download that was not reading catches up on at most a second's worth
+	// of the share it did not use
+	start := max(b.served, s.clock-int64(s.Limit()))
+	t := &turn{start: start, ready: make(chan struct{})}
+	b.served = t.start + int64(n)
+	s.waiting = append(s.waiting, t)
+	s.next()
+	s.mu.Unlock()
+
+	select {
+	case <-t.ready:
+	case <-ctx.Done():
+		s.mu.Lock()
+		for i, w := range s.waiting {
+			if w == t {
+				s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+				b.served -= int64(n)
+				s.mu.Unlock()
+				return ctx.Err()
+			}
+		}
+		s.mu.Unlock()
+		// Its turn came anyway; pass it on
+		<-t.ready
+		s.release()
+		return ctx.Err()
+	}
+
+	// The limit may have been lowered since the chunk was sized
+	var err error
+	for n > 0 && err == nil && s.bucket.Limit() != rate.Inf {
+		chunk := min(n, s.bucket.Burst())
+		err = s.bucket.WaitN(ctx, chunk)
+		n -= chunk
+	}
+	s.release()
+	return err
+}
+
+// release ends the turn of the read being served
+func (s *SharedLimiter) release() {
+	s.mu.Lock()
+	s.busy = false
+	s.next()
+	s.mu.Unlock()
+}
+
+// next gives the bucket to the queued read whose download was served the
+// least, first come first served among equals. s.mu must be held.
+func (s *SharedLimiter) next() {
+	if s.busy || len(s.waiting) == 0 {
+		return
+	}
+	first := 0
+	for i, t := range s.waiting {
+		if t.start < s.waiting[first].start {
+			first = i
+		}
+	}
+	t := s.waiting[first]
+	s.waiting = append(s.waiting[:first], s.waiting[first+1:]...)
+	s.clock = t.start
+	s.busy = true
+	close(t.ready)
+}
@@ -0,0 +1,105 @@
+package limit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// timed returns how long f took
+func timed(f func()) time.Duration {
+	start := time.Now()
+	f()
+	return time.Since(start)
+}
+
+func TestSharedLimiter_UnusedBandwidth(t *testing.T) {
+	ctx := context.Background()
+	s := NewSharedLimiter(2 << 20)
+	a := s.Join(0)
+	s.Join(0) // Never reads
+
+	a.Wait(ctx, 2<<20) // Drains the burst
+	// The idle download leaves all of the 2MB/s to a, not half of it
+	if d := timed(func() { a.Wait(ctx, 1<<20) }); d < 350*time.Millisecond || d > 900*time.Millisecond {
+		t.Errorf("1MB at 2MB/s took %v, want about 500ms", d)
+	}
+}
+
+func TestSharedLimiter_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	s := NewSharedLimiter(2 << 20)
+	a, b := s.Join(0), s.Join(0)
+	a.Wait(ctx, 2<<20)
+
+	// Two downloads reading at once take from the same 2MB/s
+	d := timed(func() {
+		var wg sync.WaitGroup
+		for _, l := range []*BandwidthLimiter{a, b} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.Wait(ctx, 1<<20)
+			}()
+		}
+		wg.Wait()
+	})
+	if d < 800*time.Millisecond || d > 1500*time.Millisecond {
+		t.Errorf("2 x 1MB at 2MB/s took %v, want about 1s", d)
+	}
+}
+
+func TestSharedLimiter_OwnLimit(t *testing.T) {
+	ctx := context.Background()
+	s := NewSharedLimiter(8 << 20)
+	a := s.Join(512 << 10)
+	a.Wait(ctx, 512<<10)
+
+	// The download's own limit caps it below the shared one
+	if d := timed(func() { a.Wait(ctx, 256<<10) }); d < 350*time.Millisecond {
+		t.Errorf("256KB at 512KB/s took %v, want about 500ms", d)
+	}
+
+	// Without an overall limit only the own limit applies
+	s.SetLimit(0)
+	if s.Limit() != 0 || a.Limit() != 512<<10 {
+		t.Errorf("limits = %d, %d; want 0, %d", s.Limit(), a.Limit(), 512<<10)
+	}
+	a.SetLimit(0)
+	if d := timed(func() { a.Wait(ctx, 64<<20) }); d > 100*time.Millisecond {
+		t.Errorf("unlimited wait took %v", d)
+	}
+}
+
+func TestSharedLimiter_FairShares(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s := NewSharedLimiter(2 << 20)
+	s.Join(0).Wait(ctx, 2<<20) // Drains the burst
+
+	// One download reads on a single connection, the other on eight
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	read := make([]int, 2)
+	for i, conns := range []int{1, 8} {
+		l := s.Join(0)
+		for range conns {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for l.Wait(ctx, 32<<10) == nil {
+					mu.Lock()
+					read[i] += 32 << 10
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	// Both get about half of the limit, not one ninth and eight ninths
+	if ratio := float64(read[0]) / float64(read[1]); ratio < 0.7 || ratio > 1.4 {
+		t.Errorf("read %d and %d bytes, want about the same", read[0], read[1])
+	}
+}
@@ -0,0 +1,190 @@
+package metalink
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+
+	"github.com/divyam234/hydra/internal/util"
+)
+
+// Metalink v4 (RFC 5854)
+
+type v4Metalink struct {
+	Files []v4File `xml:"file"`
+}
+
+type v4File struct {
+	Name        string     `xml:"name,attr"`
+	Size        int64      `xml:"size"`
+	Identity    string     `xml:"identity"`
+	Version     string     `xml:"version"`
+	Description string     `xml:"description"`
+	Hashes      []xmlHash  `xml:"hash"`
+	Pieces      []v4Pieces `xml:"pieces"`
+	URLs        []v4URL    `xml:"url"`
+}
+
+type v4Pieces struct {
+	Type   string   `xml:"type,attr"`
+	Length int64    `xml:"length,attr"`
+	Hashes []string `xml:"hash"`
+}
+
+type v4URL struct {
+	Location string `xml:"location,attr"`
+	Priority int    `xml:"priority,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type xmlHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func decodeV4(dec *xml.Decoder, root *xml.StartElement) ([]*File, error) {
+	var doc v4Metalink
+	if err := dec.DecodeElement(&doc, root); err != nil {
+		return nil, err
+	}
+
+	files := make([]*File, 0, len(doc.Files))
+	for _, xf := range doc.Files {
+		f := &File{
+			Name:        strings.TrimSpace(xf.Name),
+			Size:        xf.Size,
+			Identity:    strings.TrimSpace(xf.Identity),
+			Version:     strings.TrimSpace(xf.Version),
+			Description: strings.TrimSpace(xf.Description),
+			Hashes:      convertHashes(xf.Hashes),
+		}
+		for _, u := range xf.URLs {
+			if r := newResource(u.Value, u.Priority, u.Location); r != nil {
+				f.Resources = append(f.Resources, *r)
+			}
+		}
+		f.Pieces = choosePieces(xf.Pieces, func(p v4Pieces) *Pieces {
+			return &Pieces{Type: normalizeHashType(p.Type), Length: p.Length, Hashes: normalizeDigests(p.Hashes)}
+		})
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Metalink v3 (metalinker.org)
+
+type v3Metalink struct {
+	Files []v3File `xml:"files>file"`
+}
+
+type v3File struct {
+	Name        string     `xml:"name,attr"`
+	Size        int64      `xml:"size"`
+	Identity    string     `xml:"identity"`
+	Version     string     `xml:"version"`
+	Description string     `xml:"description"`
+	Hashes      []xmlHash  `xml:"verification>hash"`
+	Pieces      []v3Pieces `xml:"verification>pieces"`
+	URLs        []v3URL    `xml:"resources>url"`
+}
+
+type v3Pieces struct {
+	Type   string        `xml:"type,attr"`
+	Length int64         `xml:"length,attr"`
+	Hashes []v3PieceHash `xml:"hash"`
+}
+
+type v3PieceHash struct {
+	Piece int    `xml:"piece,attr"`
+	Value string `xml:",chardata"`
+}
+
+type v3URL struct {
+	Type       string `xml:"type,attr"`
+	Location   string `xml:"location,attr"`
+	Preference int    `xml:"preference,attr"`
+	Value      string `xml:",chardata"`
+}
+
+func decodeV3(dec *xml.Decoder, root *xml.StartElement) ([]*File, error) {
+	var doc v3Metalink
+	if err := dec.DecodeElement(&doc, root); err != nil {
+		return nil, err
+	}
+
+	files := make([]*File, 0, len(doc.Files))
+	for _, xf := range doc.Files {
+		f := &File{
+			Name:        strings.TrimSpace(xf.Name),
+			Size:        xf.Size,
+			Identity:    strings.TrimSpace(xf.Identity),
+			Version:     strings.TrimSpace(xf.Version),
+			Description: strings.TrimSpace(xf.Description),
+			Hashes:      convertHashes(xf.Hashes),
+		}
+		for _, u := range xf.URLs {
+			if strings.EqualFold(u.Type, "bittorrent") {
+				continue
+			}
+			// v3 preference ranges from 100 (best) down to 1
+			priority := 0
+			if u.Preference > 0 && u.Preference <= 100 {
+				priority = 101 - u.Preference
+			}
+			if r := newResource(u.Value, priority, u.Location); r != nil {
+				f.Resources = append(f.Resources, *r)
+			}
+		}
+		f.Pieces = choosePieces(xf.Pieces, func(p v3Pieces) *Pieces {
+			hashes := append([]v3PieceHash(nil), p.Hashes...)
+			sort.SliceStable(hashes, func(i, j int) bool { return hashes[i].Piece < hashes[j].Piece })
+			digests := make([]string, len(hashes))
+			for i, h := range hashes {
+				digests[i] = normalizeDigest(h.Value)
+			}
+			return &Pieces{Type: normalizeHashType(p.Type), Length: p.Length, Hashes: digests}
+		})
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// choosePieces picks the strongest supported piece hash set
+func choosePieces[T any](sets []T, convert func(T) *Pieces) *Pieces {
+	var best *Pieces
+	bestRank := len(hashPreference)
+	for _, set := range sets {
+		p := convert(set)
+		if p.Length <= 0 || len(p.Hashes) == 0 {
+			continue
+		}
+		if _, err := util.NewHash(p.Type); err != nil {
+			continue
+		}
+		for rank, algo := range hashPreference {
+			if algo == p.Type && rank < bestRank {
+				best, bestRank = p, rank
+			}
+		}
+	}
+	return best
+}
+
+func convertHashes(in []xmlHash) []Hash {
+	var out []Hash
+	for _, h := range in {
+		if h.Type == "" || strings.TrimSpace(h.Value) == "" {
+			continue
+		}
+		out = append(out, Hash{Type: normalizeHashType(h.Type), Value: normalizeDigest(h.Value)})
+	}
+	return out
+}
+
+func normalizeDigests(in []string) []string {
+	out := make([]string, len(in))
+	for i, s := range in {
+		out[i] = normalizeDigest(s)
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+// Package metalink parses Metalink v4 (RFC 5854) and v3 documents.
+package metalink
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/divyam234/hydra/internal/util"
+	"github.com/divyam234/hydra/pkg/apperror"
+)
+
+// XML namespaces of the supported versions
+const (
+	NamespaceV4 = "urn:ietf:params:xml:ns:metalink"
+	NamespaceV3 = "http://www.metalinker.org/"
+)
+
+// lowestPriority is used for resources without a priority (RFC 5854 section 4.2.16)
+const lowestPriority = 999999
+
+// hashPreference lists checksum algorithms from strongest to weakest
+var hashPreference = []string{"sha-512", "sha-384", "sha-256", "sha-224", "sha-1", "md5"}
+
+// Metalink is a parsed Metalink document
+type Metalink struct {
+	Files []*File
+}
+
+// File is a single file described by a Metalink
+type File struct {
+	Name        string // Relative path, checked against directory traversal
+	Size        int64  // 0 if not given
+	Identity    string
+	Version     string
+	Description string
+	Resources   []Resource // Sorted by priority, most preferred first
+	Hashes      []Hash     // Whole-file hashes
+	Pieces      *Pieces    // Optional per-piece hashes
+}
+
+// Resource is a mirror URL for a file
+type Resource struct {
+	URL      string
+	Priority int // 1 is the most preferred
+	Location string
+}
+
+// Hash is a whole-file checksum
+type Hash struct {
+	Type  string // Normalized algorithm name, e.g. "sha-256"
+	Value string // Lowercase hex digest
+}
+
+// Pieces holds the hashes of consecutive pieces of a file
+type Pieces struct {
+	Type   string
+	Length int64
+	Hashes []string
+}
+
+// URLs returns the resource URLs in priority order
+func (f *File) URLs() []string {
+	urls := make([]string, len(f.Resources))
+	for i, r := range f.Resources {
+		urls[i] = r.URL
+	}
+	return urls
+}
+
+// Checksum returns the strongest supported whole-file hash as "algo=digest",
+// or an empty string if there is none
+func (f *File) Checksum() string {
+	for _, algo := range hashPreference {
+		if _, err := util.NewHash(algo); err != nil {
+			continue
+		}
+		for _, h := range f.Hashes {
+			if h.Type == algo {
+				return h.Type + "=" + h.Value
+			}
+		}
+	}
+	return ""
+}
+
+// ParseFile parses the Metalink document at path
+func ParseFile(path string) (*Metalink, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a Metalink v4 or v3 document. The version is detected from
+// the namespace of the root element. Files without a usable HTTP or FTP
+// resource are skipped.
+func Parse(r io.Reader) (*Metalink, error) {
+	dec := xml.NewDecoder(r)
+
+	var root xml.StartElement
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, apperror.Wrap(apperror.ExitXmlParse, fmt.Errorf("metalink: %w", err))
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			root = se
+			break
+		}
+	}
+	if root.Name.Local != "metalink" {
+		return nil, apperror.New(apperror.ExitMetalinkParse, fmt.Sprintf("metalink: unexpected root element <%s>", root.Name.Local))
+	}
+
+	var files []*File
+	var err error
+	switch root.Name.Space {
+	case NamespaceV4:
+		files, err = decodeV4(dec, &root)
+	case NamespaceV3:
+		files, err = decodeV3(dec, &root)
+	default:
+		return nil, apperror.New(apperror.ExitMetalinkParse, fmt.Sprintf("metalink: unsupported namespace %q", root.Name.Space))
+	}
+	if err != nil {
+		return nil, apperror.Wrap(apperror.ExitXmlParse, fmt.Errorf("metalink: %w", err))
+	}
+
+	ml := &Metalink{}
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if err := validateName(f.Name); err != nil {
+			return nil, apperror.Wrap(apperror.ExitMetalinkParse, err)
+		}
+		if seen[f.Name] {
+			return nil, apperror.New(apperror.ExitMetalinkParse, fmt.Sprintf("metalink: duplicate file name %q", f.Name))
+		}
+		seen[f.Name] = true
+
+		if f.Pieces != nil && f.Size > 0 && f.Pieces.Length > 0 {
+			expected := (f.Size + f.Pieces.Length - 1) / f.Pieces.Length
+			if int64(len(f.Pieces.Hashes)) != expected {
+				return nil, apperror.New(apperror.ExitMetalinkParse,
+					fmt.Sprintf("metalink: %s has %d piece hashes, expected %d", f.Name, len(f.Pieces.Hashes), expected))
+			}
+		}
+
+		if len(f.Resources) == 0 {
+			continue
+		}
+		sort.SliceStable(f.Resources, func(i, j int) bool {
+			return f.Resources[i].Priority < f.Resources[j].Priority
+		})
+		ml.Files = append(ml.Files, f)
+	}
+
+	if len(ml.Files) == 0 {
+		return nil, apperror.New(apperror.ExitMetalinkParse, "metalink: no downloadable files")
+	}
+	return ml, nil
+}
+
+// validateName rejects file names that could escape the download directory
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("metalink: file without name")
+	}
+	if strings.Contains(name, "\\") || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("metalink: unsafe file name %q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return fmt.Errorf("metalink: unsafe file name %q", name)
+		}
+	}
+	return nil
+}
+
+// newResource returns a Resource for rawURL, or nil if its scheme is not supported
+func newResource(rawURL string, priority int, location string) *Resource {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ftp", "ftps":
+	default:
+		return nil
+	}
+	if priority <= 0 {
+		priority = lowestPriority
+	}
+	return &Resource{URL: rawURL, Priority: priority, Location: strings.ToLower(location)}
+}
+
+// normalizeHashType maps IANA and v3 hash names to the names used for checksums
+func normalizeHashType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	switch t {
+	case "sha1":
+		return "sha-1"
+	case "sha224":
+		return "sha-224"
+	case "sha256":
+		return "sha-256"
+	case "sha384":
+		return "sha-384"
+	case "sha512":
+		return "sha-512"
+	}
+	return t
+}
+
+func normalizeDigest(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
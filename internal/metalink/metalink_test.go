@@ -0,0 +1,188 @@
+package metalink
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/divyam234/hydra/pkg/apperror"
+)
+
+const v4Doc = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <published>2024-01-01T00:00:00Z</published>
+  <file name="distro.iso">
+    <identity>Distro</identity>
+    <version>1.0</version>
+    <size>1000</size>
+    <hash type="md5">0123456789ABCDEF0123456789ABCDEF</hash>
+    <hash type="sha-256">aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa</hash>
+    <pieces length="400" type="sha-1">
+      <hash>1111111111111111111111111111111111111111</hash>
+      <hash>2222222222222222222222222222222222222222</hash>
+      <hash>3333333333333333333333333333333333333333</hash>
+    </pieces>
+    <url location="de" priority="2">http://mirror-b.example/distro.iso</url>
+    <url location="us" priority="1">https://mirror-a.example/distro.iso</url>
+    <url>ftp://mirror-c.example/distro.iso</url>
+    <metaurl mediatype="torrent">http://example.com/distro.torrent</metaurl>
+  </file>
+  <file name="docs/readme.txt">
+    <url>http://example.com/readme.txt</url>
+  </file>
+</metalink>`
+
+func TestParse_V4(t *testing.T) {
+	ml, err := Parse(strings.NewReader(v4Doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(ml.Files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(ml.Files))
+	}
+
+	f := ml.Files[0]
+	if f.Name != "distro.iso" || f.Size != 1000 || f.Identity != "Distro" || f.Version != "1.0" {
+		t.Errorf("Unexpected file metadata: %+v", f)
+	}
+
+	want := []string{
+		"https://mirror-a.example/distro.iso",
+		"http://mirror-b.example/distro.iso",
+		"ftp://mirror-c.example/distro.iso",
+	}
+	got := f.URLs()
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("URLs = %v, want %v", got, want)
+	}
+	if f.Resources[0].Location != "us" {
+		t.Errorf("Location = %q, want us", f.Resources[0].Location)
+	}
+
+	if c := f.Checksum(); c != "sha-256="+strings.Repeat("a", 64) {
+		t.Errorf("Checksum = %q, expected the strongest hash", c)
+	}
+
+	if f.Pieces == nil {
+		t.Fatal("Expected piece hashes")
+	}
+	if f.Pieces.Type != "sha-1" || f.Pieces.Length != 400 || len(f.Pieces.Hashes) != 3 {
+		t.Errorf("Unexpected pieces: %+v", f.Pieces)
+	}
+
+	if ml.Files[1].Name != "docs/readme.txt" || ml.Files[1].Checksum() != "" {
+		t.Errorf("Unexpected second file: %+v", ml.Files[1])
+	}
+}
+
+const v3Doc = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+  <files>
+    <file name="tool.tar.gz">
+      <size>600</size>
+      <verification>
+        <hash type="md5">0123456789abcdef0123456789abcdef</hash>
+        <hash type="sha1">abcdefabcdefabcdefabcdefabcdefabcdefabcd</hash>
+        <pieces length="256" type="sha1">
+          <hash piece="2">cccccccccccccccccccccccccccccccccccccccc</hash>
+          <hash piece="0">aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa</hash>
+          <hash piece="1">bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb</hash>
+        </pieces>
+      </verification>
+      <resources>
+        <url type="http" location="fr" preference="50">http://low.example/tool.tar.gz</url>
+        <url type="bittorrent" preference="100">http://example.com/tool.torrent</url>
+        <url type="ftp" preference="90">ftp://high.example/tool.tar.gz</url>
+      </resources>
+    </file>
+  </files>
+</metalink>`
+
+func TestParse_V3(t *testing.T) {
+	ml, err := Parse(strings.NewReader(v3Doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(ml.Files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(ml.Files))
+	}
+
+	f := ml.Files[0]
+	if f.Size != 600 {
+		t.Errorf("Size = %d, want 600", f.Size)
+	}
+
+	urls := f.URLs()
+	if len(urls) != 2 || urls[0] != "ftp://high.example/tool.tar.gz" {
+		t.Errorf("Expected torrent dropped and higher preference first, got %v", urls)
+	}
+
+	if c := f.Checksum(); c != "sha-1=abcdefabcdefabcdefabcdefabcdefabcdefabcd" {
+		t.Errorf("Checksum = %q", c)
+	}
+
+	if f.Pieces == nil || f.Pieces.Type != "sha-1" {
+		t.Fatalf("Unexpected pieces: %+v", f.Pieces)
+	}
+	if f.Pieces.Hashes[0][0] != 'a' || f.Pieces.Hashes[2][0] != 'c' {
+		t.Errorf("Piece hashes not ordered by piece index: %v", f.Pieces.Hashes)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		code apperror.ExitStatus
+	}{
+		{"MalformedXML", `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="a">`, apperror.ExitXmlParse},
+		{"Empty", ``, apperror.ExitXmlParse},
+		{"WrongRoot", `<feed/>`, apperror.ExitMetalinkParse},
+		{"UnknownNamespace", `<metalink xmlns="urn:example"/>`, apperror.ExitMetalinkParse},
+		{"NoFiles", `<metalink xmlns="urn:ietf:params:xml:ns:metalink"></metalink>`, apperror.ExitMetalinkParse},
+		{"NoUsableURL", `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+			<file name="a"><url>magnet:?xt=urn:btih:abc</url></file></metalink>`, apperror.ExitMetalinkParse},
+		{"Traversal", `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+			<file name="../etc/passwd"><url>http://example.com/a</url></file></metalink>`, apperror.ExitMetalinkParse},
+		{"AbsolutePath", `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+			<file name="/etc/passwd"><url>http://example.com/a</url></file></metalink>`, apperror.ExitMetalinkParse},
+		{"Duplicate", `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+			<file name="a"><url>http://example.com/a</url></file>
+			<file name="a"><url>http://example.com/b</url></file></metalink>`, apperror.ExitMetalinkParse},
+		{"PieceCount", `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+			<file name="a"><size>1000</size>
+			<pieces length="400" type="sha-1"><hash>1111111111111111111111111111111111111111</hash></pieces>
+			<url>http://example.com/a</url></file></metalink>`, apperror.ExitMetalinkParse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.doc))
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			var appErr *apperror.Error
+			if !errors.As(err, &appErr) {
+				t.Fatalf("Expected apperror, got %T: %v", err, err)
+			}
+			if appErr.Code != tt.code {
+				t.Errorf("Code = %d, want %d (%v)", appErr.Code, tt.code, err)
+			}
+		})
+	}
+}
+
+func TestParse_SkipsFilesWithoutURLs(t *testing.T) {
+	doc := `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+		<file name="torrent-only"><metaurl mediatype="torrent">http://example.com/t</metaurl></file>
+		<file name="b"><url>http://example.com/b</url></file>
+	</metalink>`
+
+	ml, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(ml.Files) != 1 || ml.Files[0].Name != "b" {
+		t.Errorf("Expected only file b, got %d files", len(ml.Files))
+	}
+}
@@ -0,0 +1,143 @@
+// Package retry decides which failed requests are tried again and how long
+// to wait before each try.
+//
+// Errors are classified by what they say about the request: client errors
+// (4xx other than 408 Request Timeout and 429 Too Many Requests), permanent
+// FTP replies and certificates failing verification or pinning would fail
+// again, while network errors, server errors and short or mismatched bodies
+// are worth retrying. Waits grow exponentially with random jitter, and a
+// Retry-After sent with 429 or 503 is honored.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/hydra/internal/ftp"
+	internalhttp "github.com/divyam234/hydra/internal/http"
+)
+
+// DefaultJitter is the fraction of each wait that is randomized
+const DefaultJitter = 0.5
+
+// Policy decides whether a failed request is tried again
+type Policy interface {
+	// Retry is called after a request failed with err for the failures-th
+	// time in a row. It returns whether to try again and how long to wait
+	// first.
+	Retry(failures int, err error) (time.Duration, bool)
+}
+
+// Backoff retries retryable errors, waiting Initial after the first failure
+// and twice as long after each further one
+type Backoff struct {
+	Initial  time.Duration // Wait after the first failure
+	Max      time.Duration // Longest wait, 0 for no limit
+	Jitter   float64       // Fraction of each wait that is random, 0 to 1
+	NotFound bool          // Retry "file not found" answers as well
+}
+
+// Retry implements Policy. A Retry-After longer than Max is cut to Max.
+func (b *Backoff) Retry(failures int, err error) (time.Duration, bool) {
+	if !Retryable(err) && !(b.NotFound && NotFound(err)) {
+		return 0, false
+	}
+	retryAfter := RetryAfter(err)
+	if b.Max > 0 {
+		retryAfter = min(retryAfter, b.Max)
+	}
+	return max(b.Delay(failures), retryAfter), true
+}
+
+// Delay returns the wait after the failures-th failure in a row
+func (b *Backoff) Delay(failures int) time.Duration {
+	if b.Initial <= 0 || failures < 1 {
+		return 0
+	}
+	d := b.Initial
+	for i := 1; i < failures && (b.Max <= 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max > 0 {
+		d = min(d, b.Max)
+	}
+	if b.Jitter > 0 {
+		d -= time.Duration(min(b.Jitter, 1) * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// Retryable reports whether a request that failed with err may succeed if
+// tried again
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *internalhttp.StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.Code >= 400 && statusErr.Code < 500 {
+			return statusErr.Code == http.StatusRequestTimeout || statusErr.Code == http.StatusTooManyRequests
+		}
+		return true
+	}
+	var ftpErr *ftp.Error
+	if errors.As(err, &ftpErr) {
+		return !ftpErr.Permanent()
+	}
+	// Certificates failing verification or pinning fail again
+	if internalhttp.IsCertificateError(err) {
+		return false
+	}
+	return true
+}
+
+// NotFound reports whether err says the file does not exist on the server
+// (HTTP 404 or FTP 550)
+func NotFound(err error) bool {
+	var statusErr *internalhttp.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusNotFound
+	}
+	var ftpErr *ftp.Error
+	if errors.As(err, &ftpErr) {
+		return ftpErr.Code == 550
+	}
+	return false
+}
+
+// RetryAfter returns the wait a 429 or 503 answer asked for, 0 if none
+func RetryAfter(err error) time.Duration {
+	var statusErr *internalhttp.StatusError
+	if errors.As(err, &statusErr) && statusErr.Throttled() {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
+
+// ParseWait parses a wait given in seconds ("2", "0.5") or as a Go
+// duration ("500ms", "1m")
+func ParseWait(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		if secs < 0 {
+			return 0, errors.New("must not be negative")
+		}
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return d, nil
+}
@@ -0,0 +1,124 @@
+package retry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/divyam234/hydra/internal/ftp"
+	internalhttp "github.com/divyam234/hydra/internal/http"
+)
+
+func statusErr(code int) error {
+	return &internalhttp.StatusError{Code: code, Status: http.StatusText(code)}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"short body", io.ErrUnexpectedEOF, true},
+		{"server error", statusErr(http.StatusInternalServerError), true},
+		{"unavailable", statusErr(http.StatusServiceUnavailable), true},
+		{"request timeout", statusErr(http.StatusRequestTimeout), true},
+		{"too many requests", statusErr(http.StatusTooManyRequests), true},
+		{"not found", statusErr(http.StatusNotFound), false},
+		{"forbidden", fmt.Errorf("segment 3: %w", statusErr(http.StatusForbidden)), false},
+		{"ftp transient", &ftp.Error{Code: 421, Message: "too many users"}, true},
+		{"ftp permanent", &ftp.Error{Code: 550, Message: "no such file"}, false},
+		{"unknown authority", &url.Error{Op: "Get", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, false},
+		{"pin mismatch", fmt.Errorf("%w of example.com", internalhttp.ErrPinMismatch), false},
+		{"certificate refused", &net.OpError{Op: "remote error", Err: errors.New("tls: certificate required")}, false},
+		{"cancelled", context.Canceled, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := &Backoff{Initial: time.Second, Max: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := b.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(2); d <= time.Second || d > 2*time.Second {
+			t.Fatalf("Delay(2) with jitter = %v, want within (1s, 2s]", d)
+		}
+	}
+
+	if d := (&Backoff{}).Delay(3); d != 0 {
+		t.Errorf("Delay without an initial wait = %v, want 0", d)
+	}
+}
+
+func TestBackoff_Retry(t *testing.T) {
+	b := &Backoff{Initial: time.Second}
+
+	if _, ok := b.Retry(1, statusErr(http.StatusNotFound)); ok {
+		t.Error("404 retried")
+	}
+	b.NotFound = true
+	if _, ok := b.Retry(1, statusErr(http.StatusNotFound)); !ok {
+		t.Error("404 not retried with NotFound set")
+	}
+
+	// Retry-After is honored when it asks for more than the backoff
+	err := &internalhttp.StatusError{Code: http.StatusTooManyRequests, RetryAfter: 30 * time.Second}
+	if wait, ok := b.Retry(1, err); !ok || wait != 30*time.Second {
+		t.Errorf("Retry(429 with Retry-After) = %v, %v, want 30s, true", wait, ok)
+	}
+	if wait, _ := b.Retry(1, errors.New("reset")); wait != time.Second {
+		t.Errorf("Retry(network error) waits %v, want 1s", wait)
+	}
+
+	// but not beyond the longest wait
+	b.Max = 10 * time.Second
+	err = &internalhttp.StatusError{Code: http.StatusServiceUnavailable, RetryAfter: 24 * time.Hour}
+	if wait, ok := b.Retry(1, err); !ok || wait != 10*time.Second {
+		t.Errorf("Retry(503 with Retry-After: 86400) = %v, %v, want 10s, true", wait, ok)
+	}
+}
+
+func TestParseWait(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"2", 2 * time.Second, false},
+		{"0.5", 500 * time.Millisecond, false},
+		{"250ms", 250 * time.Millisecond, false},
+		{"1m", time.Minute, false},
+		{"-1", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWait(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseWait(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
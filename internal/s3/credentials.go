@@ -0,0 +1,110 @@
+package s3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials are the AWS access keys requests are signed with
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Temporary credentials only
+}
+
+// Valid reports whether both keys are set
+func (c Credentials) Valid() bool {
+	return c.AccessKeyID != "" && c.SecretAccessKey != ""
+}
+
+// EnvCredentials returns the credentials of the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables
+func EnvCredentials() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// DefaultCredentialsPath returns the path of the shared credentials file:
+// $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials, "" if the home
+// directory is unknown
+func DefaultCredentialsPath() string {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", "credentials")
+}
+
+// LoadSharedCredentials reads the credentials of profile from the shared
+// credentials file at path
+func LoadSharedCredentials(path, profile string) (Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer f.Close()
+	creds, err := ParseSharedCredentials(f, profile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("s3: %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// ParseSharedCredentials returns the credentials of profile from a shared
+// credentials file, an INI file with a section per profile
+func ParseSharedCredentials(r io.Reader, profile string) (Credentials, error) {
+	var creds Credentials
+	found := false
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' || text[0] == ';' {
+			continue
+		}
+		if text[0] == '[' {
+			if !strings.HasSuffix(text, "]") {
+				return Credentials{}, fmt.Errorf("line %d: unterminated section", line)
+			}
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			found = found || section == profile
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return Credentials{}, fmt.Errorf("line %d: expected key = value", line)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, err
+	}
+	if !found {
+		return Credentials{}, fmt.Errorf("profile %q not found", profile)
+	}
+	if !creds.Valid() {
+		return Credentials{}, fmt.Errorf("profile %q has no aws_access_key_id and aws_secret_access_key", profile)
+	}
+	return creds, nil
+}
@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sharedCredentials = `# comment
+[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = default-secret
+
+[ci]
+; temporary keys
+aws_access_key_id=AKIDCI
+aws_secret_access_key=ci-secret
+aws_session_token = ci-token
+
+[empty]
+region = eu-west-1
+`
+
+func TestParseSharedCredentials(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    Credentials
+		err     string
+	}{
+		{"default", Credentials{"AKIDDEFAULT", "default-secret", ""}, ""},
+		{"ci", Credentials{"AKIDCI", "ci-secret", "ci-token"}, ""},
+		{"empty", Credentials{}, "has no aws_access_key_id"},
+		{"missing", Credentials{}, "not found"},
+	}
+	for _, tt := range tests {
+		got, err := ParseSharedCredentials(strings.NewReader(sharedCredentials), tt.profile)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want %q", tt.profile, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %+v, %v, want %+v", tt.profile, got, err, tt.want)
+		}
+	}
+
+	if _, err := ParseSharedCredentials(strings.NewReader("[default\n"), "default"); err == nil {
+		t.Error("unterminated section accepted")
+	}
+}
+
+func TestLoadSharedCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	os.WriteFile(path, []byte(sharedCredentials), 0600)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+	if got := DefaultCredentialsPath(); got != path {
+		t.Fatalf("DefaultCredentialsPath = %q, want %q", got, path)
+	}
+	creds, err := LoadSharedCredentials(path, "ci")
+	if err != nil || creds.AccessKeyID != "AKIDCI" {
+		t.Errorf("LoadSharedCredentials = %+v, %v", creds, err)
+	}
+	if _, err := LoadSharedCredentials(path+".missing", "default"); !os.IsNotExist(err) {
+		t.Errorf("missing file: %v", err)
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	if got := EnvCredentials(); got != (Credentials{"AKIDENV", "env-secret", ""}) || !got.Valid() {
+		t.Errorf("EnvCredentials = %+v", got)
+	}
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if EnvCredentials().Valid() {
+		t.Error("credentials without a secret are valid")
+	}
+}
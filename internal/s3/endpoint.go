@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultRegion is the region of requests when none is configured
+const DefaultRegion = "us-east-1"
+
+// Endpoint is an S3-compatible object store objects are downloaded from
+type Endpoint struct {
+	URL       *url.URL // Base URL of the store
+	Region    string
+	PathStyle bool    // Bucket in the path instead of the host name
+	Signer    *Signer // nil for anonymous requests
+}
+
+// NewEndpoint returns the endpoint at rawURL, or Amazon S3 in region if
+// rawURL is empty. Custom endpoints, such as MinIO, are addressed
+// path-style. Requests are signed if creds are valid.
+func NewEndpoint(rawURL, region string, creds Credentials) (*Endpoint, error) {
+	if region == "" {
+		region = DefaultRegion
+	}
+	e := &Endpoint{Region: region}
+	if rawURL == "" {
+		e.URL = &url.URL{Scheme: "https", Host: "s3." + region + ".amazonaws.com"}
+	} else {
+		if !strings.Contains(rawURL, "://") {
+			rawURL = "https://" + rawURL
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("s3: invalid endpoint: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("s3: invalid endpoint %q", rawURL)
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawQuery, u.Fragment = "", ""
+		e.URL = u
+		e.PathStyle = true
+	}
+	if creds.Valid() {
+		e.Signer = NewSigner(creds, region)
+	}
+	return e, nil
+}
+
+// ObjectURL returns the HTTP(S) URL of the object named by an
+// s3://bucket/key URI
+func (e *Endpoint) ObjectURL(uri string) (string, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok || !strings.EqualFold(scheme, "s3") {
+		return "", fmt.Errorf("s3: not an s3:// URI: %s", uri)
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	key, _, _ = strings.Cut(key, "#")
+	if bucket == "" || key == "" {
+		return "", fmt.Errorf("s3: URI has no bucket or key: %s", uri)
+	}
+	if strings.ContainsAny(bucket, "/?:@") {
+		return "", fmt.Errorf("s3: invalid bucket name %q", bucket)
+	}
+	if unescaped, err := url.PathUnescape(key); err == nil {
+		key = unescaped
+	}
+
+	host, path := e.URL.Host, e.URL.Path
+	// Bucket names with dots do not match the wildcard certificate of S3
+	if e.PathStyle || strings.Contains(bucket, ".") {
+		path += "/" + bucket
+	} else {
+		host = bucket + "." + host
+	}
+	return e.URL.Scheme + "://" + host + uriEncode(path+"/"+key, false), nil
+}
+
+// Owns reports whether u is on the endpoint, bucket subdomains included
+func (e *Endpoint) Owns(u *url.URL) bool {
+	host := strings.ToLower(u.Host)
+	base := strings.ToLower(e.URL.Host)
+	return host == base || strings.HasSuffix(host, "."+base)
+}
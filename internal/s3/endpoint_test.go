@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestEndpoint_ObjectURL(t *testing.T) {
+	aws, _ := NewEndpoint("", "eu-central-1", Credentials{})
+	minio, _ := NewEndpoint("http://localhost:9000/", "", Credentials{"id", "secret", ""})
+	tests := []struct {
+		endpoint *Endpoint
+		uri      string
+		want     string
+	}{
+		{aws, "s3://bucket/dir/file.iso", "https://bucket.s3.eu-central-1.amazonaws.com/dir/file.iso"},
+		{aws, "s3://my.bucket/file.iso", "https://s3.eu-central-1.amazonaws.com/my.bucket/file.iso"},
+		{aws, "s3://bucket/a b+c.txt", "https://bucket.s3.eu-central-1.amazonaws.com/a%20b%2Bc.txt"},
+		{aws, "s3://bucket/a%20b.txt", "https://bucket.s3.eu-central-1.amazonaws.com/a%20b.txt"},
+		{minio, "s3://bucket/file.iso", "http://localhost:9000/bucket/file.iso"},
+	}
+	for _, tt := range tests {
+		got, err := tt.endpoint.ObjectURL(tt.uri)
+		if err != nil || got != tt.want {
+			t.Errorf("ObjectURL(%s) = %q, %v, want %q", tt.uri, got, err, tt.want)
+		}
+	}
+
+	for _, uri := range []string{"s3://bucket", "s3://bucket/", "s3:///key", "https://bucket/key"} {
+		if _, err := aws.ObjectURL(uri); err == nil {
+			t.Errorf("ObjectURL(%s) succeeded", uri)
+		}
+	}
+}
+
+func TestNewEndpoint(t *testing.T) {
+	e, err := NewEndpoint("minio.internal:9000", "", Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.URL.String() != "https://minio.internal:9000" || !e.PathStyle || e.Region != DefaultRegion || e.Signer != nil {
+		t.Errorf("endpoint = %+v", e)
+	}
+	if _, err := NewEndpoint("ftp://minio.internal", "", Credentials{}); err == nil {
+		t.Error("ftp endpoint accepted")
+	}
+
+	aws, _ := NewEndpoint("", "us-west-2", Credentials{"id", "secret", ""})
+	if aws.Signer == nil || aws.Signer.Region != "us-west-2" {
+		t.Errorf("signer = %+v", aws.Signer)
+	}
+	for host, want := range map[string]bool{
+		"s3.us-west-2.amazonaws.com":        true,
+		"bucket.s3.us-west-2.amazonaws.com": true,
+		"S3.US-WEST-2.amazonaws.com":        true,
+		"evil-s3.us-west-2.amazonaws.com":   false,
+		"example.com":                       false,
+	} {
+		if got := aws.Owns(&url.URL{Host: host}); got != want {
+			t.Errorf("Owns(%s) = %v, want %v", host, got, want)
+		}
+	}
+}
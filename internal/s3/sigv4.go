@@ -0,0 +1,173 @@
+// Package s3 downloads objects from Amazon S3 and S3-compatible stores over
+// HTTPS, with requests signed by AWS Signature Version 4
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// emptyPayloadHash is the SHA-256 of an empty body, sent by GET and HEAD
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	amzDateFormat = "20060102T150405Z"
+	algorithm     = "AWS4-HMAC-SHA256"
+	service       = "s3"
+)
+
+// Signer signs requests with AWS Signature Version 4. It implements the
+// AuthProvider interface of the HTTP client: every request, each ranged
+// GET included, is signed when it is sent.
+type Signer struct {
+	Credentials Credentials
+	Region      string
+	now         func() time.Time // For testing
+}
+
+// NewSigner returns a Signer for requests to region
+func NewSigner(creds Credentials, region string) *Signer {
+	return &Signer{Credentials: creds, Region: region, now: time.Now}
+}
+
+// Authorize signs req
+func (s *Signer) Authorize(req *http.Request) error {
+	s.Sign(req, s.now())
+	return nil
+}
+
+// Refresh declines to retry a rejected request: the credentials are fixed
+func (s *Signer) Refresh(*http.Response) (bool, error) {
+	return false, nil
+}
+
+// Sign signs req, which must not have a body, as sent at t. The Host,
+// Range and x-amz-* headers are signed.
+func (s *Signer) Sign(req *http.Request, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format(amzDateFormat)
+	scope := strings.Join([]string{t.Format("20060102"), s.Region, service, "aws4_request"}, "/")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if s.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	} else {
+		req.Header.Del("X-Amz-Security-Token")
+	}
+
+	signedHeaders, canonicalHeaders := canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{algorithm, amzDate, scope, hexSHA256(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.Credentials.SecretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.Credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalHeaders returns the names of the signed headers and their
+// canonical form
+func canonicalHeaders(req *http.Request) (signed, canonical string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, vals := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			trimmed := make([]string, len(vals))
+			for i, v := range vals {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			values[name] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+	return strings.Join(names, ";"), b.String()
+}
+
+// canonicalURI returns the path of u as S3 signs it: encoded once, without
+// normalization
+func canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = uriEncode(unescaped, false)
+	}
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// canonicalQuery returns the query of u with its parameters sorted by name
+// and value
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	params := make([]string, 0, len(query))
+	for name, vals := range query {
+		for _, v := range vals {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters
+// of RFC 3986, and '/' unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
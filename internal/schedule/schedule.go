@@ -0,0 +1,235 @@
+// Package schedule parses time-of-day rules that limit or pause downloads.
+//
+// A schedule has one rule per line:
+//
+//	# days      time         action
+//	weekdays    09:00-18:00  limit 2M
+//	*           18:00-09:00  limit 0
+//	*           12:00-13:00  pause
+//
+// Days are "*" (or "daily"), "weekdays", "weekends" or a comma separated list
+// of day names and ranges such as "mon-fri,sun". A window ending before it
+// starts runs past midnight into the next day. "limit" sets the overall
+// download speed (0 is unlimited) and "pause" pauses all downloads. When
+// several limit rules match, the last one wins.
+package schedule
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/divyam234/hydra/pkg/option"
+)
+
+// Rule applies an action during a daily time window
+type Rule struct {
+	Days  [7]bool       // Indexed by time.Weekday, all false means every day
+	Start time.Duration // Since midnight
+	End   time.Duration // Since midnight, before Start if past midnight
+	Pause bool
+	Limit int // Bytes per second, 0 for unlimited; ignored if Pause is set
+}
+
+// Schedule is an ordered list of rules
+type Schedule struct {
+	Rules []Rule
+}
+
+// State is what a schedule prescribes at a given time
+type State struct {
+	Paused  bool
+	Limited bool // Limit is set by a rule
+	Limit   int  // Bytes per second, 0 for unlimited
+}
+
+// At returns the state of the schedule at t, in t's location
+func (s *Schedule) At(t time.Time) State {
+	var state State
+	if s == nil {
+		return state
+	}
+	for _, r := range s.Rules {
+		if !r.matches(t) {
+			continue
+		}
+		if r.Pause {
+			state.Paused = true
+		} else {
+			state.Limited = true
+			state.Limit = r.Limit
+		}
+	}
+	return state
+}
+
+// matches reports whether t falls within the rule's window
+func (r Rule) matches(t time.Time) bool {
+	// Wall clock time, which t.Sub(midnight) is not on DST transition days
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	if r.Start < r.End {
+		return r.onDay(t.Weekday()) && tod >= r.Start && tod < r.End
+	}
+	// The window started yesterday or starts today and runs past midnight
+	yesterday := (t.Weekday() + 6) % 7
+	return (r.onDay(t.Weekday()) && tod >= r.Start) || (r.onDay(yesterday) && tod < r.End)
+}
+
+func (r Rule) onDay(d time.Weekday) bool {
+	return r.Days == [7]bool{} || r.Days[d]
+}
+
+// Load reads a schedule file
+func Load(path string) (*Schedule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a schedule from r
+func Parse(r io.Reader) (*Schedule, error) {
+	s := &Schedule{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rule, err := parseRule(fields)
+		if err != nil {
+			return nil, fmt.Errorf("schedule line %d: %w", lineNo, err)
+		}
+		s.Rules = append(s.Rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParseString parses a schedule given as text
+func ParseString(spec string) (*Schedule, error) {
+	return Parse(strings.NewReader(spec))
+}
+
+func parseRule(fields []string) (Rule, error) {
+	var r Rule
+	if len(fields) < 3 {
+		return r, fmt.Errorf("expected days, time window and action")
+	}
+
+	days, err := parseDays(fields[0])
+	if err != nil {
+		return r, err
+	}
+	r.Days = days
+
+	startStr, endStr, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return r, fmt.Errorf("invalid time window %q", fields[1])
+	}
+	if r.Start, err = parseTimeOfDay(startStr); err != nil {
+		return r, err
+	}
+	if r.End, err = parseTimeOfDay(endStr); err != nil {
+		return r, err
+	}
+	if r.Start == r.End || r.Start == 24*time.Hour {
+		return r, fmt.Errorf("empty time window %q", fields[1])
+	}
+
+	switch strings.ToLower(fields[2]) {
+	case "pause":
+		if len(fields) != 3 {
+			return r, fmt.Errorf("unexpected %q after pause", fields[3])
+		}
+		r.Pause = true
+	case "limit":
+		if len(fields) != 4 {
+			return r, fmt.Errorf("limit needs a speed")
+		}
+		if fields[3] != "unlimited" {
+			limit, err := option.ParseUnitNumber(fields[3])
+			if err != nil || limit < 0 {
+				return r, fmt.Errorf("invalid speed %q", fields[3])
+			}
+			r.Limit = int(limit)
+		}
+	default:
+		return r, fmt.Errorf("unknown action %q", fields[2])
+	}
+	return r, nil
+}
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseDay(s string) (time.Weekday, error) {
+	s = strings.ToLower(s)
+	if len(s) > 3 {
+		s = s[:3]
+	}
+	d, ok := dayNames[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown day %q", s)
+	}
+	return d, nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	switch strings.ToLower(s) {
+	case "*", "daily":
+		return days, nil
+	case "weekdays":
+		s = "mon-fri"
+	case "weekends":
+		s = "sat,sun"
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := parseDay(from)
+		if err != nil {
+			return days, err
+		}
+		last := first
+		if isRange {
+			if last, err = parseDay(to); err != nil {
+				return days, err
+			}
+		}
+		// Ranges may wrap around the week, e.g. "fri-mon"
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); n != 2 || err != nil ||
+		h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
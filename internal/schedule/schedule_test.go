@@ -0,0 +1,121 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const office = `
+# Office link
+weekdays    09:00-18:00  limit 2M
+*           18:00-09:00  limit 0   # unlimited at night
+*           12:00-13:00  pause
+sat,sun     10:00-12:00  limit 512K
+`
+
+func TestSchedule_At(t *testing.T) {
+	s, err := ParseString(office)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2026-10-12 is a Monday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 10, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want State
+	}{
+		{"WeekdayMorning", at(12, 9, 30), State{Limited: true, Limit: 2 * 1024 * 1024}},
+		{"Lunch", at(14, 12, 15), State{Paused: true, Limited: true, Limit: 2 * 1024 * 1024}},
+		{"Evening", at(14, 22, 0), State{Limited: true, Limit: 0}},
+		{"AfterMidnight", at(15, 3, 0), State{Limited: true, Limit: 0}},
+		{"WindowEnd", at(16, 18, 0), State{Limited: true, Limit: 0}},
+		{"SaturdayMorning", at(17, 11, 0), State{Limited: true, Limit: 512 * 1024}},
+		{"WeekendLunch", at(18, 12, 30), State{Paused: true}},
+	}
+	for _, tt := range tests {
+		if got := s.At(tt.t); got != tt.want {
+			t.Errorf("%s: At(%v) = %+v, want %+v", tt.name, tt.t, got, tt.want)
+		}
+	}
+
+	var empty *Schedule
+	if got := empty.At(at(12, 12, 0)); got != (State{}) {
+		t.Errorf("nil schedule: got %+v", got)
+	}
+}
+
+func TestSchedule_MidnightDays(t *testing.T) {
+	// Friday night into Saturday morning only
+	s, err := ParseString("fri 22:00-06:00 pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fri := time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)
+	sat := time.Date(2026, 10, 17, 5, 0, 0, 0, time.UTC)
+	thu := time.Date(2026, 10, 15, 5, 0, 0, 0, time.UTC)
+	if !s.At(fri).Paused || !s.At(sat).Paused {
+		t.Error("expected the window to run past midnight")
+	}
+	if s.At(thu).Paused {
+		t.Error("window must not apply after Thursday night")
+	}
+}
+
+func TestSchedule_DSTTransition(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	s, err := ParseString("* 09:00-18:00 limit 2M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clocks went forward on 2026-03-29 and go back on 2026-10-25; windows
+	// follow the wall clock
+	for _, day := range []time.Time{
+		time.Date(2026, 3, 29, 9, 30, 0, 0, berlin),
+		time.Date(2026, 10, 25, 17, 30, 0, 0, berlin),
+	} {
+		if !s.At(day).Limited {
+			t.Errorf("At(%v): window 09:00-18:00 does not apply", day)
+		}
+	}
+	if s.At(time.Date(2026, 3, 29, 8, 30, 0, 0, berlin)).Limited {
+		t.Error("window applies at 08:30 after the clocks went forward")
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []string{
+		"weekdays 09:00-18:00",
+		"someday 09:00-18:00 pause",
+		"* 9-18 pause",
+		"* 25:00-26:00 pause",
+		"* 09:00-09:00 pause",
+		"* 09:00-18:00 limit",
+		"* 09:00-18:00 limit fast",
+		"* 09:00-18:00 throttle 1M",
+		"* 09:00-18:00 pause now",
+	}
+	for _, spec := range tests {
+		if _, err := ParseString(spec); err == nil {
+			t.Errorf("ParseString(%q) should fail", spec)
+		} else if !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("error should name the line: %v", err)
+		}
+	}
+
+	s, err := ParseString("fri-mon 00:00-24:00 limit unlimited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [7]bool{true, true, false, false, false, true, true}
+	if s.Rules[0].Days != want {
+		t.Errorf("wrapping day range: got %v", s.Rules[0].Days)
+	}
+}
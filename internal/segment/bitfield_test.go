@@ -1,6 +1,9 @@
 package segment
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"math/rand"
 	"sync"
 	"testing"
@@ -234,3 +237,38 @@ func TestBitfieldMan_HexEdgeCases(t *testing.T) {
 		t.Error("Should fail for odd length hex")
 	}
 }
+
+func TestDefaultPieceStorage_PieceHashes(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 160) // 2560 bytes, 3 pieces
+	ps := NewDefaultPieceStorage(int64(len(data)), 1024)
+
+	hashes := make([]string, ps.GetNumPieces())
+	for i := range hashes {
+		p := ps.GetPiece(i)
+		sum := sha1.Sum(data[p.Offset : p.Offset+p.Length])
+		hashes[i] = hex.EncodeToString(sum[:])
+	}
+
+	if err := ps.SetPieceHashes("sha-1", hashes[:2], bytes.NewReader(data)); err == nil {
+		t.Error("Expected error for a wrong number of hashes")
+	}
+	if err := ps.SetPieceHashes("crc64", hashes, bytes.NewReader(data)); err == nil {
+		t.Error("Expected error for an unsupported algorithm")
+	}
+
+	corrupt := bytes.Clone(data)
+	corrupt[1500] ^= 0xff
+	if err := ps.SetPieceHashes("sha-1", hashes, bytes.NewReader(corrupt)); err != nil {
+		t.Fatalf("SetPieceHashes failed: %v", err)
+	}
+
+	if !ps.CompletePiece(0) || !ps.CompletePiece(2) {
+		t.Error("Intact pieces should verify")
+	}
+	if ps.CompletePiece(1) {
+		t.Error("Corrupt piece should fail verification")
+	}
+	if ps.HasPiece(1) {
+		t.Error("Corrupt piece must stay missing")
+	}
+}
@@ -0,0 +1,94 @@
+package segment
+
+// dupGroup links a segment with its duplicate request. Both end at the same
+// offset; the duplicate starts where the original had got to when it was
+// created, so together they cover the original's range.
+type dupGroup struct {
+	start   int64 // Start of the original segment
+	members []*Segment
+	counted int64    // Bytes of the range counted as downloaded
+	winner  *Segment // The member that completed the range, if any
+}
+
+// update recounts the bytes covered by the group and returns the increase
+func (g *dupGroup) update() int64 {
+	var covered int64
+	for _, m := range g.members {
+		covered = max(covered, m.Position+m.Written-g.start)
+	}
+	added := max(covered-g.counted, 0)
+	g.counted += added
+	return added
+}
+
+// start returns the offset from which the segment's range counts as its own
+func (s *Segment) start() int64 {
+	if s.group != nil {
+		return s.group.start
+	}
+	return s.Position
+}
+
+// SetDuplicateEndgame enables duplicate requests in endgame mode: once no
+// new pieces are left and at most n ranges are outstanding, idle workers
+// get a second request for one of them instead of a split. Whichever
+// request finishes first completes the range and the other one is dropped;
+// see LostToDuplicate. 0 splits the largest remaining range instead (the
+// default).
+func (sm *SegmentMan) SetDuplicateEndgame(n int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.duplicates = max(n, 0)
+}
+
+// IsActive reports whether a segment is still being downloaded. It is false
+// once the segment completed, was cancelled, or its duplicate finished first.
+func (sm *SegmentMan) IsActive(segIndex int) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	_, ok := sm.segments[segIndex]
+	return ok
+}
+
+// LostToDuplicate reports whether seg was dropped because its duplicate
+// request completed the range first. Segments cancelled for other reasons
+// are not.
+func (sm *SegmentMan) LostToDuplicate(seg *Segment) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return seg.group != nil && seg.group.winner != nil && seg.group.winner != seg
+}
+
+// outstandingNoLock returns the number of distinct ranges being downloaded
+func (sm *SegmentMan) outstandingNoLock() int {
+	n := 0
+	for _, seg := range sm.segments {
+		if seg.group == nil || seg.group.members[0] == seg {
+			n++
+		}
+	}
+	return n
+}
+
+// duplicateNoLock returns a second request for the active segment with the
+// most bytes remaining that has none yet, or nil if there is none
+func (sm *SegmentMan) duplicateNoLock() *Segment {
+	var orig *Segment
+	for _, seg := range sm.segments {
+		if seg.group == nil && seg.GetRemaining() > 0 &&
+			(orig == nil || seg.GetRemaining() > orig.GetRemaining()) {
+			orig = seg
+		}
+	}
+	if orig == nil {
+		return nil
+	}
+
+	dup := NewSegment(sm.nextSegIndex, orig.Position+orig.Written, orig.GetRemaining())
+	sm.nextSegIndex++
+	group := &dupGroup{start: orig.Position, counted: orig.Written}
+	group.members = []*Segment{orig, dup}
+	orig.group, dup.group = group, group
+	sm.segments[dup.Index] = dup
+	return dup
+}
@@ -0,0 +1,85 @@
+package segment
+
+import "testing"
+
+func TestSegmentMan_DuplicateEndgame(t *testing.T) {
+	ps := newMockPieceStorage(4, 1024)
+	sm := NewSegmentMan(ps, 1)
+	sm.SetDuplicateEndgame(2)
+
+	var segs []*Segment
+	for i := 0; i < 4; i++ {
+		segs = append(segs, sm.GetSegment())
+	}
+	for _, seg := range segs[:2] {
+		sm.UpdateSegment(seg.Index, seg.Length)
+		sm.CompleteSegment(seg.Index)
+	}
+	sm.UpdateSegment(segs[2].Index, 512)
+
+	// The range with the most remaining is duplicated first
+	dup3 := sm.GetSegment()
+	if dup3 == nil || dup3.Position != 3072 || dup3.Length != 1024 {
+		t.Fatalf("first duplicate = %+v, want the last range", dup3)
+	}
+	dup2 := sm.GetSegment()
+	if dup2 == nil || dup2.Position != 2560 || dup2.Length != 512 {
+		t.Fatalf("second duplicate = %+v, want the rest of the third range", dup2)
+	}
+	if seg := sm.GetSegment(); seg != nil {
+		t.Fatalf("got %+v, want no third duplicate", seg)
+	}
+
+	// Bytes are counted once, whichever request writes them
+	var counted int64
+	counted += sm.UpdateSegment(segs[3].Index, 300)
+	counted += sm.UpdateSegment(dup3.Index, 200)
+	counted += sm.UpdateSegment(dup3.Index, 824)
+	if counted != 1024 {
+		t.Errorf("counted %d bytes of the last range, want 1024", counted)
+	}
+
+	// The first request to finish completes the range and drops the other
+	sm.CompleteSegment(dup3.Index)
+	if sm.IsActive(segs[3].Index) || sm.IsActive(dup3.Index) {
+		t.Error("requests for the completed range are still active")
+	}
+	if !sm.LostToDuplicate(segs[3]) || sm.LostToDuplicate(dup3) {
+		t.Error("only the dropped request should have lost to its duplicate")
+	}
+	if n := sm.UpdateSegment(segs[3].Index, 100); n != 0 {
+		t.Errorf("dropped request counted %d bytes", n)
+	}
+	if !ps.HasPiece(3) {
+		t.Error("piece 3 not completed")
+	}
+
+	// Cancelling one request leaves the other running
+	sm.CancelSegment(segs[2].Index)
+	if !sm.IsActive(dup2.Index) {
+		t.Fatal("duplicate was dropped with the cancelled request")
+	}
+	if sm.LostToDuplicate(segs[2]) {
+		t.Error("cancelled request reported as lost to its duplicate")
+	}
+	if n := sm.UpdateSegment(dup2.Index, 512); n != 512 {
+		t.Errorf("counted %d bytes, want 512", n)
+	}
+	sm.CompleteSegment(dup2.Index)
+	if !sm.IsAllComplete() {
+		t.Error("download not complete")
+	}
+}
+
+func TestSegmentMan_DuplicateEndgameWaitsForLastRanges(t *testing.T) {
+	ps := newMockPieceStorage(4, 1024)
+	sm := NewSegmentMan(ps, 1)
+	sm.SetDuplicateEndgame(1)
+
+	for i := 0; i < 4; i++ {
+		sm.GetSegment()
+	}
+	if seg := sm.GetSegment(); seg != nil {
+		t.Fatalf("got %+v with 4 ranges outstanding, want none", seg)
+	}
+}
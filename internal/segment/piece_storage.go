@@ -1,8 +1,14 @@
 package segment
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"strings"
 	"sync"
+
+	"github.com/divyam234/hydra/internal/util"
 )
 
 // PieceStorage manages the pieces of a download
@@ -13,7 +19,9 @@ type PieceStorage interface {
 	GetPiece(index int) *Piece
 	GetBitfield() *BitfieldMan
 	HasPiece(index int) bool
-	CompletePiece(index int)
+	// CompletePiece marks a fully written piece as done. It returns false if
+	// the piece failed verification, in which case it stays missing.
+	CompletePiece(index int) bool
 	IsAllPieceSet() bool
 }
 
@@ -25,6 +33,11 @@ type DefaultPieceStorage struct {
 	pieces      []*Piece
 	bitfield    *BitfieldMan
 	mu          sync.RWMutex
+
+	// Optional per-piece verification
+	hashAlgo    string
+	pieceHashes [][]byte
+	reader      io.ReaderAt
 }
 
 // NewDefaultPieceStorage creates a new DefaultPieceStorage
@@ -82,8 +95,63 @@ func (ps *DefaultPieceStorage) HasPiece(index int) bool {
 	return ps.bitfield.HasBit(index)
 }
 
-func (ps *DefaultPieceStorage) CompletePiece(index int) {
+func (ps *DefaultPieceStorage) CompletePiece(index int) bool {
+	if ps.pieceHashes != nil && !ps.verifyPiece(index) {
+		ps.bitfield.UnsetBit(index)
+		return false
+	}
 	ps.bitfield.SetBit(index)
+	return true
+}
+
+// SetPieceHashes enables verification of completed pieces. Piece data is read
+// back through r and compared against the hex digest for its index.
+func (ps *DefaultPieceStorage) SetPieceHashes(algo string, hashes []string, r io.ReaderAt) error {
+	if _, err := util.NewHash(algo); err != nil {
+		return err
+	}
+	if len(hashes) != ps.numPieces {
+		return fmt.Errorf("got %d piece hashes for %d pieces", len(hashes), ps.numPieces)
+	}
+
+	digests := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		d, err := hex.DecodeString(strings.TrimSpace(h))
+		if err != nil {
+			return fmt.Errorf("invalid hash for piece %d: %w", i, err)
+		}
+		digests[i] = d
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.hashAlgo = algo
+	ps.pieceHashes = digests
+	ps.reader = r
+	return nil
+}
+
+// verifyPiece hashes the stored data of a piece and compares it to the expected digest
+func (ps *DefaultPieceStorage) verifyPiece(index int) bool {
+	piece := ps.GetPiece(index)
+	if piece == nil {
+		return false
+	}
+
+	h, err := util.NewHash(ps.hashAlgo)
+	if err != nil {
+		return false
+	}
+	// A buffering reader only sees the piece's writes once they are synced
+	if s, ok := ps.reader.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return false
+		}
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(ps.reader, piece.Offset, piece.Length)); err != nil {
+		return false
+	}
+	return bytes.Equal(h.Sum(nil), ps.pieceHashes[index])
 }
 
 func (ps *DefaultPieceStorage) IsAllPieceSet() bool {
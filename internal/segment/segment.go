@@ -12,6 +12,8 @@ type Segment struct {
 	Written    int64 // Bytes successfully written/downloaded
 	IsComplete bool  // Whether the segment is fully downloaded
 	IsCanceled bool  // Whether the segment was canceled
+
+	group *dupGroup // Set when the range is also requested by another segment
 }
 
 // NewSegment creates a new segment
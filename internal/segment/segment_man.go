@@ -12,6 +12,9 @@ type SegmentMan struct {
 	nextSegIndex        int
 	maxPiecesPerSegment int
 	selector            PieceSelector
+	covered             map[int]int64 // Bytes of unfinished pieces written by completed segments
+	verifying           map[int]bool  // Pieces being completed outside the lock
+	duplicates          int           // Ranges requested twice in endgame mode, 0 to split instead
 }
 
 // NewSegmentMan creates a new SegmentMan
@@ -24,6 +27,8 @@ func NewSegmentMan(ps PieceStorage, maxPieces int) *SegmentMan {
 		segments:            make(map[int]*Segment),
 		maxPiecesPerSegment: maxPieces,
 		selector:            &InOrderSelector{}, // Default
+		covered:             make(map[int]int64),
+		verifying:           make(map[int]bool),
 	}
 }
 
@@ -45,12 +50,15 @@ func (sm *SegmentMan) GetSegment() *Segment {
 	activePieces := make(map[int]bool)
 	for _, seg := range sm.segments {
 		// Calculate pieces covered by this segment
-		startPiece := int(seg.Position / sm.pieceStorage.GetPieceLength())
+		startPiece := int(seg.start() / sm.pieceStorage.GetPieceLength())
 		endPiece := int((seg.Position + seg.Length - 1) / sm.pieceStorage.GetPieceLength())
 		for i := startPiece; i <= endPiece; i++ {
 			activePieces[i] = true
 		}
 	}
+	for i := range sm.verifying {
+		activePieces[i] = true
+	}
 
 	// 1. Try to select a new piece using the strategy
 	startPiece := sm.selector.Select(sm.pieceStorage, activePieces)
@@ -77,6 +85,8 @@ func (sm *SegmentMan) GetSegment() *Segment {
 		for i := startPiece; i <= endPiece; i++ {
 			p := sm.pieceStorage.GetPiece(i)
 			length += p.Length
+			// The new segment rewrites the whole piece
+			delete(sm.covered, i)
 		}
 
 		seg := NewSegment(sm.nextSegIndex, offset, length)
@@ -86,6 +96,11 @@ func (sm *SegmentMan) GetSegment() *Segment {
 	}
 
 	// 2. Endgame Mode: No new pieces available.
+	// Request one of the last ranges a second time if enabled
+	if sm.duplicates > 0 && sm.outstandingNoLock() <= sm.duplicates {
+		return sm.duplicateNoLock()
+	}
+
 	// Try to steal from the slowest/largest active segment.
 	if len(sm.segments) > 0 {
 		// Find segment with most remaining bytes
@@ -95,7 +110,7 @@ func (sm *SegmentMan) GetSegment() *Segment {
 		// Iteration order is random in Go maps, which acts as a random tie-breaker
 		for _, seg := range sm.segments {
 			rem := seg.GetRemaining()
-			if rem > maxRem {
+			if rem > maxRem && seg.group == nil {
 				maxRem = rem
 				bestSeg = seg
 			}
@@ -119,40 +134,86 @@ func (sm *SegmentMan) GetSegment() *Segment {
 	return nil // No more work possible
 }
 
-// UpdateSegment updates progress of a segment
-func (sm *SegmentMan) UpdateSegment(segIndex int, bytesWritten int64) {
+// UpdateSegment updates progress of a segment. It returns the number of
+// bytes new to the download: bytes a duplicate request already wrote, or
+// bytes of a segment that is no longer active, are not counted again.
+func (sm *SegmentMan) UpdateSegment(segIndex int, bytesWritten int64) int64 {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	seg, ok := sm.segments[segIndex]
 	if !ok {
-		return
+		return 0
 	}
 
+	before := seg.Written
 	seg.UpdateWritten(bytesWritten)
+	if seg.group != nil {
+		return seg.group.update()
+	}
+	return seg.Written - before
 }
 
-// CompleteSegment marks a segment as complete and updates piece storage
-func (sm *SegmentMan) CompleteSegment(segIndex int) {
+// CompleteSegment marks a segment as complete and updates piece storage.
+// A piece is completed once segments have covered all of its bytes, which
+// matters for segments split in endgame mode. It returns the indexes of
+// pieces that failed verification; they are missing again and will be
+// handed out by GetSegment. Pieces are verified without holding the lock,
+// so other workers are not held up while they are hashed.
+func (sm *SegmentMan) CompleteSegment(segIndex int) []int {
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
-
 	seg, ok := sm.segments[segIndex]
 	if !ok {
-		return
+		sm.mu.Unlock()
+		return nil
+	}
+	delete(sm.segments, segIndex)
+
+	// The first of two duplicate requests to finish covers the whole range
+	// and the other one is dropped
+	if seg.group != nil {
+		seg.group.winner = seg
+		for _, m := range seg.group.members {
+			delete(sm.segments, m.Index)
+		}
 	}
 
-	// Mark pieces as complete
-	startPiece := int(seg.Position / sm.pieceStorage.GetPieceLength())
-	endPiece := int((seg.Position + seg.Length - 1) / sm.pieceStorage.GetPieceLength())
+	pieceLen := sm.pieceStorage.GetPieceLength()
+	segEnd := seg.Position + seg.Length
+	startPiece := int(seg.start() / pieceLen)
+	endPiece := int((segEnd - 1) / pieceLen)
 
+	var written []int
 	for i := startPiece; i <= endPiece; i++ {
-		// Verify piece is actually fully within this segment's written range
-		// For now assume perfect alignment
-		sm.pieceStorage.CompletePiece(i)
+		if sm.pieceStorage.HasPiece(i) || sm.verifying[i] {
+			continue
+		}
+		p := sm.pieceStorage.GetPiece(i)
+		overlap := min(segEnd, p.Offset+p.Length) - max(seg.start(), p.Offset)
+		sm.covered[i] += overlap
+		if sm.covered[i] < p.Length {
+			continue
+		}
+
+		delete(sm.covered, i)
+		sm.verifying[i] = true // Not handed out again meanwhile
+		written = append(written, i)
 	}
+	sm.mu.Unlock()
 
-	delete(sm.segments, segIndex)
+	var failed []int
+	for _, i := range written {
+		if !sm.pieceStorage.CompletePiece(i) {
+			failed = append(failed, i)
+		}
+	}
+
+	sm.mu.Lock()
+	for _, i := range written {
+		delete(sm.verifying, i)
+	}
+	sm.mu.Unlock()
+	return failed
 }
 
 // CancelSegment returns a segment to the pool
@@ -18,8 +18,11 @@ func (m *mockPieceStorage) GetPieceLength() int64     { return m.pieceLength }
 func (m *mockPieceStorage) GetPiece(index int) *Piece { return m.pieces[index] }
 func (m *mockPieceStorage) GetBitfield() *BitfieldMan { return m.bitfield }
 func (m *mockPieceStorage) HasPiece(index int) bool   { return m.bitfield.HasBit(index) }
-func (m *mockPieceStorage) CompletePiece(index int)   { m.bitfield.SetBit(index) }
-func (m *mockPieceStorage) IsAllPieceSet() bool       { return m.bitfield.IsAllBitSet() }
+func (m *mockPieceStorage) CompletePiece(index int) bool {
+	m.bitfield.SetBit(index)
+	return true
+}
+func (m *mockPieceStorage) IsAllPieceSet() bool { return m.bitfield.IsAllBitSet() }
 
 func newMockPieceStorage(num int, length int64) *mockPieceStorage {
 	ps := &mockPieceStorage{
@@ -103,3 +106,73 @@ func TestSegmentMan_IsAllComplete(t *testing.T) {
 		t.Error("Should be complete now")
 	}
 }
+
+func TestSegmentMan_CompleteSplitSegments(t *testing.T) {
+	ps := newMockPieceStorage(4, 1024)
+	sm := NewSegmentMan(ps, 20)
+
+	seg := sm.GetSegment()
+	seg.Written = 1024
+	// Splits at offset 2560, in the middle of piece 2
+	tail := seg.Split(512)
+	if tail == nil || tail.Position != 2560 {
+		t.Fatalf("Unexpected split: %+v", tail)
+	}
+	tail.Index = 99
+	sm.segments[tail.Index] = tail
+
+	sm.CompleteSegment(seg.Index)
+	if !ps.HasPiece(1) {
+		t.Error("Piece 1 should be complete")
+	}
+	if ps.HasPiece(2) {
+		t.Error("Piece 2 is only partially written")
+	}
+
+	sm.CompleteSegment(tail.Index)
+	if !sm.IsAllComplete() {
+		t.Error("Download should be complete once both halves are written")
+	}
+}
+
+// blockingPieceStorage holds CompletePiece until release is closed
+type blockingPieceStorage struct {
+	*mockPieceStorage
+	started chan int
+	release chan struct{}
+}
+
+func (b *blockingPieceStorage) CompletePiece(index int) bool {
+	b.started <- index
+	<-b.release
+	return b.mockPieceStorage.CompletePiece(index)
+}
+
+func TestSegmentMan_CompleteSegmentVerifiesUnlocked(t *testing.T) {
+	ps := &blockingPieceStorage{newMockPieceStorage(2, 1024), make(chan int, 1), make(chan struct{})}
+	sm := NewSegmentMan(ps, 1)
+
+	first := sm.GetSegment()
+	done := make(chan struct{})
+	go func() {
+		sm.CompleteSegment(first.Index)
+		close(done)
+	}()
+	<-ps.started
+
+	// Other workers get segments while the piece is verified, but not the
+	// piece itself
+	seg := sm.GetSegment()
+	if seg == nil || seg.Position != 1024 {
+		t.Fatalf("GetSegment during verification = %+v, want piece 1", seg)
+	}
+	if again := sm.GetSegment(); again != nil {
+		t.Errorf("piece being verified handed out again: %+v", again)
+	}
+
+	close(ps.release)
+	<-done
+	if !ps.HasPiece(0) {
+		t.Error("piece 0 should be complete")
+	}
+}
@@ -0,0 +1,104 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Lines of checksum files in the coreutils ("digest  name", "digest *name")
+// and BSD ("SHA256 (name) = digest") formats
+var (
+	gnuChecksumLine = regexp.MustCompile(`^\\?([0-9a-fA-F]+) [ *](.+)$`)
+	bsdChecksumLine = regexp.MustCompile(`^\\?([A-Za-z0-9-]+) ?\((.+)\) ?= ?([0-9a-fA-F]+)$`)
+)
+
+// checksumFileAlgos maps parts of checksum file names to algorithms,
+// e.g. SHA512SUMS or b2sums.txt
+var checksumFileAlgos = []struct{ marker, algo string }{
+	{"sha512", "sha-512"},
+	{"sha384", "sha-384"},
+	{"sha256", "sha-256"},
+	{"sha224", "sha-224"},
+	{"sha1", "sha-1"},
+	{"md5", "md5"},
+	{"blake2b", "blake2b"},
+	{"b2sum", "blake2b"},
+	{"blake3", "blake3"},
+	{"b3sum", "blake3"},
+	{"crc32c", "crc32c"},
+	{"xxh64", "xxh64"},
+	{"xxhash", "xxh64"},
+}
+
+// FindChecksum looks up the entry for name in a checksum file and returns it
+// as "algo=digest". The algorithm comes from the BSD tag, from the checksum
+// file name sumsName or, failing both, from the digest length.
+func FindChecksum(r io.Reader, sumsName, name string) (string, error) {
+	fileAlgo := ""
+	lowerName := strings.ToLower(filepath.Base(sumsName))
+	for _, a := range checksumFileAlgos {
+		if strings.Contains(lowerName, a.marker) {
+			fileAlgo = a.algo
+			break
+		}
+	}
+
+	var found, foundBase string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var algo, digest, entry string
+		if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+			algo, entry, digest = strings.ToLower(m[1]), m[2], m[3]
+		} else if m := gnuChecksumLine.FindStringSubmatch(line); m != nil {
+			algo, digest, entry = fileAlgo, m[1], m[2]
+		} else {
+			continue
+		}
+		if strings.HasPrefix(line, "\\") {
+			entry = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(entry)
+		}
+
+		checksum := strings.ToLower(digest)
+		if algo != "" {
+			checksum = algo + "=" + checksum
+		}
+		entry = strings.TrimPrefix(entry, "./")
+		if entry == name {
+			found = checksum
+			break
+		}
+		if foundBase == "" && path.Base(entry) == name {
+			foundBase = checksum
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if found == "" {
+		found = foundBase
+	}
+	if found == "" {
+		return "", fmt.Errorf("no checksum for %s in %s", name, sumsName)
+	}
+
+	// Validates the algorithm, or detects it from the digest length
+	algo, digest, err := ParseChecksum(found)
+	if err != nil {
+		return "", fmt.Errorf("checksum for %s in %s: %w", name, sumsName, err)
+	}
+	if _, err := NewHash(algo); err != nil {
+		return "", err
+	}
+	return algo + "=" + digest, nil
+}
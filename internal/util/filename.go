@@ -0,0 +1,51 @@
+package util
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameLength is the longest file name most file systems accept, in bytes
+const maxFilenameLength = 255
+
+// SanitizeFilename turns a file name chosen by a server into a safe name for
+// the local file system. Names with directory components (including "..")
+// are rejected; control characters and characters reserved on Windows are
+// replaced with '_' and overlong names are shortened, keeping the extension.
+func SanitizeFilename(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("file name %q contains a path", name)
+	}
+	if !utf8.ValidString(name) {
+		name = strings.ToValidUTF8(name, "_")
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	// Windows drops trailing dots and spaces
+	name = strings.TrimRight(strings.TrimSpace(name), ".")
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid file name")
+	}
+
+	if len(name) > maxFilenameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > maxFilenameLength/2 {
+			ext = ""
+		}
+		base := name[:maxFilenameLength-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = base + ext
+	}
+	return name, nil
+}
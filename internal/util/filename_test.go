@@ -0,0 +1,52 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"report.pdf", "report.pdf", false},
+		{"€ rates.txt", "€ rates.txt", false},
+		{`a:b*c?.txt`, "a_b_c_.txt", false},
+		{"tab\there", "tab_here", false},
+		{" name.txt. ", "name.txt", false},
+		{".hidden", ".hidden", false},
+		{"../../etc/passwd", "", true},
+		{`..\windows\system.ini`, "", true},
+		{"dir/file", "", true},
+		{"..", "", true},
+		{".", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := SanitizeFilename(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SanitizeFilename(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeFilename_Long(t *testing.T) {
+	name := strings.Repeat("é", 200) + ".tar.gz"
+	got, err := SanitizeFilename(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) > maxFilenameLength {
+		t.Errorf("name is %d bytes long", len(got))
+	}
+	if !strings.HasSuffix(got, ".gz") || !strings.HasPrefix(got, "é") {
+		t.Errorf("unexpected shortened name %q", got)
+	}
+}
@@ -4,12 +4,18 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"hash/crc32"
 	"io"
 	"os"
 	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/blake3"
+	"golang.org/x/crypto/blake2b"
 )
 
 // VerifyChecksum verifies the file against the checksum string
@@ -19,38 +25,14 @@ func VerifyChecksum(filePath string, checksumStr string) (bool, error) {
 		return true, nil
 	}
 
-	parts := strings.SplitN(checksumStr, "=", 2)
-	var algo string
-	var expected string
-
-	if len(parts) == 2 {
-		algo = strings.ToLower(parts[0])
-		expected = strings.ToLower(parts[1])
-	} else {
-		// Auto-detect based on length
-		expected = strings.ToLower(parts[0])
-		switch len(expected) {
-		case 32:
-			algo = "md5"
-		case 40:
-			algo = "sha-1"
-		case 64:
-			algo = "sha-256"
-		default:
-			return false, fmt.Errorf("unknown checksum type for length %d", len(expected))
-		}
+	algo, expected, err := ParseChecksum(checksumStr)
+	if err != nil {
+		return false, err
 	}
 
-	var h hash.Hash
-	switch algo {
-	case "md5":
-		h = md5.New()
-	case "sha-1", "sha1":
-		h = sha1.New()
-	case "sha-256", "sha256":
-		h = sha256.New()
-	default:
-		return false, fmt.Errorf("unsupported checksum algorithm: %s", algo)
+	h, err := NewHash(algo)
+	if err != nil {
+		return false, err
 	}
 
 	f, err := os.Open(filePath)
@@ -66,3 +48,62 @@ func VerifyChecksum(filePath string, checksumStr string) (bool, error) {
 	actual := hex.EncodeToString(h.Sum(nil))
 	return actual == expected, nil
 }
+
+// ParseChecksum splits a checksum string into algorithm and lowercase digest.
+// The algorithm is detected from the digest length if it is not given.
+func ParseChecksum(checksumStr string) (algo, expected string, err error) {
+	parts := strings.SplitN(checksumStr, "=", 2)
+	if len(parts) == 2 {
+		return strings.ToLower(parts[0]), strings.ToLower(parts[1]), nil
+	}
+
+	// Auto-detect based on length
+	expected = strings.ToLower(parts[0])
+	switch len(expected) {
+	case 32:
+		algo = "md5"
+	case 40:
+		algo = "sha-1"
+	case 56:
+		algo = "sha-224"
+	case 64:
+		algo = "sha-256"
+	case 96:
+		algo = "sha-384"
+	case 128:
+		algo = "sha-512"
+	default:
+		return "", "", fmt.Errorf("unknown checksum type for length %d", len(expected))
+	}
+	return algo, expected, nil
+}
+
+// NewHash returns a new hash for the algorithm name (e.g. "sha-256" or "sha256")
+func NewHash(algo string) (hash.Hash, error) {
+	switch strings.ToLower(algo) {
+	case "md5":
+		return md5.New(), nil
+	case "sha-1", "sha1":
+		return sha1.New(), nil
+	case "sha-224", "sha224":
+		return sha256.New224(), nil
+	case "sha-256", "sha256":
+		return sha256.New(), nil
+	case "sha-384", "sha384":
+		return sha512.New384(), nil
+	case "sha-512", "sha512":
+		return sha512.New(), nil
+	case "blake2b", "blake2b-512":
+		return blake2b.New512(nil)
+	case "blake2b-256":
+		return blake2b.New256(nil)
+	case "blake3":
+		return blake3.New(), nil
+	case "crc32c":
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	case "xxh64", "xxhash", "xxhash64":
+		return xxhash.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", algo)
+	}
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewHash_Algorithms(t *testing.T) {
+	// Digests of "abc"
+	tests := []struct {
+		algo   string
+		digest string
+	}{
+		{"sha-224", "23097d223405d8228642a477bda255b32aadbce4bda0b3f7e36c9da7"},
+		{"sha-384", "cb00753f45a35e8bb5a03d699ac65007272c32ab0eded1631a8b605a43ff5bed8086072ba1e7cc2358baeca134c825a7"},
+		{"sha512", "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		{"blake2b", "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{"blake2b-256", "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{"blake3", "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{"crc32c", "364b3fb7"},
+		{"xxh64", "44bc2cf5ad770999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algo, func(t *testing.T) {
+			h, err := NewHash(tt.algo)
+			if err != nil {
+				t.Fatalf("NewHash failed: %v", err)
+			}
+			h.Write([]byte("abc"))
+			if got := hex.EncodeToString(h.Sum(nil)); got != tt.digest {
+				t.Errorf("digest = %s, want %s", got, tt.digest)
+			}
+		})
+	}
+
+	if _, err := NewHash("sha-3"); err == nil {
+		t.Error("Expected error for an unsupported algorithm")
+	}
+}
+
+func TestVerifyChecksum_DetectsSHA512(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "abc")
+	os.WriteFile(path, []byte("abc"), 0644)
+
+	ok, err := VerifyChecksum(path, "DDAF35A193617ABACC417349AE20413112E6FA4E89A97EA20A9EEEE64B55D39A2192992A274FC1A836BA3C23A3FEEBBD454D4423643CE80E2A9AC94FA54CA49F")
+	if err != nil || !ok {
+		t.Errorf("VerifyChecksum = %v, %v", ok, err)
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	sums := `# release 1.0
+e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  other.tar.gz
+ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad *dist/app.tar.gz
+SHA512 (app.zip) = ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f
+`
+	tests := []struct {
+		sumsName string
+		name     string
+		want     string
+	}{
+		{"SHA256SUMS", "app.tar.gz", "sha-256=ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"SHA256SUMS", "other.tar.gz", "sha-256=e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"SHA256SUMS", "app.zip", "sha512=ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		// Detected from the digest length
+		{"checksums.txt", "other.tar.gz", "sha-256=e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+
+	for _, tt := range tests {
+		got, err := FindChecksum(strings.NewReader(sums), tt.sumsName, tt.name)
+		if err != nil {
+			t.Errorf("%s in %s: %v", tt.name, tt.sumsName, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s in %s = %q, want %q", tt.name, tt.sumsName, got, tt.want)
+		}
+	}
+
+	if _, err := FindChecksum(strings.NewReader(sums), "SHA256SUMS", "missing.bin"); err == nil {
+		t.Error("Expected error for a file without entry")
+	}
+}
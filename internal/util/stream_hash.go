@@ -0,0 +1,114 @@
+package util
+
+import (
+	"context"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+// StreamHasher computes a whole-file checksum front to back while the file
+// is still being downloaded. The caller advances it whenever the completed
+// prefix of the file grows, so the digest is ready as soon as the last byte
+// is written instead of after a second pass over the file.
+type StreamHasher struct {
+	mu     sync.Mutex
+	algo   string
+	h      hash.Hash
+	offset int64 // Bytes hashed so far
+	r      io.ReaderAt
+}
+
+// NewStreamHasher creates a StreamHasher reading the file through r. The
+// algorithm must support saving its state so that hashing survives resumes.
+func NewStreamHasher(algo string, r io.ReaderAt) (*StreamHasher, error) {
+	h, err := NewHash(algo)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := h.(encoding.BinaryMarshaler); !ok {
+		return nil, fmt.Errorf("checksum algorithm %s cannot be resumed", algo)
+	}
+	return &StreamHasher{algo: algo, h: h, r: r}, nil
+}
+
+// Algo returns the hash algorithm
+func (s *StreamHasher) Algo() string {
+	return s.algo
+}
+
+// Offset returns the number of bytes hashed so far
+func (s *StreamHasher) Offset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset
+}
+
+// Advance hashes the file up to end. The bytes before end must be final.
+func (s *StreamHasher) Advance(ctx context.Context, end int64) error {
+	// Writes still buffered by r are flushed once, not for every chunk
+	if syncer, ok := s.r.(interface{ Sync() error }); ok {
+		if err := syncer.Sync(); err != nil {
+			return fmt.Errorf("stream hash: %w", err)
+		}
+	}
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Hash chunk by chunk so that State is never blocked for long
+		s.mu.Lock()
+		if s.offset >= end {
+			s.mu.Unlock()
+			return nil
+		}
+		chunk := buf[:min(int64(len(buf)), end-s.offset)]
+		n, err := s.r.ReadAt(chunk, s.offset)
+		if n < len(chunk) {
+			s.mu.Unlock()
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("stream hash: %w", err)
+		}
+		s.h.Write(chunk)
+		s.offset += int64(n)
+		s.mu.Unlock()
+	}
+}
+
+// Sum returns the hex digest of the bytes hashed so far
+func (s *StreamHasher) Sum() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return hex.EncodeToString(s.h.Sum(nil))
+}
+
+// State returns the offset and the serialized hash state for persisting
+func (s *StreamHasher) State() (int64, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.h.(encoding.BinaryMarshaler).MarshalBinary()
+	return s.offset, state, err
+}
+
+// Restore continues hashing from a state returned by State
+func (s *StreamHasher) Restore(offset int64, state []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offset < 0 {
+		return fmt.Errorf("invalid stream hash offset %d", offset)
+	}
+	if err := s.h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return fmt.Errorf("invalid stream hash state: %w", err)
+	}
+	s.offset = offset
+	return nil
+}
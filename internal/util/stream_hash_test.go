@@ -0,0 +1,56 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestStreamHasher_Resume(t *testing.T) {
+	data := bytes.Repeat([]byte("stream hash "), 100000)
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:])
+
+	h, err := NewStreamHasher("sha-256", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Advance(context.Background(), 300001); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	offset, state, err := h.State()
+	if err != nil || offset != 300001 {
+		t.Fatalf("State = %d, %v", offset, err)
+	}
+
+	resumed, _ := NewStreamHasher("sha-256", bytes.NewReader(data))
+	if err := resumed.Restore(offset, state); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	// Advancing backwards is a no-op
+	resumed.Advance(context.Background(), 1000)
+	if err := resumed.Advance(context.Background(), int64(len(data))); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	if got := resumed.Sum(); got != want {
+		t.Errorf("Sum = %s, want %s", got, want)
+	}
+}
+
+func TestStreamHasher_Errors(t *testing.T) {
+	h, _ := NewStreamHasher("md5", bytes.NewReader(make([]byte, 10)))
+	if err := h.Advance(context.Background(), 20); err == nil {
+		t.Error("Expected error when reading past the end")
+	}
+	if err := h.Restore(0, []byte("garbage")); err == nil {
+		t.Error("Expected error for an invalid state")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Advance(ctx, 5); err == nil {
+		t.Error("Expected error for a cancelled context")
+	}
+}
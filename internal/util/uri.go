@@ -47,6 +47,8 @@ func ParseURI(rawURI string) (*URI, error) {
 			port = 443
 		case "ftp":
 			port = 21
+		case "ftps":
+			port = 990
 		default:
 			// unknown protocol default
 		}
@@ -79,3 +79,53 @@ func Wrap(code ExitStatus, err error) *Error {
 		Err:  err,
 	}
 }
+
+// Temporary reports whether a failure with this status may go away by
+// itself, so that the download is worth trying again later. Failures due to
+// the URL, the credentials, the file or the local disk are not temporary.
+func (s ExitStatus) Temporary() bool {
+	switch s {
+	case ExitTimeout, ExitTooSlowSpeed, ExitNetworkProblem, ExitUnfinishedDownload, ExitFtpNetwork:
+		return true
+	default:
+		return false
+	}
+}
+
+// Code returns the exit status of err: ExitSuccess if err is nil, the code
+// of the first *Error in its chain, or ExitUnknownError if there is none.
+// When err joins several errors, the most relevant code wins: a specific
+// failure over an unfinished download, and both over an unknown error.
+func Code(err error) ExitStatus {
+	switch e := err.(type) {
+	case nil:
+		return ExitSuccess
+	case *Error:
+		return e.Code
+	case interface{ Unwrap() []error }:
+		code := ExitUnknownError
+		for _, err := range e.Unwrap() {
+			if c := Code(err); relevance(c) > relevance(code) {
+				code = c
+			}
+		}
+		return code
+	case interface{ Unwrap() error }:
+		if inner := e.Unwrap(); inner != nil {
+			return Code(inner)
+		}
+	}
+	return ExitUnknownError
+}
+
+// relevance ranks exit statuses for Code
+func relevance(s ExitStatus) int {
+	switch s {
+	case ExitSuccess, ExitUnknownError:
+		return 0
+	case ExitUnfinishedDownload:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,45 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCode(t *testing.T) {
+	notFound := Wrap(ExitResourceNotFound, errors.New("server returned 404 Not Found"))
+	cancelled := New(ExitUnfinishedDownload, "download cancelled")
+	unknown := errors.New("boom")
+
+	tests := []struct {
+		name string
+		err  error
+		want ExitStatus
+	}{
+		{"nil", nil, ExitSuccess},
+		{"plain", unknown, ExitUnknownError},
+		{"coded", notFound, ExitResourceNotFound},
+		{"wrapped", fmt.Errorf("download 1 failed: %w", notFound), ExitResourceNotFound},
+		{"joined", errors.Join(unknown, cancelled, fmt.Errorf("download 2 failed: %w", notFound)), ExitResourceNotFound},
+		{"unfinished over unknown", errors.Join(unknown, cancelled), ExitUnfinishedDownload},
+		{"first specific wins", errors.Join(New(ExitChecksum, "checksum failed"), notFound), ExitChecksum},
+	}
+	for _, tt := range tests {
+		if got := Code(tt.err); got != tt.want {
+			t.Errorf("%s: Code = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExitStatus_Temporary(t *testing.T) {
+	for _, s := range []ExitStatus{ExitTimeout, ExitTooSlowSpeed, ExitNetworkProblem} {
+		if !s.Temporary() {
+			t.Errorf("%d should be temporary", s)
+		}
+	}
+	for _, s := range []ExitStatus{ExitResourceNotFound, ExitBadUrl, ExitHttpAuth, ExitChecksum, ExitNotEnoughSpace} {
+		if s.Temporary() {
+			t.Errorf("%d should not be temporary", s)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package downloader
+
+import internalhttp "github.com/divyam234/hydra/internal/http"
+
+// AuthProvider authenticates HTTP requests. Authorize is called before each
+// request, every ranged request of every connection included, so that
+// credentials which expire during a long download are renewed. Refresh is
+// called once when a request is answered with 401 Unauthorized and returns
+// whether to send it again; a second 401 fails the download. Providers must
+// be safe for concurrent use.
+type AuthProvider = internalhttp.AuthProvider
+
+// Token is an OAuth2 access token. A zero Expiry never expires.
+type Token = internalhttp.Token
+
+// TokenSource returns new OAuth2 access tokens
+type TokenSource = internalhttp.TokenSource
+
+// TokenSourceFunc adapts a function to a TokenSource
+type TokenSourceFunc = internalhttp.TokenSourceFunc
+
+// RefreshTokenSource gets access tokens from the token endpoint of an OAuth2
+// server with a refresh token, which is replaced when the server rotates it
+type RefreshTokenSource = internalhttp.RefreshTokenSource
+
+// BearerAuth sends token as a Bearer token. A rejected token is not retried.
+func BearerAuth(token string) AuthProvider {
+	return internalhttp.NewBearerAuth(token)
+}
+
+// DigestAuth logs in with HTTP Digest authentication (RFC 7616, MD5,
+// SHA-256 and SHA-512-256). The first request is sent without credentials
+// to get the server's challenge.
+func DigestAuth(user, password string) AuthProvider {
+	return internalhttp.NewDigestAuth(user, password)
+}
+
+// OAuth2Auth sends access tokens from src as Bearer tokens. A new token is
+// fetched shortly before the current one expires, and once when the server
+// rejects it.
+func OAuth2Auth(src TokenSource) AuthProvider {
+	return internalhttp.NewOAuth2Auth(src)
+}
@@ -1,16 +1,24 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/divyam234/hydra/pkg/apperror"
 )
 
 // setupTestServer creates a simple HTTP server for testing
@@ -1398,3 +1406,350 @@ func TestState_String(t *testing.T) {
 		}
 	}
 }
+
+func TestEngine_MaxOverallSpeed(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := make([]byte, 512*1024)
+	server := setupTestServer(t, content)
+	defer server.Close()
+
+	// Two downloads of 512KB share 512KB/s
+	eng := NewEngine(WithDir(tmpDir), WithMaxOverallSpeed("512K"))
+	defer eng.Shutdown()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := eng.AddDownload(context.Background(), []string{server.URL},
+			WithFilename(fmt.Sprintf("overall_%d.bin", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := eng.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	// Each download may burst 256KB, the remaining 512KB take a second
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("Downloads took %v, expected at least 1s at the shared limit", elapsed)
+	}
+}
+
+func TestEngine_SetMaxOverallSpeed(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := make([]byte, 1024*1024)
+	server := setupTestServer(t, content)
+	defer server.Close()
+
+	// 2MB at 16KB/s would take two minutes
+	eng := NewEngine(WithDir(tmpDir), WithMaxOverallSpeed("16K"))
+	defer eng.Shutdown()
+
+	for i := 0; i < 2; i++ {
+		if _, err := eng.AddDownload(context.Background(), []string{server.URL},
+			WithFilename(fmt.Sprintf("runtime_%d.bin", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if err := eng.SetMaxOverallSpeed("0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SetMaxOverallSpeed("fast"); err == nil {
+		t.Error("Expected an error for an invalid speed")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- eng.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Downloads did not speed up after the limit was lifted")
+	}
+}
+
+func TestEngine_ChangeOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := make([]byte, 1024*1024)
+	server := setupTestServer(t, content)
+	defer server.Close()
+
+	eng := NewEngine(WithDir(tmpDir))
+	defer eng.Shutdown()
+
+	// 1MB at 16KB/s would take a minute
+	id, err := eng.AddDownload(context.Background(), []string{server.URL},
+		WithFilename("changed.bin"), WithSplit(1), WithMaxSpeed("16K"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if err := eng.ChangeOptions(id, WithDir(t.TempDir())); err == nil {
+		t.Error("Expected an error when changing the directory of a running download")
+	}
+	if err := eng.ChangeOptions(id, WithMaxSpeed("0"), WithSplit(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.ChangeOptions("missing", WithSplit(2)); err == nil {
+		t.Error("Expected an error for an unknown download")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- eng.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Download did not speed up after the limit was lifted")
+	}
+
+	info, err := os.Stat(filepath.Join(tmpDir, "changed.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(content)) {
+		t.Errorf("Size = %d, want %d", info.Size(), len(content))
+	}
+}
+
+// retryOnce retries each failed request once, without waiting
+type retryOnce struct {
+	calls atomic.Int32
+}
+
+func (p *retryOnce) Retry(failures int, err error) (time.Duration, bool) {
+	p.calls.Add(1)
+	return 0, failures < 2
+}
+
+func TestWithRetryPolicy(t *testing.T) {
+	content := make([]byte, 64*1024)
+	inner := setupTestServer(t, content)
+	defer inner.Close()
+
+	// The first download request fails with a server error
+	var failed atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.Header.Get("Range") != "bytes=0-0" && failed.CompareAndSwap(false, true) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	policy := &retryOnce{}
+	result, err := Download(context.Background(), server.URL,
+		WithDir(t.TempDir()), WithFilename("policy.bin"), WithSplit(1), WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if result.TotalBytes != int64(len(content)) {
+		t.Errorf("TotalBytes = %d, want %d", result.TotalBytes, len(content))
+	}
+	if n := policy.calls.Load(); n != 1 {
+		t.Errorf("policy was asked %d times, want 1", n)
+	}
+}
+
+func TestEngine_HostHealth(t *testing.T) {
+	server := setupTestServer(t, make([]byte, 64*1024))
+	defer server.Close()
+
+	eng := NewEngine(WithDir(t.TempDir()), WithCircuitBreaker(3, time.Minute))
+	defer eng.Shutdown()
+
+	if _, err := eng.AddDownload(context.Background(), []string{server.URL}, WithFilename("health.bin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	hosts := eng.HostHealth()
+	if len(hosts) != 1 {
+		t.Fatalf("HostHealth() = %+v, want one host", hosts)
+	}
+	h := hosts[0]
+	if h.Host != strings.TrimPrefix(server.URL, "http://") || h.State != CircuitClosed ||
+		h.Requests == 0 || h.Failures != 0 || h.LastLatency <= 0 {
+		t.Errorf("HostHealth() = %+v", h)
+	}
+}
+
+func TestEngine_ErrorExitStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	eng := NewEngine(WithDir(t.TempDir()))
+	defer eng.Shutdown()
+
+	id, err := eng.AddDownload(context.Background(), []string{server.URL + "/missing.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitErr := eng.Wait()
+	if code := apperror.Code(waitErr); code != apperror.ExitResourceNotFound {
+		t.Errorf("Code(Wait()) = %d, want %d: %v", code, apperror.ExitResourceNotFound, waitErr)
+	}
+
+	status, err := eng.Status(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var appErr *apperror.Error
+	if !errors.As(status.Error, &appErr) || appErr.Code != apperror.ExitResourceNotFound || appErr.Code.Temporary() {
+		t.Errorf("Status.Error = %v, want a permanent ExitResourceNotFound", status.Error)
+	}
+}
+
+func TestDownload_AuthProvider(t *testing.T) {
+	content := []byte(strings.Repeat("bearer", 10000))
+	inner := setupTestServer(t, content)
+	defer inner.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	result, err := Download(context.Background(), server.URL+"/file.bin",
+		WithDir(tmpDir),
+		WithSplit(2),
+		WithAuthProvider(BearerAuth("s3cret")),
+	)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, _ := os.ReadFile(result.Filename)
+	if !bytes.Equal(got, content) {
+		t.Error("content mismatch")
+	}
+
+	_, err = Download(context.Background(), server.URL+"/file.bin",
+		WithDir(t.TempDir()),
+		WithRetries(1),
+		WithAuthProvider(BearerAuth("wrong")),
+	)
+	if code := apperror.Code(err); code != apperror.ExitHttpAuth {
+		t.Errorf("Code(err) = %d, want ExitHttpAuth: %v", code, err)
+	}
+}
+
+func TestDownload_URLRefresher(t *testing.T) {
+	content := []byte(strings.Repeat("presigned", 10000))
+	inner := setupTestServer(t, content)
+	defer inner.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("expires") != "later" {
+			http.Error(w, "Request has expired", http.StatusForbidden)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	var refreshed []string
+	result, err := Download(context.Background(), server.URL+"/file.bin?expires=now",
+		WithDir(t.TempDir()),
+		WithFilename("file.bin"),
+		WithURLRefresher(func(ctx context.Context, oldURL string) (string, error) {
+			refreshed = append(refreshed, oldURL)
+			return server.URL + "/file.bin?expires=later", nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if got, _ := os.ReadFile(result.Filename); !bytes.Equal(got, content) {
+		t.Error("content mismatch")
+	}
+	if len(refreshed) != 1 || refreshed[0] != server.URL+"/file.bin?expires=now" {
+		t.Errorf("refreshed %q", refreshed)
+	}
+}
+
+func TestDownload_S3(t *testing.T) {
+	content := []byte(strings.Repeat("bucket", 10000))
+	inner := setupTestServer(t, content)
+	defer inner.Close()
+	var unsigned atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDTEST/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-north-1/s3/aws4_request") ||
+			r.URL.Path != "/releases/v1/app.tar" {
+			unsigned.Add(1)
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	result, err := Download(context.Background(), "s3://releases/v1/app.tar",
+		WithDir(t.TempDir()),
+		WithS3Endpoint(server.URL),
+		WithS3Region("eu-north-1"),
+		WithS3Credentials("AKIDTEST", "secret", ""),
+	)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if filepath.Base(result.Filename) != "app.tar" {
+		t.Errorf("Filename = %s, want app.tar", result.Filename)
+	}
+	if got, _ := os.ReadFile(result.Filename); !bytes.Equal(got, content) {
+		t.Error("content mismatch")
+	}
+	if n := unsigned.Load(); n != 0 {
+		t.Errorf("%d requests not signed", n)
+	}
+}
+
+func TestDownload_CACertificateAndPinning(t *testing.T) {
+	content := []byte(strings.Repeat("pinned", 10000))
+	inner := setupTestServer(t, content)
+	defer inner.Close()
+	server := httptest.NewTLSServer(inner.Config.Handler)
+	defer server.Close()
+
+	// The test certificate is issued for 127.0.0.1, so it verifies once
+	// trusted
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	if _, err := Download(context.Background(), server.URL+"/file.bin",
+		WithDir(t.TempDir()), WithCACertificate(caFile), WithMinTLSVersion("1.2"),
+	); err != nil {
+		t.Fatalf("download with CA certificate failed: %v", err)
+	}
+
+	// Pins match the server name, which is only sent for host names
+	sum := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/file.bin"
+	if _, err := Download(context.Background(), url,
+		WithDir(t.TempDir()), WithCheckCertificate(false),
+		WithPinnedPubkey("localhost", "sha256//"+base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)), "sha256//"+base64.StdEncoding.EncodeToString(sum[:])),
+	); err != nil {
+		t.Fatalf("download with matching pin failed: %v", err)
+	}
+	_, err := Download(context.Background(), url,
+		WithDir(t.TempDir()), WithCheckCertificate(false), WithRetries(3),
+		WithPinnedPubkey("localhost", "sha256//"+base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))),
+	)
+	if err == nil || !strings.Contains(err.Error(), "pinned") {
+		t.Errorf("download with wrong pin = %v, want a pin mismatch", err)
+	}
+}
@@ -3,9 +3,12 @@ package downloader
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"github.com/divyam234/hydra/internal/engine"
+	"github.com/divyam234/hydra/internal/metalink"
 	"github.com/divyam234/hydra/internal/ui"
 	"github.com/divyam234/hydra/pkg/option"
 )
@@ -33,6 +36,21 @@ func NewEngine(opts ...Option) *Engine {
 	if cfg.sessionFile != "" {
 		engineOpts = append(engineOpts, engine.WithSessionFile(cfg.sessionFile))
 	}
+	if cfg.schedule != nil {
+		engineOpts = append(engineOpts, engine.WithSchedule(cfg.schedule))
+	}
+	if cfg.scheduleFile != "" {
+		engineOpts = append(engineOpts, engine.WithScheduleFile(cfg.scheduleFile))
+	}
+	if cfg.retryPolicy != nil {
+		engineOpts = append(engineOpts, engine.WithRetryPolicy(cfg.retryPolicy))
+	}
+	if cfg.auth != nil {
+		engineOpts = append(engineOpts, engine.WithAuthProvider(cfg.auth))
+	}
+	if cfg.urlRefresher != nil {
+		engineOpts = append(engineOpts, engine.WithURLRefresher(cfg.urlRefresher))
+	}
 	if cfg.eventCb != nil {
 		engineOpts = append(engineOpts, engine.WithEventCallback(func(e engine.Event) {
 			cfg.eventCb(Event{
@@ -89,6 +107,48 @@ func (e *Engine) AddDownload(ctx context.Context, urls []string, opts ...Option)
 	return DownloadID(gid), nil
 }
 
+// AddMetalink reads a Metalink v4 or v3 document and starts one download per
+// file, using the file's mirrors, size and hashes. Options given here apply
+// to every file; WithFilename is ignored for multi-file Metalinks.
+func (e *Engine) AddMetalink(ctx context.Context, r io.Reader, opts ...Option) ([]DownloadID, error) {
+	ml, err := metalink.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{
+		opt: e.options.Clone(),
+	}
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	var customUI ui.UserInterface
+	if cfg.progressCb != nil || cfg.messageCb != nil {
+		customUI = &callbackUI{
+			progressCb: cfg.progressCb,
+			messageCb:  cfg.messageCb,
+		}
+	}
+
+	gids, err := e.internal.AddMetalink(ctx, ml, cfg.opt, customUI, cfg.priority)
+	ids := make([]DownloadID, len(gids))
+	for i, gid := range gids {
+		ids[i] = DownloadID(gid)
+	}
+	return ids, err
+}
+
+// AddMetalinkFile is like AddMetalink but reads the document from path
+func (e *Engine) AddMetalinkFile(ctx context.Context, path string, opts ...Option) ([]DownloadID, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return e.AddMetalink(ctx, f, opts...)
+}
+
 // SetProgressCallback sets a global progress callback for the engine
 func (e *Engine) SetProgressCallback(cb func(Progress)) {
 	// Preserve existing message callback if present
@@ -147,6 +207,33 @@ func (e *Engine) Cancel(id DownloadID) bool {
 	return e.internal.Cancel(engine.GID(id))
 }
 
+// ChangeOptions changes the options of a running or queued download without
+// restarting it, e.g. ChangeOptions(id, WithSplit(8), WithMaxSpeed("2M")).
+// Connections are added or retired, and limits, retry settings, headers and
+// credentials apply to the next requests. Options that cannot change while
+// downloading return an error and nothing is applied.
+func (e *Engine) ChangeOptions(id DownloadID, opts ...Option) error {
+	current := e.internal.GetOptions(engine.GID(id))
+	if current == nil {
+		return fmt.Errorf("download not found: %s", id)
+	}
+
+	cfg := &config{
+		opt: current.Clone(),
+	}
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	changes := option.NewOption()
+	for key, value := range cfg.opt.ToMap() {
+		if !current.Defined(key) || current.Get(key) != value {
+			changes.Put(key, value)
+		}
+	}
+	return e.internal.ChangeOptions(engine.GID(id), changes)
+}
+
 // Status retrieves the status of a download
 func (e *Engine) Status(id DownloadID) (*Status, error) {
 	gid := engine.GID(id)
@@ -228,6 +315,22 @@ func (e *Engine) SetMaxConcurrentDownloads(n int) {
 	e.internal.SetMaxConcurrent(n)
 }
 
+// SetMaxOverallSpeed changes the max download speed shared by all downloads
+// (e.g. "10M", "0" for unlimited). Running downloads adapt immediately.
+func (e *Engine) SetMaxOverallSpeed(limit string) error {
+	val, err := option.ParseUnitNumber(limit)
+	if err != nil {
+		return fmt.Errorf("invalid speed %q: %w", limit, err)
+	}
+	e.internal.SetMaxOverallDownloadLimit(int(val))
+	return nil
+}
+
+// SetSchedule replaces the time-of-day schedule at runtime; nil removes it
+func (e *Engine) SetSchedule(s *Schedule) {
+	e.internal.SetSchedule(s)
+}
+
 // GetQueuePosition returns the position of a download in the pending queue.
 // Returns -1 if the download is not in the queue (either active, completed, or not found).
 // Position 0 means it's next to be started.
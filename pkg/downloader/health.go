@@ -0,0 +1,30 @@
+package downloader
+
+import "github.com/divyam234/hydra/internal/engine"
+
+// HostHealth is the health of a server as seen by all downloads of an
+// engine: requests and failures, consecutive failures, the latency of the
+// last response and the state of its circuit breaker
+type HostHealth = engine.HostStatus
+
+// CircuitState is the state of the circuit breaker of a host
+type CircuitState = engine.CircuitState
+
+const (
+	// CircuitClosed lets requests through
+	CircuitClosed = engine.CircuitClosed
+	// CircuitOpen fails requests at once until the cooldown has passed
+	CircuitOpen = engine.CircuitOpen
+	// CircuitHalfOpen lets a single trial request through after the cooldown
+	CircuitHalfOpen = engine.CircuitHalfOpen
+)
+
+// CircuitOpenError is the error of a request that was not sent because the
+// circuit of its host is open
+type CircuitOpenError = engine.CircuitOpenError
+
+// HostHealth returns the health of every host the engine's downloads have
+// sent requests to, sorted by host
+func (e *Engine) HostHealth() []HostHealth {
+	return e.internal.HostHealth()
+}
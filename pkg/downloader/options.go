@@ -1,7 +1,10 @@
 package downloader
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/divyam234/hydra/pkg/option"
 )
@@ -17,6 +20,11 @@ type config struct {
 	sessionFile   string
 	eventCb       func(Event)
 	priority      int
+	schedule      *Schedule
+	scheduleFile  string
+	retryPolicy   RetryPolicy
+	auth          AuthProvider
+	urlRefresher  func(ctx context.Context, oldURL string) (string, error)
 }
 
 // Option configures the download
@@ -43,6 +51,35 @@ func WithSplit(n int) Option {
 	}
 }
 
+// WithAutoSplit tunes the number of connections from the observed
+// throughput, starting with 2 and using at most max (0 for the default of
+// 16). WithMaxConnPerServer also limits it for each server.
+func WithAutoSplit(max int) Option {
+	return func(c *config) {
+		c.opt.Put(option.Split, "auto")
+		if max > 0 {
+			c.opt.Put(option.MaxSplit, fmt.Sprintf("%d", max))
+		}
+	}
+}
+
+// WithEndgameDuplicates requests the last n outstanding ranges a second time
+// on idle connections once nothing else is left to download. The first copy
+// to finish is kept and the other request is cancelled. 0 (the default)
+// splits the largest remaining range instead.
+func WithEndgameDuplicates(n int) Option {
+	return func(c *config) {
+		c.opt.Put(option.EndgameDuplicates, fmt.Sprintf("%d", n))
+	}
+}
+
+// WithMaxConnPerServer sets the maximum number of connections to one server
+func WithMaxConnPerServer(n int) Option {
+	return func(c *config) {
+		c.opt.Put(option.MaxConnPerServer, fmt.Sprintf("%d", n))
+	}
+}
+
 // WithMaxSpeed sets the max download speed (e.g. "1M", "500K")
 func WithMaxSpeed(limit string) Option {
 	return func(c *config) {
@@ -50,6 +87,14 @@ func WithMaxSpeed(limit string) Option {
 	}
 }
 
+// WithMaxOverallSpeed sets the max download speed shared by all downloads
+// of the engine (e.g. "10M"), split fairly among the active ones (engine-level)
+func WithMaxOverallSpeed(limit string) Option {
+	return func(c *config) {
+		c.opt.Put(option.MaxOverallDownloadLimit, limit)
+	}
+}
+
 // WithLowestSpeed sets the lowest speed limit (e.g. "10K")
 func WithLowestSpeed(limit string) Option {
 	return func(c *config) {
@@ -64,13 +109,51 @@ func WithRetries(n int) Option {
 	}
 }
 
-// WithRetryWait sets the wait time between retries in seconds
+// WithRetryWait sets the wait before the first retry in seconds. The wait
+// doubles after each further failure, up to 60 seconds by default.
 func WithRetryWait(seconds int) Option {
 	return func(c *config) {
 		c.opt.Put(option.RetryWait, fmt.Sprintf("%d", seconds))
 	}
 }
 
+// WithRetryBackoff sets the wait before the first retry and the longest wait
+// it may double to (0 for no limit). Waits are randomized by up to half.
+func WithRetryBackoff(initial, max time.Duration) Option {
+	return func(c *config) {
+		c.opt.Put(option.RetryWait, initial.String())
+		c.opt.Put(option.MaxRetryWait, max.String())
+	}
+}
+
+// WithMaxFileNotFound fails a download once the servers answered "file not
+// found" n times before a single byte was downloaded. Until then such answers
+// are retried. 0 (the default) does not retry them at all.
+func WithMaxFileNotFound(n int) Option {
+	return func(c *config) {
+		c.opt.Put(option.MaxFileNotFound, fmt.Sprintf("%d", n))
+	}
+}
+
+// WithCircuitBreaker opens the circuit of a host after threshold
+// consecutive failures, shared by all downloads of the engine: requests to
+// it fail at once, or go to another mirror, until cooldown has passed and a
+// trial request succeeds. A threshold of 0 disables the breaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *config) {
+		c.opt.Put(option.CircuitBreakerThreshold, fmt.Sprintf("%d", threshold))
+		c.opt.Put(option.CircuitBreakerCooldown, cooldown.String())
+	}
+}
+
+// WithRetryPolicy decides the retries of all downloads with p instead of
+// the retry options (engine-level)
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *config) {
+		c.retryPolicy = p
+	}
+}
+
 // WithTimeout sets the timeout in seconds
 func WithTimeout(seconds int) Option {
 	return func(c *config) {
@@ -107,6 +190,130 @@ func WithAuth(user, pass string) Option {
 	}
 }
 
+// WithNetrc sets whether logins are looked up in the .netrc file (default
+// true). Entries apply to their host only; WithAuth and WithFTPAuth take
+// precedence.
+func WithNetrc(enable bool) Option {
+	return func(c *config) {
+		c.opt.Put(option.NoNetrc, fmt.Sprintf("%v", !enable))
+	}
+}
+
+// WithNetrcPath reads logins from the .netrc file at path instead of
+// $HOME/.netrc. Downloads fail if the file cannot be read.
+func WithNetrcPath(path string) Option {
+	return func(c *config) {
+		c.opt.Put(option.NetrcPath, path)
+	}
+}
+
+// WithAuthProvider authenticates the HTTP requests of all downloads with p,
+// in place of WithAuth and .netrc logins (engine-level). Credentials are not
+// sent to other hosts after a redirect.
+func WithAuthProvider(p AuthProvider) Option {
+	return func(c *config) {
+		c.auth = p
+	}
+}
+
+// WithURLRefresher calls f for a new URL when the server stops accepting
+// one with 401, 403 or 410, e.g. because a presigned URL expired
+// (engine-level). Workers continue from where they got to with the new URL,
+// which also replaces the old one in the control file and the session.
+func WithURLRefresher(f func(ctx context.Context, oldURL string) (string, error)) Option {
+	return func(c *config) {
+		c.urlRefresher = f
+	}
+}
+
+// WithURLRefreshCommand runs command with the shell when the server stops
+// accepting a URL, and continues with the URL printed on its first line. The
+// old URL is passed in the HYDRA_URL environment variable.
+func WithURLRefreshCommand(command string) Option {
+	return func(c *config) {
+		c.opt.Put(option.URLRefreshCommand, command)
+	}
+}
+
+// WithS3Endpoint downloads s3://bucket/key URIs from the S3-compatible store
+// at url, such as MinIO, addressing buckets in the path. Without it, they
+// come from Amazon S3, or $AWS_ENDPOINT_URL_S3 or $AWS_ENDPOINT_URL if set.
+func WithS3Endpoint(url string) Option {
+	return func(c *config) {
+		c.opt.Put(option.S3Endpoint, url)
+	}
+}
+
+// WithS3Region sets the region S3 requests are signed for. It defaults to
+// $AWS_REGION, $AWS_DEFAULT_REGION or us-east-1.
+func WithS3Region(region string) Option {
+	return func(c *config) {
+		c.opt.Put(option.S3Region, region)
+	}
+}
+
+// WithS3Credentials signs S3 requests with the given keys. sessionToken is
+// only needed for temporary credentials. Without it, the AWS_* environment
+// variables and then the shared credentials file are used, and requests are
+// sent unsigned if neither has credentials.
+func WithS3Credentials(accessKey, secretKey, sessionToken string) Option {
+	return func(c *config) {
+		c.opt.Put(option.S3AccessKey, accessKey)
+		c.opt.Put(option.S3SecretKey, secretKey)
+		c.opt.Put(option.S3SessionToken, sessionToken)
+	}
+}
+
+// WithS3Profile takes S3 credentials from profile of the shared credentials
+// file instead of $AWS_PROFILE or "default". Downloads fail if the profile
+// has no credentials.
+func WithS3Profile(profile string) Option {
+	return func(c *config) {
+		c.opt.Put(option.S3Profile, profile)
+	}
+}
+
+// WithFTPAuth sets the FTP login used when the URL has no credentials.
+// Without it, FTP downloads log in anonymously.
+func WithFTPAuth(user, pass string) Option {
+	return func(c *config) {
+		c.opt.Put(option.FtpUser, user)
+		c.opt.Put(option.FtpPasswd, pass)
+	}
+}
+
+// WithFTPPassive sets whether FTP transfers use passive mode (default true).
+// Active mode makes the server connect back to the client.
+func WithFTPPassive(passive bool) Option {
+	return func(c *config) {
+		c.opt.Put(option.FtpPasv, fmt.Sprintf("%v", passive))
+	}
+}
+
+// WithFTPTLS sets whether ftp:// connections are upgraded with AUTH TLS.
+// ftps:// URLs always use implicit TLS.
+func WithFTPTLS(enable bool) Option {
+	return func(c *config) {
+		c.opt.Put(option.FtpTLS, fmt.Sprintf("%v", enable))
+	}
+}
+
+// WithRemoteTime sets whether the downloaded file gets the modification time
+// reported by the server (Last-Modified or FTP MDTM)
+func WithRemoteTime(enable bool) Option {
+	return func(c *config) {
+		c.opt.Put(option.RemoteTime, fmt.Sprintf("%v", enable))
+	}
+}
+
+// WithAlwaysResume makes a download whose remote file changed since it was
+// interrupted fail with apperror.ExitCannotResume instead of starting over
+func WithAlwaysResume(enable bool) Option {
+	return func(c *config) {
+		c.opt.Put(option.AlwaysResume, fmt.Sprintf("%v", enable))
+	}
+}
+
 // WithCookieFile sets the path to a Netscape/Mozilla formatted cookie file
 func WithCookieFile(path string) Option {
 	return func(c *config) {
@@ -114,7 +321,8 @@ func WithCookieFile(path string) Option {
 	}
 }
 
-// WithChecksum sets the checksum verification (e.g. "sha-1=digest")
+// WithChecksum sets the checksum verification (e.g. "sha-1=digest"). The value
+// may also be the path or URL of a checksum file such as SHA256SUMS.
 func WithChecksum(checksum string) Option {
 	return func(c *config) {
 		c.opt.Put(option.Checksum, checksum)
@@ -183,6 +391,22 @@ func WithSessionFile(path string) Option {
 	}
 }
 
+// WithSchedule applies time-of-day speed limits and pauses to all downloads
+// (engine-level). See ParseSchedule for the format.
+func WithSchedule(s *Schedule) Option {
+	return func(c *config) {
+		c.schedule = s
+	}
+}
+
+// WithScheduleFile loads the schedule from a file, which is reloaded when it
+// changes (engine-level)
+func WithScheduleFile(path string) Option {
+	return func(c *config) {
+		c.scheduleFile = path
+	}
+}
+
 // OnEvent sets the event callback for download events (engine-level)
 func OnEvent(cb func(Event)) Option {
 	return func(c *config) {
@@ -218,6 +442,53 @@ func WithCheckCertificate(check bool) Option {
 	}
 }
 
+// WithCACertificate trusts the PEM certificates of path, a bundle file or a
+// directory of them, besides the system roots
+func WithCACertificate(path string) Option {
+	return func(c *config) {
+		c.opt.Put(option.CACertificate, path)
+	}
+}
+
+// WithClientCertificate presents the certificate of certFile to servers
+// asking for one. PEM files may hold the key themselves, keyFile being
+// empty; other files are read as PKCS#12 (see WithCertificatePassword).
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(c *config) {
+		c.opt.Put(option.Certificate, certFile)
+		c.opt.Put(option.PrivateKey, keyFile)
+	}
+}
+
+// WithCertificatePassword sets the password of a PKCS#12 client certificate
+func WithCertificatePassword(password string) Option {
+	return func(c *config) {
+		c.opt.Put(option.CertificatePassword, password)
+	}
+}
+
+// WithMinTLSVersion refuses servers that do not support version ("1.0",
+// "1.1", "1.2" or "1.3")
+func WithMinTLSVersion(version string) Option {
+	return func(c *config) {
+		c.opt.Put(option.MinTLSVersion, version)
+	}
+}
+
+// WithPinnedPubkey pins the public keys host may present, given as
+// "sha256//<base64>" hashes of their SubjectPublicKeyInfo. A host of
+// "*.example.com" covers its subdomains. Connections presenting none of the
+// keys fail, and are not retried.
+func WithPinnedPubkey(host string, pins ...string) Option {
+	return func(c *config) {
+		entry := host + "=" + strings.Join(pins, ";")
+		if current := c.opt.Get(option.PinnedPubkey); current != "" {
+			entry = current + "\n" + entry
+		}
+		c.opt.Put(option.PinnedPubkey, entry)
+	}
+}
+
 // WithForceSequential sets whether to force sequential download of multiple URIs
 func WithForceSequential(force bool) Option {
 	return func(c *config) {
@@ -61,7 +61,7 @@ type Status struct {
 	State            State
 	Progress         Progress
 	Filename         string
-	Error            error
+	Error            error // An *apperror.Error carrying the exit status
 	Duration         time.Duration
 	ChecksumOK       bool
 	ChecksumVerified bool
@@ -0,0 +1,31 @@
+package downloader
+
+import (
+	"time"
+
+	"github.com/divyam234/hydra/internal/retry"
+)
+
+// RetryPolicy decides whether a failed request is tried again. Retry is
+// called after a request failed with err for the failures-th time in a row
+// and returns whether to try again and how long to wait first. The number
+// of tries is still limited by WithRetries.
+type RetryPolicy = retry.Policy
+
+// Backoff is the default RetryPolicy: retryable errors are retried after
+// Initial, doubling the wait after each further failure up to Max, with
+// Jitter as the random fraction of each wait
+type Backoff = retry.Backoff
+
+// Retryable reports whether a request that failed with err may succeed if
+// tried again. Client errors (4xx other than 408 and 429) and permanent FTP
+// replies are not retryable; network and server errors are.
+func Retryable(err error) bool {
+	return retry.Retryable(err)
+}
+
+// RetryAfter returns the wait a 429 or 503 answer asked for with its
+// Retry-After header, 0 if none
+func RetryAfter(err error) time.Duration {
+	return retry.RetryAfter(err)
+}
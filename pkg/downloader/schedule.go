@@ -0,0 +1,27 @@
+package downloader
+
+import "github.com/divyam234/hydra/internal/schedule"
+
+// Schedule is a set of time-of-day rules that limit the overall download
+// speed or pause all downloads
+type Schedule = schedule.Schedule
+
+// ParseSchedule parses a schedule with one rule per line:
+//
+//	# days      time         action
+//	weekdays    09:00-18:00  limit 2M
+//	*           18:00-09:00  limit 0
+//	*           12:00-13:00  pause
+//
+// Days are "*", "weekdays", "weekends" or lists such as "mon-fri,sun".
+// Windows ending before they start run past midnight. "limit 0" is
+// unlimited; the last matching limit rule wins, and outside any limit rule
+// the engine's overall limit applies.
+func ParseSchedule(spec string) (*Schedule, error) {
+	return schedule.ParseString(spec)
+}
+
+// LoadSchedule reads a schedule file
+func LoadSchedule(path string) (*Schedule, error) {
+	return schedule.Load(path)
+}
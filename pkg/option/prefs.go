@@ -6,13 +6,20 @@ const (
 	Timeout             = "timeout"
 	ConnectTimeout      = "connect-timeout"
 	MaxTries            = "max-tries"
-	RetryWait           = "retry-wait"
+	RetryWait           = "retry-wait"     // Seconds or a duration, doubled after each failure
+	MaxRetryWait        = "max-retry-wait" // Longest wait between retries
 	MaxConnPerServer    = "max-connection-per-server"
-	Split               = "split"
+	Split               = "split"     // Number of connections, or "auto" to tune it
+	MaxSplit            = "max-split" // Most connections used by split "auto"
 	MinSplitSize        = "min-split-size"
 	MaxPiecesPerSegment = "max-pieces-per-segment"
 	LowestSpeedLimit    = "lowest-speed-limit"
 	MaxFileNotFound     = "max-file-not-found"
+	EndgameDuplicates   = "endgame-duplicates" // Last ranges requested twice, 0 to split instead
+
+	// Circuit breaker, per host and shared by all downloads
+	CircuitBreakerThreshold = "circuit-breaker-threshold" // Consecutive failures opening the circuit, 0 to disable
+	CircuitBreakerCooldown  = "circuit-breaker-cooldown"  // Seconds or a duration before a trial request
 
 	// Advanced Network Tuning
 	ReadBufferSize      = "read-buffer-size"
@@ -36,12 +43,35 @@ const (
 	// Authentication
 	HttpUser    = "http-user"
 	HttpPasswd  = "http-passwd"
-	NoNetrc     = "no-netrc"
-	NetrcPath   = "netrc-path"
+	NoNetrc     = "no-netrc"   // bool, do not read credentials from .netrc
+	NetrcPath   = "netrc-path" // .netrc file, $HOME/.netrc if empty
 	LoadCookies = "load-cookies"
 
+	// Signed URLs
+	URLRefreshCommand = "url-refresh-command" // Prints a new URL once the old one expired
+
+	// S3
+	S3Endpoint     = "s3-endpoint" // S3-compatible store, Amazon S3 if empty
+	S3Region       = "s3-region"   // $AWS_REGION, $AWS_DEFAULT_REGION or us-east-1 if empty
+	S3AccessKey    = "s3-access-key"
+	S3SecretKey    = "s3-secret-key"
+	S3SessionToken = "s3-session-token"
+	S3Profile      = "s3-profile" // Profile of the shared credentials file
+
+	// FTP Options
+	FtpUser   = "ftp-user"
+	FtpPasswd = "ftp-passwd"
+	FtpPasv   = "ftp-pasv" // bool, default true (false = active mode)
+	FtpTLS    = "ftp-tls"  // bool, upgrade ftp:// with AUTH TLS
+
 	// Security
-	CheckCertificate = "check-certificate" // bool, default true
+	CheckCertificate    = "check-certificate"    // bool, default true
+	CACertificate       = "ca-certificate"       // PEM bundle file or directory, trusted besides the system roots
+	Certificate         = "certificate"          // Client certificate, PEM or PKCS#12 (.p12, .pfx)
+	PrivateKey          = "private-key"          // PEM key of certificate, if not in the same file
+	CertificatePassword = "certificate-password" // Password of a PKCS#12 certificate
+	MinTLSVersion       = "min-tls-version"      // 1.0, 1.1, 1.2 or 1.3
+	PinnedPubkey        = "pinned-pubkey"        // Newline separated host=sha256//<base64> entries
 
 	// Proxy
 	Proxy       = "proxy"
@@ -58,6 +88,8 @@ const (
 	Continue                = "continue"
 	AutoFileRenaming        = "auto-file-renaming"
 	AllowOverwrite          = "allow-overwrite"
+	AlwaysResume            = "always-resume" // bool, fail instead of restarting when the remote file changed
+	ExpectedSize            = "expected-size" // Size announced by a Metalink, mirrors must match it
 
 	// Session Options
 	InputFile           = "input-file"
@@ -67,7 +99,8 @@ const (
 	NoConf              = "no-conf"
 
 	// Checksum
-	Checksum = "checksum"
+	Checksum    = "checksum"
+	PieceHashes = "piece-hashes" // algo:pieceLength:hash1,hash2,... (from Metalink)
 
 	// Logging
 	Log             = "log"
@@ -83,29 +116,39 @@ const (
 
 // Default values
 const (
-	DefaultTimeout                = "0" // 0 = no timeout, appropriate for large downloads
-	DefaultConnectTimeout         = "15"
-	DefaultMaxTries               = "5"
-	DefaultRetryWait              = "0"
-	DefaultMaxConnPerServer       = "1"
-	DefaultSplit                  = "5"
-	DefaultMinSplitSize           = "20M"
-	DefaultMaxPiecesPerSegment    = "1"
-	DefaultUserAgent              = "hydra/0.1.0"
-	DefaultEnableHttpKeepAlive    = "true"
-	DefaultEnableHttpPipelining   = "false"
-	DefaultHttpNoCache            = "false"
-	DefaultHttpAcceptGzip         = "true"
-	DefaultProxyMethod            = "get"
-	DefaultMaxConcurrentDownloads = "5"
-	DefaultContinue               = "false"
-	DefaultAutoFileRenaming       = "true"
-	DefaultAllowOverwrite         = "false"
-	DefaultPieceSelector          = "inorder"
-	DefaultFileAllocation         = "trunc"
-	DefaultCheckCertificate       = "true"
-	DefaultForceSequential        = "false"
-	DefaultQuiet                  = "false"
+	DefaultTimeout                 = "0" // 0 = no timeout, appropriate for large downloads
+	DefaultConnectTimeout          = "15"
+	DefaultMaxTries                = "5"
+	DefaultRetryWait               = "0"
+	DefaultMaxRetryWait            = "60"
+	DefaultMaxFileNotFound         = "0"
+	DefaultMaxConnPerServer        = "1"
+	DefaultSplit                   = "5"
+	DefaultMaxSplit                = "16"
+	DefaultMinSplitSize            = "20M"
+	DefaultMaxPiecesPerSegment     = "1"
+	DefaultEndgameDuplicates       = "0"
+	DefaultCircuitBreakerThreshold = "5"
+	DefaultCircuitBreakerCooldown  = "30"
+	DefaultUserAgent               = "hydra/0.1.0"
+	DefaultEnableHttpKeepAlive     = "true"
+	DefaultEnableHttpPipelining    = "false"
+	DefaultHttpNoCache             = "false"
+	DefaultHttpAcceptGzip          = "true"
+	DefaultNoNetrc                 = "false"
+	DefaultProxyMethod             = "get"
+	DefaultFtpPasv                 = "true"
+	DefaultFtpTLS                  = "false"
+	DefaultMaxConcurrentDownloads  = "5"
+	DefaultContinue                = "false"
+	DefaultAutoFileRenaming        = "true"
+	DefaultAllowOverwrite          = "false"
+	DefaultAlwaysResume            = "false"
+	DefaultPieceSelector           = "inorder"
+	DefaultFileAllocation          = "trunc"
+	DefaultCheckCertificate        = "true"
+	DefaultForceSequential         = "false"
+	DefaultQuiet                   = "false"
 
 	// Network Tuning Defaults
 	DefaultReadBufferSize      = "256K"
@@ -123,20 +166,30 @@ func GetDefaultOptions() *Option {
 	opt.Put(ConnectTimeout, DefaultConnectTimeout)
 	opt.Put(MaxTries, DefaultMaxTries)
 	opt.Put(RetryWait, DefaultRetryWait)
+	opt.Put(MaxRetryWait, DefaultMaxRetryWait)
+	opt.Put(MaxFileNotFound, DefaultMaxFileNotFound)
 	opt.Put(MaxConnPerServer, DefaultMaxConnPerServer)
 	opt.Put(Split, DefaultSplit)
+	opt.Put(MaxSplit, DefaultMaxSplit)
 	opt.Put(MinSplitSize, DefaultMinSplitSize)
 	opt.Put(MaxPiecesPerSegment, DefaultMaxPiecesPerSegment)
+	opt.Put(EndgameDuplicates, DefaultEndgameDuplicates)
+	opt.Put(CircuitBreakerThreshold, DefaultCircuitBreakerThreshold)
+	opt.Put(CircuitBreakerCooldown, DefaultCircuitBreakerCooldown)
 	opt.Put(UserAgent, DefaultUserAgent)
 	opt.Put(EnableHttpKeepAlive, DefaultEnableHttpKeepAlive)
 	opt.Put(EnableHttpPipelining, DefaultEnableHttpPipelining)
 	opt.Put(HttpNoCache, DefaultHttpNoCache)
 	opt.Put(HttpAcceptGzip, DefaultHttpAcceptGzip)
+	opt.Put(NoNetrc, DefaultNoNetrc)
 	opt.Put(ProxyMethod, DefaultProxyMethod)
+	opt.Put(FtpPasv, DefaultFtpPasv)
+	opt.Put(FtpTLS, DefaultFtpTLS)
 	opt.Put(MaxConcurrentDownloads, DefaultMaxConcurrentDownloads)
 	opt.Put(Continue, DefaultContinue)
 	opt.Put(AutoFileRenaming, DefaultAutoFileRenaming)
 	opt.Put(AllowOverwrite, DefaultAllowOverwrite)
+	opt.Put(AlwaysResume, DefaultAlwaysResume)
 	opt.Put(PieceSelector, DefaultPieceSelector)
 	opt.Put(FileAllocation, DefaultFileAllocation)
 	opt.Put(CheckCertificate, DefaultCheckCertificate)
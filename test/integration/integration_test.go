@@ -247,3 +247,42 @@ func transfer(destination io.WriteCloser, source io.ReadCloser) {
 	defer source.Close()
 	io.Copy(destination, source)
 }
+
+func TestMetalinkFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer ts.Close()
+
+	dir, err := os.MkdirTemp("", "hydra-metalink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="one.txt"><url>%s/one</url></file>
+  <file name="two.txt"><url>%s/two</url></file>
+</metalink>`, ts.URL, ts.URL)
+	metaPath := filepath.Join(dir, "files.meta4")
+	if err := os.WriteFile(metaPath, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := filepath.Join(dir, "out")
+	cmd := exec.Command(hydraBinary, "download", "-d", outDir, metaPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Hydra failed: %v\nOutput: %s", err, output)
+	}
+
+	for name, want := range map[string]string{"one.txt": "content of /one", "two.txt": "content of /two"} {
+		got, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Errorf("%s not downloaded: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}